@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/alielmi98/image-processing-service/constants"
 	"github.com/alielmi98/image-processing-service/di"
 	"github.com/alielmi98/image-processing-service/docs"
 	authRouter "github.com/alielmi98/image-processing-service/internal/auth/api/routers"
 	imageRouter "github.com/alielmi98/image-processing-service/internal/image/api/routers"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/messaging"
 	"github.com/alielmi98/image-processing-service/internal/middlewares"
+	"github.com/alielmi98/image-processing-service/internal/processor"
 	migration "github.com/alielmi98/image-processing-service/migrations"
 	"github.com/alielmi98/image-processing-service/pkg/config"
 	"github.com/alielmi98/image-processing-service/pkg/db"
@@ -32,20 +42,212 @@ func main() {
 
 	// Migrate the database
 	migration.Up1()
+	migration.Up2()
+	migration.Up3()
+	migration.Up4()
+	migration.Up5()
+	migration.Up6()
+	migration.Up7()
+	migration.Up8()
+	migration.Up9()
+	migration.Up10()
 
-	InitServer(cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	// Without RabbitMQ the broker connects in the background, only an invalid setup fails here
+	sender, err := di.GetMessageSender(cfg)
+	if err != nil {
+		log.Fatalf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	consumers, err := StartConsumers(ctx, cfg, sender)
+	if err != nil {
+		log.Fatalf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	// The background loops return once ctx is done, Shutdown waits for them
+	var background sync.WaitGroup
+	StartOutboxRelay(ctx, cfg, sender, &background)
+	StartEventListener(ctx, cfg, &background)
+	StartWebhookDispatcher(ctx, cfg, &background)
+	StartIdempotencyPurge(ctx, cfg, &background)
+	StartJobReaper(ctx, cfg, &background)
+	StartJobScheduler(ctx, cfg, &background)
+
+	srv := InitServer(cfg)
+
+	<-ctx.Done()
+	Shutdown(cfg, srv, consumers, sender, &background)
 }
 
-func InitServer(cfg *config.Config) {
+// InitServer starts serving the API in the background
+func InitServer(cfg *config.Config) *http.Server {
 	r := gin.New()
 
 	r.Use(middlewares.Cors(cfg))
 	RegisterRoutes(r, cfg)
 	RegisterSwagger(r, cfg)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", cfg.Server.InternalPort),
+		Handler: r,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Caller:%s Level:%s Msg:%s", constants.General, constants.Startup, err.Error())
+		}
+	}()
 	log.Printf("Caller:%s Level:%s Msg:%s", constants.General, constants.Startup, "Started")
-	r.Run(fmt.Sprintf(":%s", cfg.Server.InternalPort))
+	return srv
+}
+
+// Shutdown stops the API within one ShutdownTimeout for all its stages. The job
+// event streams are ended first, since the server does not wait for streaming
+// and hijacked connections, then the requests in flight finish and the
+// consumers finish their handlers. The background loops are waited for before
+// the message sender is closed, the database is closed by main once Shutdown
+// returns.
+func Shutdown(cfg *config.Config, srv *http.Server, consumers []*messaging.MessageConsumer, sender *messaging.MessageSender, background *sync.WaitGroup) {
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.General, constants.Startup, "Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
 
+	di.GetProcessingEvents(cfg).Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// Connections still open once the time is up are cut
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.General, constants.Startup, err.Error())
+		srv.Close()
+	}
+	for _, consumer := range consumers {
+		if err := consumer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.General, constants.Startup, "background tasks did not finish in time")
+	}
+	if err := sender.Close(); err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.General, constants.Startup, "Stopped")
+}
+
+// StartConsumers starts the result consumer, along with the embedded worker
+// when the in-memory broker is used
+func StartConsumers(ctx context.Context, cfg *config.Config, sender *messaging.MessageSender) ([]*messaging.MessageConsumer, error) {
+	consumer, err := StartResultConsumer(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	consumers := []*messaging.MessageConsumer{consumer}
+	if cfg.RabbitMQ.Driver == messaging.MemoryDriver {
+		worker, err := StartEmbeddedWorker(ctx, cfg, sender)
+		if err != nil {
+			return consumers, err
+		}
+		consumers = append(consumers, worker)
+	}
+	return consumers, nil
+}
+
+// StartResultConsumer persists the processing results published by the workers
+func StartResultConsumer(ctx context.Context, cfg *config.Config) (*messaging.MessageConsumer, error) {
+	uc := di.GetProcessingUsecase(cfg)
+
+	consumer, err := di.GetMessageConsumer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := consumer.Subscribe(messaging.ResultTopic, messaging.NewResultHandler(uc.HandleProcessingResult)); err != nil {
+		return nil, err
+	}
+	if err := consumer.Start(ctx); err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// StartEmbeddedWorker processes jobs inside the API process, which is the only
+// consumer that can reach the in-memory broker
+func StartEmbeddedWorker(ctx context.Context, cfg *config.Config, sender *messaging.MessageSender) (*messaging.MessageConsumer, error) {
+	worker := processor.NewWorker(cfg, processor.NewProcessor(cfg, di.GetImageRepository(cfg)), di.GetProcessingRepository(cfg), sender)
+
+	consumer, err := di.GetMessageConsumer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := consumer.Subscribe(messaging.ProcessingTopic, worker.HandleMessage); err != nil {
+		return nil, err
+	}
+	if err := consumer.Start(ctx); err != nil {
+		return nil, err
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Processor, constants.Startup, "Embedded worker started")
+	return consumer, nil
+}
+
+// StartOutboxRelay publishes the messages written to the outbox in the background
+func StartOutboxRelay(ctx context.Context, cfg *config.Config, sender *messaging.MessageSender, background *sync.WaitGroup) {
+	relay := messaging.NewOutboxRelay(cfg, di.GetOutboxRepository(cfg), sender)
+	runInBackground(background, func() { relay.Run(ctx) })
+}
+
+// StartWebhookDispatcher posts the queued webhook deliveries in the background
+func StartWebhookDispatcher(ctx context.Context, cfg *config.Config, background *sync.WaitGroup) {
+	uc := di.GetWebhookUsecase(cfg)
+	runInBackground(background, func() { uc.RunDispatcher(ctx) })
+}
+
+// StartEventListener receives the job events of every replica, so the clients
+// streaming a job get its events wherever they happen
+func StartEventListener(ctx context.Context, cfg *config.Config, background *sync.WaitGroup) {
+	runInBackground(background, func() { di.GetProcessingEvents(cfg).Listen(ctx) })
+}
+
+// StartJobReaper requeues or fails the jobs whose worker stopped reporting back
+func StartJobReaper(ctx context.Context, cfg *config.Config, background *sync.WaitGroup) {
+	uc := di.GetProcessingUsecase(cfg)
+	runInBackground(background, func() { uc.RunReaper(ctx) })
+}
+
+// StartJobScheduler queues the scheduled jobs once they are due
+func StartJobScheduler(ctx context.Context, cfg *config.Config, background *sync.WaitGroup) {
+	uc := di.GetProcessingUsecase(cfg)
+	runInBackground(background, func() { uc.RunScheduler(ctx) })
+}
+
+// StartIdempotencyPurge deletes the expired idempotency keys in the background
+func StartIdempotencyPurge(ctx context.Context, cfg *config.Config, background *sync.WaitGroup) {
+	repo := di.GetIdempotencyRepository(cfg)
+	runInBackground(background, func() {
+		ticker := time.NewTicker(cfg.Idempotency.PurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if count, err := repo.DeleteExpiredIdempotencyKeys(ctx); err == nil && count > 0 {
+					log.Printf("Caller:%s Level:%s Msg:%d expired idempotency keys deleted", constants.Postgres, constants.Delete, count)
+				}
+			}
+		}
+	})
+}
+
+// runInBackground runs fn in a goroutine that background waits for
+func runInBackground(background *sync.WaitGroup, fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
 }
 
 func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
@@ -64,9 +266,21 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
 
 		//Processing
 		processing := v1.Group("/processing")
-		processing.Use(middlewares.Authentication(cfg, tokenProvider))
+		processing.Use(middlewares.Authentication(cfg, tokenProvider,
+			processing.BasePath()+imageRouter.ProcessingEventsRoute,
+			processing.BasePath()+imageRouter.ProcessingWatchRoute))
 		imageRouter.Processing(processing, cfg)
 
+		//Presets
+		presets := v1.Group("/presets")
+		presets.Use(middlewares.Authentication(cfg, tokenProvider))
+		imageRouter.Preset(presets, cfg)
+
+		//Webhooks
+		webhooks := v1.Group("/webhooks")
+		webhooks.Use(middlewares.Authentication(cfg, tokenProvider))
+		imageRouter.Webhook(webhooks, cfg)
+
 	}
 }
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/di"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/messaging"
+	"github.com/alielmi98/image-processing-service/internal/processor"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func main() {
+	cfg := config.GetConfig()
+
+	err := db.InitDb(cfg)
+	defer db.CloseDb()
+	if err != nil {
+		log.Fatalf("caller:%s  Level:%s  Msg:%s", constants.Postgres, constants.Startup, err.Error())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	StartWorker(ctx, cfg)
+}
+
+func StartWorker(ctx context.Context, cfg *config.Config) {
+	// Without RabbitMQ the broker connects in the background, only an invalid setup fails here
+	messageSender, err := di.GetMessageSender(cfg)
+	if err != nil {
+		log.Fatalf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	defer messageSender.Close()
+	worker := processor.NewWorker(cfg, processor.NewProcessor(cfg, di.GetImageRepository(cfg)), di.GetProcessingRepository(cfg), messageSender)
+
+	consumer, err := di.GetMessageConsumer(cfg)
+	if err != nil {
+		log.Fatalf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+
+	if err := consumer.Subscribe(messaging.ProcessingTopic, worker.HandleMessage); err != nil {
+		log.Fatalf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	if err := consumer.Start(ctx); err != nil {
+		log.Fatalf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Processor, constants.Startup, "Started")
+
+	<-ctx.Done()
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Processor, constants.Startup, "Stopping")
+
+	// Jobs in progress get ShutdownTimeout to finish before they are requeued
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := consumer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Startup, err.Error())
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Processor, constants.Startup, "Stopped")
+}
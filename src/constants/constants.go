@@ -7,6 +7,7 @@ const (
 	DefaultUserName string = "admin"
 	// Claims
 	AuthorizationHeaderKey string = "Authorization"
+	AccessTokenQueryKey    string = "access_token"
 	UserIdKey              string = "UserId"
 	FirstNameKey           string = "FirstName"
 	LastNameKey            string = "LastName"
@@ -17,4 +18,8 @@ const (
 	RolesKey               string = "Roles"
 
 	RefreshTokenCookieName string = "refresh_token"
+
+	// Idempotency
+	IdempotencyKeyHeader     string = "Idempotency-Key"
+	IdempotentReplayedHeader string = "Idempotent-Replayed"
 )
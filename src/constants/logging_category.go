@@ -12,6 +12,8 @@ const (
 	Redis           Category = "Redis"
 	Validation      Category = "Validation"
 	RequestResponse Category = "RequestResponse"
+	RabbitMQ        Category = "RabbitMQ"
+	Processor       Category = "Processor"
 )
 
 const (
@@ -26,6 +28,7 @@ const (
 	Update              SubCategory = "Update"
 	Delete              SubCategory = "Delete"
 	Insert              SubCategory = "Insert"
+	Notify              SubCategory = "Notify"
 	DefaultRoleNotFound string      = "default role not found"
 
 	// Internal
@@ -38,6 +41,13 @@ const (
 
 	// IO
 	RemoveFile SubCategory = "RemoveFile"
+
+	// RabbitMQ
+	Consume SubCategory = "Consume"
+	Publish SubCategory = "Publish"
+
+	// Processor
+	Process SubCategory = "Process"
 )
 
 const (
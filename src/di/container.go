@@ -1,19 +1,28 @@
 package di
 
 import (
-	"log"
+	"sync"
 
 	contractAuth "github.com/alielmi98/image-processing-service/internal/auth/domain/auth"
 	contractAuthRepo "github.com/alielmi98/image-processing-service/internal/auth/domain/repository"
 	infraAuth "github.com/alielmi98/image-processing-service/internal/auth/infra/auth"
 	infraAuthRepo "github.com/alielmi98/image-processing-service/internal/auth/infra/repository"
+	contractIdempotencyRepo "github.com/alielmi98/image-processing-service/internal/idempotency/domain/repository"
+	infraIdempotencyRepo "github.com/alielmi98/image-processing-service/internal/idempotency/infra/repository"
 	contractImageRepo "github.com/alielmi98/image-processing-service/internal/image/domain/repository"
 	"github.com/alielmi98/image-processing-service/internal/image/infra/messaging"
 	infraImageRepo "github.com/alielmi98/image-processing-service/internal/image/infra/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/webhook"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
 	"github.com/alielmi98/image-processing-service/pkg/config"
 	"github.com/alielmi98/image-processing-service/pkg/db"
+	"github.com/alielmi98/image-processing-service/pkg/events"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
 )
 
+const processingEventsChannel = "processing_job_events"
+
 // midedlewares
 func GetTokenProvider(cfg *config.Config) contractAuth.TokenProvider {
 	return infraAuth.NewJwtProvider(cfg)
@@ -23,21 +32,105 @@ func GetUserRepository(cfg *config.Config) contractAuthRepo.UserRepository {
 	return infraAuthRepo.NewUserPgRepo()
 }
 
-func GetImageRepository(cfg *config.Config) contractImageRepo.ImageRepository {
-	var preloads []db.PreloadEntity = []db.PreloadEntity{{Entity: "ProcessingJobs"}}
+func GetIdempotencyRepository(cfg *config.Config) contractIdempotencyRepo.IdempotencyRepository {
+	return infraIdempotencyRepo.NewIdempotencyPgRepository()
+}
 
-	return infraImageRepo.NewImagePgRepository(cfg, preloads)
+func GetImageRepository(cfg *config.Config) contractImageRepo.ImageRepository {
+	return infraImageRepo.NewImagePgRepository(cfg, nil)
 }
 
 func GetProcessingRepository(cfg *config.Config) contractImageRepo.ProcessingRepository {
-	var preloads []db.PreloadEntity = []db.PreloadEntity{}
+	var preloads []db.PreloadEntity = []db.PreloadEntity{{Entity: "Image"}, {Entity: "Result"}}
 	return infraImageRepo.NewProcessingRepository(cfg, preloads)
 }
 
-func GetMessageSender(cfg *config.Config) *messaging.MessageSender {
-	messageSender, err := messaging.NewMessageSender(cfg)
-	if err != nil {
-		log.Fatalf("failed to create message sender: %v", err)
+func GetPresetRepository(cfg *config.Config) contractImageRepo.PresetRepository {
+	return infraImageRepo.NewPresetRepository(cfg, nil)
+}
+
+func GetOutboxRepository(cfg *config.Config) contractImageRepo.OutboxRepository {
+	return infraImageRepo.NewOutboxRepository()
+}
+
+func GetWebhookRepository(cfg *config.Config) contractImageRepo.WebhookRepository {
+	var preloads []db.PreloadEntity = []db.PreloadEntity{{Entity: "Attempts"}}
+	return infraImageRepo.NewWebhookRepository(cfg, preloads)
+}
+
+func GetWebhookSender(cfg *config.Config) *webhook.Sender {
+	return webhook.NewSender(cfg)
+}
+
+// usecases
+func GetWebhookUsecase(cfg *config.Config) *usecase.WebhookUsecase {
+	return usecase.NewWebhookUsecase(cfg, GetWebhookRepository(cfg), GetWebhookSender(cfg))
+}
+
+func GetPresetUsecase(cfg *config.Config) *usecase.PresetUsecase {
+	return usecase.NewPresetUsecase(cfg, GetPresetRepository(cfg))
+}
+
+var (
+	processingUsecase     *usecase.ProcessingUsecase
+	processingUsecaseOnce sync.Once
+)
+
+// GetProcessingUsecase returns the processing usecase shared by the handlers,
+// the result consumer and the background loops of the API
+func GetProcessingUsecase(cfg *config.Config) *usecase.ProcessingUsecase {
+	processingUsecaseOnce.Do(func() {
+		processingUsecase = usecase.NewProcessingUseCase(cfg, GetProcessingRepository(cfg), GetImageRepository(cfg), GetProcessingEvents(cfg), GetWebhookUsecase(cfg), GetPresetUsecase(cfg))
+	})
+	return processingUsecase
+}
+
+var (
+	processingEvents     *events.PostgresBus[dto.ProcessingJobEvent]
+	processingEventsOnce sync.Once
+)
+
+// GetProcessingEvents returns the bus that streams job events to the API
+// clients. Events reach the clients connected to any replica.
+func GetProcessingEvents(cfg *config.Config) *events.PostgresBus[dto.ProcessingJobEvent] {
+	processingEventsOnce.Do(func() {
+		processingEvents = events.NewPostgresBus[dto.ProcessingJobEvent](db.GetDb(), db.ConnectionString(cfg), processingEventsChannel)
+	})
+	return processingEvents
+}
+
+var (
+	memoryBroker     *rabbitmq.MemoryBroker
+	memoryBrokerOnce sync.Once
+)
+
+// GetBroker returns a new broker connection. The in-memory broker only routes
+// messages within itself, so it is shared by the whole process instead and
+// every caller gets a session of it.
+func GetBroker(cfg *config.Config) rabbitmq.RabbitMQ {
+	if cfg.RabbitMQ.Driver != messaging.MemoryDriver {
+		return messaging.NewBroker(cfg)
 	}
-	return messageSender
+	memoryBrokerOnce.Do(func() {
+		memoryBroker = messaging.NewMemoryBroker(cfg)
+	})
+	return memoryBroker.Session()
+}
+
+var (
+	messageSender     *messaging.MessageSender
+	messageSenderErr  error
+	messageSenderOnce sync.Once
+)
+
+// GetMessageSender returns the message sender shared by the whole process
+func GetMessageSender(cfg *config.Config) (*messaging.MessageSender, error) {
+	messageSenderOnce.Do(func() {
+		messageSender, messageSenderErr = messaging.NewMessageSender(cfg, GetBroker(cfg))
+	})
+	return messageSender, messageSenderErr
+}
+
+func GetMessageConsumer(cfg *config.Config) (*messaging.MessageConsumer, error) {
+	return messaging.NewMessageConsumer(cfg, GetBroker(cfg))
 }
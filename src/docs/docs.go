@@ -164,6 +164,12 @@ const docTemplate = `{
                         "name": "file",
                         "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the first response when the same upload is retried",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -190,124 +196,1674 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
                         }
+                    },
+                    "409": {
+                        "description": "Idempotency key reused or in progress",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/images/{id}/jobs": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "List the processing jobs created for an image, oldest first. Pass the id of the last job as after_id to get the next page.",
+                "tags": [
+                    "Images"
+                ],
+                "summary": "List the processing jobs of an image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only the jobs created after this one",
+                        "name": "after_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Jobs per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Processing jobs",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobResponse"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/presets": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "List the presets of the current user along with the global ones",
+                "tags": [
+                    "Presets"
+                ],
+                "summary": "List processing presets",
+                "responses": {
+                    "200": {
+                        "description": "Presets",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.PresetResponse"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Store named processing parameters that jobs can refer to by name. Global presets are available to every user and can only be created by admins.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Presets"
+                ],
+                "summary": "Create a processing preset",
+                "parameters": [
+                    {
+                        "description": "Preset",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.SavePresetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Preset",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.PresetResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_entity.FieldError"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Name already used",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/presets/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Get a preset of the current user or a global one",
+                "tags": [
+                    "Presets"
+                ],
+                "summary": "Get a processing preset",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Preset id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Preset",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.PresetResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Replace a preset of the current user, or a global one as an admin. Jobs created from the preset keep their parameters.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Presets"
+                ],
+                "summary": "Update a processing preset",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Preset id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Preset",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.SavePresetRequest"
+                        }
                     }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Preset",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.PresetResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_entity.FieldError"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Name already used",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Delete a preset of the current user, or a global one as an admin. Jobs created from the preset are not affected.",
+                "tags": [
+                    "Presets"
+                ],
+                "summary": "Delete a processing preset",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Preset id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deleted",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "List the latest processing jobs of the current user, e.g. the scheduled ones",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "List image processing jobs",
+                "parameters": [
+                    {
+                        "enum": [
+                            "scheduled",
+                            "pending",
+                            "processing",
+                            "completed",
+                            "failed",
+                            "cancelled"
+                        ],
+                        "type": "string",
+                        "description": "Only the jobs in this status",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Processing jobs",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobResponse"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Create an image processing job, queued right away or scheduled with run_at or delay_seconds",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Create an image processing job",
+                "parameters": [
+                    {
+                        "description": "Processing request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.CreateProcessImageRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the first response when the same request is retried",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Processing response",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessImageResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_entity.FieldError"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Image not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Idempotency key reused or in progress",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing/batch": {
+            "post": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Apply the same processing to many images, selected by id or by a filter. Images that cannot be processed are reported as rejected.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Create a batch of image processing jobs",
+                "parameters": [
+                    {
+                        "description": "Batch request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.CreateProcessingBatchRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the first response when the same request is retried",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Processing batch",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_entity.FieldError"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Idempotency key reused or in progress",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing/batch/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Get the progress of a batch along with its failed jobs",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Get a batch of image processing jobs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Batch id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Processing batch",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Cancel every job of a batch that has not finished yet",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Cancel a batch of image processing jobs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Batch id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cancelled batch",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Batch already finished",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Get the status, timings and result metadata of a processing job",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Get an image processing job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Job id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Processing job",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Cancel a scheduled, pending or running processing job",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Cancel an image processing job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Job id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cancelled processing job",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Job already finished",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing/{id}/events": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Push the state transitions and pipeline progress of a job as Server-Sent Events named \"job\".\nThe first event is the current state and the stream ends once the job has finished.\nEventSource clients may pass the token in the access_token query parameter.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Stream the events of an image processing job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Job id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of job events",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing/{id}/result": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Stream the file produced by a completed processing job",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Download the result of an image processing job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Job id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Processed image",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Result not ready",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/processing/{id}/ws": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Upgrade to a WebSocket that receives the state transitions and pipeline progress of a job as JSON messages.\nThe first message is the current state and the server closes the socket once the job has finished.\nBrowser clients may pass the token in the access_token query parameter.",
+                "tags": [
+                    "Processing"
+                ],
+                "summary": "Watch the events of an image processing job over WebSocket",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Job id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Job events",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobEvent"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/webhooks/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "List the latest webhook deliveries of the current user along with their attempts",
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Only the deliveries of this job",
+                        "name": "job_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook deliveries",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookDeliveryResponse"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/webhooks/deliveries/{id}/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Send a past delivery again with the same delivery id",
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Redeliver a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Delivery id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Scheduled delivery",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookDeliveryResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/webhooks/settings": {
+            "get": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Get the default callback URL of new jobs and the secret deliveries are signed with.\nEvery delivery carries the X-Webhook-Signature header \"sha256=\u003chex\u003e\", the HMAC-SHA256 of \"\u003cX-Webhook-Timestamp\u003e.\u003cbody\u003e\" keyed with the secret.",
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Get the webhook settings",
+                "responses": {
+                    "200": {
+                        "description": "Webhook settings",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookSettingResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AuthBearer": []
+                    }
+                ],
+                "description": "Set the default callback URL of new jobs and optionally rotate the signing secret",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Update the webhook settings",
+                "parameters": [
+                    {
+                        "description": "Webhook settings",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.SaveWebhookSettingRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook settings",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookSettingResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid callback URL, e.g. one in a private network",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_entity.FieldError"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "github_com_alielmi98_image-processing-service_internal_auth_api_dto.LoginByUsernameRequest": {
+            "type": "object",
+            "required": [
+                "password",
+                "username"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "minLength": 6
+                },
+                "username": {
+                    "type": "string",
+                    "minLength": 5
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_auth_api_dto.RegisterUserByUsernameRequest": {
+            "type": "object",
+            "required": [
+                "firstName",
+                "lastName",
+                "password",
+                "username"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "minLength": 6
+                },
+                "firstName": {
+                    "type": "string",
+                    "minLength": 3
+                },
+                "lastName": {
+                    "type": "string",
+                    "minLength": 6
+                },
+                "password": {
+                    "type": "string",
+                    "minLength": 6
+                },
+                "username": {
+                    "type": "string",
+                    "minLength": 5
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.CreateProcessImageRequest": {
+            "type": "object",
+            "required": [
+                "image_id"
+            ],
+            "properties": {
+                "callback_url": {
+                    "description": "Defaults to the callback URL of the webhook settings",
+                    "type": "string"
+                },
+                "delay_seconds": {
+                    "description": "Queues the job after this delay, instead of run_at",
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "image_id": {
+                    "type": "integer"
+                },
+                "parameters": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "preset": {
+                    "description": "Name of a preset, parameters then override its parameters",
+                    "type": "string"
+                },
+                "priority": {
+                    "description": "1-10, higher is processed first",
+                    "type": "integer",
+                    "maximum": 10,
+                    "minimum": 1
+                },
+                "processing_type": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ProcessingType"
+                },
+                "run_at": {
+                    "description": "Queues the job at this time instead of right away",
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.CreateProcessingBatchRequest": {
+            "type": "object",
+            "properties": {
+                "callback_url": {
+                    "type": "string"
+                },
+                "delay_seconds": {
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "filter": {
+                    "description": "Selects the images of the current user instead of image_ids",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ImageFilterRequest"
+                        }
+                    ]
+                },
+                "image_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "parameters": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "preset": {
+                    "type": "string"
+                },
+                "priority": {
+                    "type": "integer",
+                    "maximum": 10,
+                    "minimum": 1
+                },
+                "processing_type": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ProcessingType"
+                },
+                "run_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ImageFilterRequest": {
+            "type": "object",
+            "properties": {
+                "created_after": {
+                    "type": "string"
+                },
+                "created_before": {
+                    "type": "string"
+                },
+                "mime_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ImageResponse": {
+            "type": "object",
+            "properties": {
+                "file-name": {
+                    "type": "string"
+                },
+                "file-path": {
+                    "type": "string"
+                },
+                "file-size": {
+                    "type": "integer"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "mime-type": {
+                    "type": "string"
+                },
+                "original-name": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.PresetResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "global": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "modified_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "parameters": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "processing_type": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ProcessingType"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessImageResponse": {
+            "type": "object",
+            "properties": {
+                "job_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchFailure": {
+            "type": "object",
+            "properties": {
+                "error_message": {
+                    "type": "string"
+                },
+                "image_id": {
+                    "type": "integer"
+                },
+                "job_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchRejection": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "image_id": {
+                    "type": "integer"
                 }
             }
         },
-        "/v1/processing": {
-            "post": {
-                "security": [
-                    {
-                        "AuthBearer": []
-                    }
-                ],
-                "description": "Create an image processing job",
-                "consumes": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Processing"
-                ],
-                "summary": "Create an image processing job",
-                "parameters": [
-                    {
-                        "description": "Processing request",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.CreateProcessImageRequest"
-                        }
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchResponse": {
+            "type": "object",
+            "properties": {
+                "cancelled": {
+                    "type": "integer"
+                },
+                "completed": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "failures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchFailure"
                     }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Processing response",
-                        "schema": {
-                            "allOf": [
-                                {
-                                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
-                                },
-                                {
-                                    "type": "object",
-                                    "properties": {
-                                        "result": {
-                                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessImageResponse"
-                                        }
-                                    }
-                                }
-                            ]
-                        }
-                    },
-                    "400": {
-                        "description": "Bad request",
-                        "schema": {
-                            "$ref": "#/definitions/github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse"
-                        }
+                },
+                "finished": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "parameters": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "pending": {
+                    "type": "integer"
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "processing": {
+                    "type": "integer"
+                },
+                "processing_type": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ProcessingType"
+                },
+                "progress": {
+                    "description": "Percent of the jobs that finished, 0-100",
+                    "type": "integer"
+                },
+                "rejected": {
+                    "description": "Images no job was created for",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingBatchRejection"
                     }
+                },
+                "scheduled": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
                 }
             }
-        }
-    },
-    "definitions": {
-        "github_com_alielmi98_image-processing-service_internal_auth_api_dto.LoginByUsernameRequest": {
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobEvent": {
             "type": "object",
-            "required": [
-                "password",
-                "username"
-            ],
             "properties": {
-                "password": {
-                    "type": "string",
-                    "minLength": 6
+                "error_message": {
+                    "type": "string"
                 },
-                "username": {
-                    "type": "string",
-                    "minLength": 5
+                "job_id": {
+                    "type": "integer"
+                },
+                "progress": {
+                    "description": "Percent done, 0-100",
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ImageStatus"
+                },
+                "timestamp": {
+                    "type": "string"
                 }
             }
         },
-        "github_com_alielmi98_image-processing-service_internal_auth_api_dto.RegisterUserByUsernameRequest": {
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingJobResponse": {
             "type": "object",
-            "required": [
-                "firstName",
-                "lastName",
-                "password",
-                "username"
-            ],
             "properties": {
-                "email": {
-                    "type": "string",
-                    "minLength": 6
+                "batch_id": {
+                    "type": "integer"
                 },
-                "firstName": {
-                    "type": "string",
-                    "minLength": 3
+                "callback_url": {
+                    "type": "string"
                 },
-                "lastName": {
-                    "type": "string",
-                    "minLength": 6
+                "completed_at": {
+                    "type": "string"
                 },
-                "password": {
-                    "type": "string",
-                    "minLength": 6
+                "created_at": {
+                    "type": "string"
                 },
-                "username": {
-                    "type": "string",
-                    "minLength": 5
+                "duration": {
+                    "description": "Duration in milliseconds",
+                    "type": "integer"
+                },
+                "error_message": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "image_id": {
+                    "type": "integer"
+                },
+                "parameters": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "processing_type": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ProcessingType"
+                },
+                "result": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingResultResponse"
+                },
+                "retry_count": {
+                    "type": "integer"
+                },
+                "run_at": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ImageStatus"
                 }
             }
         },
-        "github_com_alielmi98_image-processing-service_internal_image_api_dto.CreateProcessImageRequest": {
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessingResultResponse": {
+            "type": "object",
+            "properties": {
+                "file_size": {
+                    "type": "integer"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "mime_type": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.SavePresetRequest": {
             "type": "object",
             "required": [
-                "image_id",
+                "name",
                 "parameters",
                 "processing_type"
             ],
             "properties": {
-                "image_id": {
-                    "type": "integer"
+                "description": {
+                    "type": "string"
+                },
+                "global": {
+                    "description": "Available to every user, admins only. Fixed once the preset is created.",
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "parameters": {
                     "type": "object",
@@ -318,43 +1874,119 @@ const docTemplate = `{
                 }
             }
         },
-        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ImageResponse": {
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.SaveWebhookSettingRequest": {
             "type": "object",
             "properties": {
-                "file-name": {
+                "callback_url": {
+                    "description": "Default callback URL of new jobs, empty to remove it",
                     "type": "string"
                 },
-                "file-path": {
+                "rotate_secret": {
+                    "description": "Replace the signing secret",
+                    "type": "boolean"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookDeliveryAttemptResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
                     "type": "string"
                 },
-                "file-size": {
+                "duration": {
+                    "description": "Duration in milliseconds",
                     "type": "integer"
                 },
-                "height": {
-                    "type": "integer"
+                "error": {
+                    "type": "string"
                 },
-                "id": {
+                "status_code": {
+                    "description": "Missing when no response was received",
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookDeliveryResponse": {
+            "type": "object",
+            "properties": {
+                "attempt_count": {
                     "type": "integer"
                 },
-                "mime-type": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookDeliveryAttemptResponse"
+                    }
+                },
+                "created_at": {
                     "type": "string"
                 },
-                "original-name": {
+                "delivered_at": {
                     "type": "string"
                 },
-                "width": {
+                "delivery_id": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.ImageStatus"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "job_id": {
                     "type": "integer"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
+                    "$ref": "#/definitions/github_com_alielmi98_image-processing-service_internal_image_domain_models.WebhookDeliveryStatus"
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         },
-        "github_com_alielmi98_image-processing-service_internal_image_api_dto.ProcessImageResponse": {
+        "github_com_alielmi98_image-processing-service_internal_image_api_dto.WebhookSettingResponse": {
             "type": "object",
             "properties": {
-                "job_id": {
-                    "type": "integer"
+                "callback_url": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "modified_at": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Key of the HMAC-SHA256 signature of every delivery",
+                    "type": "string"
                 }
             }
         },
+        "github_com_alielmi98_image-processing-service_internal_image_domain_models.ImageStatus": {
+            "type": "string",
+            "enum": [
+                "scheduled",
+                "pending",
+                "processing",
+                "completed",
+                "failed",
+                "cancelled"
+            ],
+            "x-enum-varnames": [
+                "ImageStatusScheduled",
+                "ImageStatusPending",
+                "ImageStatusProcessing",
+                "ImageStatusCompleted",
+                "ImageStatusFailed",
+                "ImageStatusCancelled"
+            ]
+        },
         "github_com_alielmi98_image-processing-service_internal_image_domain_models.ProcessingType": {
             "type": "string",
             "enum": [
@@ -364,7 +1996,8 @@ const docTemplate = `{
                 "filter",
                 "watermark",
                 "compress",
-                "format"
+                "format",
+                "pipeline"
             ],
             "x-enum-varnames": [
                 "ProcessingTypeResize",
@@ -373,9 +2006,34 @@ const docTemplate = `{
                 "ProcessingTypeFilter",
                 "ProcessingTypeWatermark",
                 "ProcessingTypeCompress",
-                "ProcessingTypeFormat"
+                "ProcessingTypeFormat",
+                "ProcessingTypePipeline"
+            ]
+        },
+        "github_com_alielmi98_image-processing-service_internal_image_domain_models.WebhookDeliveryStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "succeeded",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "WebhookDeliveryPending",
+                "WebhookDeliverySucceeded",
+                "WebhookDeliveryFailed"
             ]
         },
+        "github_com_alielmi98_image-processing-service_internal_image_entity.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
         "github_com_alielmi98_image-processing-service_pkg_helper.BaseHttpResponse": {
             "type": "object",
             "properties": {
@@ -397,6 +2055,7 @@ const docTemplate = `{
                 40101,
                 40301,
                 40401,
+                40901,
                 42901,
                 42902,
                 50001,
@@ -412,6 +2071,7 @@ const docTemplate = `{
                 "AuthError",
                 "ForbiddenError",
                 "NotFoundError",
+                "ConflictError",
                 "LimiterError",
                 "OtpLimiterError",
                 "CustomRecovery",
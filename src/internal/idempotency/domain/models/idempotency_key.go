@@ -0,0 +1,22 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdempotencyKey remembers the response of a request sent with an
+// Idempotency-Key header, so a retry of it is answered without running it again
+type IdempotencyKey struct {
+	Id           int           `gorm:"primarykey"`
+	UserId       int           `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key          string        `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	RequestHash  string        `gorm:"type:varchar(64);not null"` // SHA-256 of the method, path and body or its parts
+	StatusCode   sql.NullInt64 `gorm:"null"`                      // Not set while the first request is running
+	ContentType  string        `gorm:"type:varchar(255);not null;default:''"`
+	ResponseBody []byte        `gorm:"type:bytea"`
+	ExpiresAt    time.Time     `gorm:"type:TIMESTAMP with time zone;not null;index"` // End of the lease while the first request is running
+
+	CreatedAt  time.Time    `gorm:"type:TIMESTAMP with time zone;not null"`
+	ModifiedAt sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+}
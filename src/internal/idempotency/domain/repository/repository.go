@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/idempotency/domain/models"
+)
+
+// IdempotencyRepository defines the contract for idempotency key storage
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores a new key, taking over an expired one with
+	// the same user and key. It returns the stored key and false instead when
+	// an unexpired key already exists.
+	ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) (models.IdempotencyKey, bool, error)
+	// CompleteIdempotencyKey stores the response of the request and keeps it
+	// until expiresAt
+	CompleteIdempotencyKey(ctx context.Context, id int, statusCode int, contentType string, body []byte, expiresAt time.Time) error
+	DeleteIdempotencyKey(ctx context.Context, id int) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/idempotency/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/idempotency/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyPgRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyPgRepository() repository.IdempotencyRepository {
+	return &IdempotencyPgRepository{db: db.GetDb()}
+}
+
+func (r *IdempotencyPgRepository) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	now := time.Now().UTC()
+	key.CreatedAt = now
+	// Only an expired key is overwritten, an unexpired one leaves the insert without effect
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "key"}},
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Lt{Column: clause.Column{Table: "idempotency_keys", Name: "expires_at"}, Value: now},
+			}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"request_hash", "status_code", "content_type", "response_body", "expires_at", "created_at", "modified_at",
+			}),
+		}).
+		Create(&key)
+	if result.Error != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, result.Error.Error())
+		return key, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return key, true, nil
+	}
+
+	var existing models.IdempotencyKey
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? and key = ?", key.UserId, key.Key).
+		First(&existing).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+		return existing, false, err
+	}
+	return existing, false, nil
+}
+
+func (r *IdempotencyPgRepository) CompleteIdempotencyKey(ctx context.Context, id int, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&models.IdempotencyKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status_code":   sql.NullInt64{Int64: int64(statusCode), Valid: true},
+			"content_type":  contentType,
+			"response_body": body,
+			"expires_at":    expiresAt,
+			"modified_at":   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		}).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+	}
+	return err
+}
+
+func (r *IdempotencyPgRepository) DeleteIdempotencyKey(ctx context.Context, id int) error {
+	err := r.db.WithContext(ctx).
+		Where("id = ?", id).
+		Delete(&models.IdempotencyKey{}).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Delete, err.Error())
+	}
+	return err
+}
+
+func (r *IdempotencyPgRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at < ?", time.Now().UTC()).
+		Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Delete, result.Error.Error())
+	}
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,58 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	usecaseDto "github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+)
+
+type SavePresetRequest struct {
+	Name           string                 `json:"name" binding:"required,max=100"`
+	Description    string                 `json:"description"`
+	ProcessingType models.ProcessingType  `json:"processing_type" binding:"required"`
+	Parameters     map[string]interface{} `json:"parameters" binding:"required"`
+	Global         bool                   `json:"global"` // Available to every user, admins only. Fixed once the preset is created.
+}
+
+type PresetResponse struct {
+	Id             int                    `json:"id"`
+	Name           string                 `json:"name"`
+	Description    string                 `json:"description,omitempty"`
+	ProcessingType models.ProcessingType  `json:"processing_type"`
+	Parameters     map[string]interface{} `json:"parameters"`
+	Global         bool                   `json:"global"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ModifiedAt     *time.Time             `json:"modified_at,omitempty"`
+}
+
+func ToSavePreset(from SavePresetRequest) usecaseDto.SavePreset {
+	return usecaseDto.SavePreset{
+		Name:           from.Name,
+		Description:    from.Description,
+		ProcessingType: from.ProcessingType,
+		Parameters:     from.Parameters,
+		Global:         from.Global,
+	}
+}
+
+func ToPresetResponse(from usecaseDto.PresetResponse) PresetResponse {
+	return PresetResponse{
+		Id:             from.Id,
+		Name:           from.Name,
+		Description:    from.Description,
+		ProcessingType: from.ProcessingType,
+		Parameters:     from.Parameters,
+		Global:         from.Global,
+		CreatedAt:      from.CreatedAt,
+		ModifiedAt:     from.ModifiedAt,
+	}
+}
+
+func ToPresetResponses(from []usecaseDto.PresetResponse) []PresetResponse {
+	response := make([]PresetResponse, 0, len(from))
+	for _, preset := range from {
+		response = append(response, ToPresetResponse(preset))
+	}
+	return response
+}
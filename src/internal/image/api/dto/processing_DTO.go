@@ -1,25 +1,63 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
 	usecaseDto "github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
 )
 
 type CreateProcessImageRequest struct {
 	ImageId        int                    `json:"image_id" binding:"required"`
-	ProcessingType models.ProcessingType  `json:"processing_type" binding:"required"`
-	Parameters     map[string]interface{} `json:"parameters" binding:"required"`
+	Preset         string                 `json:"preset"` // Name of a preset, parameters then override its parameters
+	ProcessingType models.ProcessingType  `json:"processing_type" binding:"required_without=Preset"`
+	Parameters     map[string]interface{} `json:"parameters" binding:"required_without=Preset"`
+	Priority       int                    `json:"priority" binding:"omitempty,min=1,max=10"`                   // 1-10, higher is processed first
+	CallbackUrl    string                 `json:"callback_url" binding:"omitempty,http_url"`                   // Defaults to the callback URL of the webhook settings
+	RunAt          *time.Time             `json:"run_at"`                                                      // Queues the job at this time instead of right away
+	DelaySeconds   int                    `json:"delay_seconds" binding:"omitempty,min=1,excluded_with=RunAt"` // Queues the job after this delay, instead of run_at
 }
 
 type ProcessImageResponse struct {
 	JobId int `json:"job_id,omitempty"`
 }
 
+type ProcessingJobResponse struct {
+	Id             int                       `json:"id"`
+	ImageId        int                       `json:"image_id"`
+	ProcessingType models.ProcessingType     `json:"processing_type"`
+	Parameters     map[string]interface{}    `json:"parameters"`
+	Status         models.ImageStatus        `json:"status"`
+	Priority       int                       `json:"priority"`
+	ErrorMessage   string                    `json:"error_message,omitempty"`
+	BatchId        int                       `json:"batch_id,omitempty"`
+	RunAt          *time.Time                `json:"run_at,omitempty"`
+	StartedAt      *time.Time                `json:"started_at,omitempty"`
+	CompletedAt    *time.Time                `json:"completed_at,omitempty"`
+	Duration       int64                     `json:"duration"` // Duration in milliseconds
+	RetryCount     int                       `json:"retry_count"`
+	CallbackUrl    string                    `json:"callback_url,omitempty"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	Result         *ProcessingResultResponse `json:"result,omitempty"`
+}
+
+type ProcessingResultResponse struct {
+	FileSize int64  `json:"file_size"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MimeType string `json:"mime_type"`
+}
+
 func ToCreateProcessImageRequest(from CreateProcessImageRequest) usecaseDto.ProcessingRequest {
 	return usecaseDto.ProcessingRequest{
 		ImageId:        from.ImageId,
 		ProcessingType: from.ProcessingType,
 		Parameters:     from.Parameters,
+		Priority:       from.Priority,
+		CallbackUrl:    from.CallbackUrl,
+		Preset:         from.Preset,
+		RunAt:          from.RunAt,
+		Delay:          time.Duration(from.DelaySeconds) * time.Second,
 	}
 }
 
@@ -28,3 +66,161 @@ func ToProcessImageResponse(from usecaseDto.ProcessingResponse) ProcessImageResp
 		JobId: from.JobId,
 	}
 }
+
+func ToProcessingJobResponse(from usecaseDto.ProcessingJobResponse) ProcessingJobResponse {
+	response := ProcessingJobResponse{
+		Id:             from.Id,
+		ImageId:        from.ImageId,
+		ProcessingType: from.ProcessingType,
+		Parameters:     from.Parameters,
+		Status:         from.Status,
+		Priority:       from.Priority,
+		ErrorMessage:   from.ErrorMessage,
+		BatchId:        from.BatchId,
+		RunAt:          from.RunAt,
+		StartedAt:      from.StartedAt,
+		CompletedAt:    from.CompletedAt,
+		Duration:       from.Duration,
+		RetryCount:     from.RetryCount,
+		CallbackUrl:    from.CallbackUrl,
+		CreatedAt:      from.CreatedAt,
+	}
+	if from.Result != nil {
+		response.Result = &ProcessingResultResponse{
+			FileSize: from.Result.FileSize,
+			Width:    from.Result.Width,
+			Height:   from.Result.Height,
+			MimeType: from.Result.MimeType,
+		}
+	}
+	return response
+}
+
+func ToProcessingJobResponses(from []usecaseDto.ProcessingJobResponse) []ProcessingJobResponse {
+	response := make([]ProcessingJobResponse, 0, len(from))
+	for _, job := range from {
+		response = append(response, ToProcessingJobResponse(job))
+	}
+	return response
+}
+
+type CreateProcessingBatchRequest struct {
+	ImageIds       []int                  `json:"image_ids" binding:"required_without=Filter,excluded_with=Filter,dive,min=1"`
+	Filter         *ImageFilterRequest    `json:"filter"` // Selects the images of the current user instead of image_ids
+	Preset         string                 `json:"preset"`
+	ProcessingType models.ProcessingType  `json:"processing_type" binding:"required_without=Preset"`
+	Parameters     map[string]interface{} `json:"parameters" binding:"required_without=Preset"`
+	Priority       int                    `json:"priority" binding:"omitempty,min=1,max=10"`
+	CallbackUrl    string                 `json:"callback_url" binding:"omitempty,http_url"`
+	RunAt          *time.Time             `json:"run_at"`
+	DelaySeconds   int                    `json:"delay_seconds" binding:"omitempty,min=1,excluded_with=RunAt"`
+}
+
+type ImageFilterRequest struct {
+	MimeType      string     `json:"mime_type"`
+	CreatedAfter  *time.Time `json:"created_after"`
+	CreatedBefore *time.Time `json:"created_before"`
+}
+
+type ProcessingBatchResponse struct {
+	Id             int                        `json:"id"`
+	ProcessingType models.ProcessingType      `json:"processing_type"`
+	Parameters     map[string]interface{}     `json:"parameters"`
+	Priority       int                        `json:"priority"`
+	Total          int                        `json:"total"`
+	Scheduled      int                        `json:"scheduled"`
+	Pending        int                        `json:"pending"`
+	Processing     int                        `json:"processing"`
+	Completed      int                        `json:"completed"`
+	Failed         int                        `json:"failed"`
+	Cancelled      int                        `json:"cancelled"`
+	Progress       int                        `json:"progress"` // Percent of the jobs that finished, 0-100
+	Finished       bool                       `json:"finished"`
+	CreatedAt      time.Time                  `json:"created_at"`
+	Rejected       []ProcessingBatchRejection `json:"rejected,omitempty"` // Images no job was created for
+	Failures       []ProcessingBatchFailure   `json:"failures"`
+}
+
+type ProcessingBatchRejection struct {
+	ImageId int    `json:"image_id"`
+	Error   string `json:"error"`
+}
+
+type ProcessingBatchFailure struct {
+	JobId        int    `json:"job_id"`
+	ImageId      int    `json:"image_id"`
+	ErrorMessage string `json:"error_message"`
+}
+
+func ToProcessingBatchRequest(from CreateProcessingBatchRequest) usecaseDto.ProcessingBatchRequest {
+	request := usecaseDto.ProcessingBatchRequest{
+		ImageIds:       from.ImageIds,
+		ProcessingType: from.ProcessingType,
+		Parameters:     from.Parameters,
+		Priority:       from.Priority,
+		CallbackUrl:    from.CallbackUrl,
+		Preset:         from.Preset,
+		RunAt:          from.RunAt,
+		Delay:          time.Duration(from.DelaySeconds) * time.Second,
+	}
+	if from.Filter != nil {
+		request.Filter = &usecaseDto.ImageFilter{
+			MimeType:      from.Filter.MimeType,
+			CreatedAfter:  from.Filter.CreatedAfter,
+			CreatedBefore: from.Filter.CreatedBefore,
+		}
+	}
+	return request
+}
+
+func ToProcessingBatchResponse(from usecaseDto.ProcessingBatchResponse) ProcessingBatchResponse {
+	response := ProcessingBatchResponse{
+		Id:             from.Id,
+		ProcessingType: from.ProcessingType,
+		Parameters:     from.Parameters,
+		Priority:       from.Priority,
+		Total:          from.Total,
+		Scheduled:      from.Scheduled,
+		Pending:        from.Pending,
+		Processing:     from.Processing,
+		Completed:      from.Completed,
+		Failed:         from.Failed,
+		Cancelled:      from.Cancelled,
+		Progress:       from.Progress,
+		Finished:       from.Finished,
+		CreatedAt:      from.CreatedAt,
+		Failures:       make([]ProcessingBatchFailure, 0, len(from.Failures)),
+	}
+	for _, rejection := range from.Rejected {
+		response.Rejected = append(response.Rejected, ProcessingBatchRejection{
+			ImageId: rejection.ImageId,
+			Error:   rejection.Error,
+		})
+	}
+	for _, failure := range from.Failures {
+		response.Failures = append(response.Failures, ProcessingBatchFailure{
+			JobId:        failure.JobId,
+			ImageId:      failure.ImageId,
+			ErrorMessage: failure.ErrorMessage,
+		})
+	}
+	return response
+}
+
+type ProcessingJobEvent struct {
+	JobId        int                `json:"job_id"`
+	Status       models.ImageStatus `json:"status"`
+	Progress     int                `json:"progress"` // Percent done, 0-100
+	ErrorMessage string             `json:"error_message,omitempty"`
+	Timestamp    time.Time          `json:"timestamp"`
+}
+
+func ToProcessingJobEvent(from usecaseDto.ProcessingJobEvent) ProcessingJobEvent {
+	return ProcessingJobEvent{
+		JobId:        from.JobId,
+		Status:       from.Status,
+		Progress:     from.Progress,
+		ErrorMessage: from.ErrorMessage,
+		Timestamp:    from.Timestamp,
+	}
+}
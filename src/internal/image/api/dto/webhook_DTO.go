@@ -0,0 +1,93 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	usecaseDto "github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+)
+
+type SaveWebhookSettingRequest struct {
+	CallbackUrl  string `json:"callback_url" binding:"omitempty,http_url"` // Default callback URL of new jobs, empty to remove it
+	RotateSecret bool   `json:"rotate_secret"`                             // Replace the signing secret
+}
+
+type WebhookSettingResponse struct {
+	CallbackUrl string     `json:"callback_url,omitempty"`
+	Secret      string     `json:"secret"` // Key of the HMAC-SHA256 signature of every delivery
+	CreatedAt   time.Time  `json:"created_at"`
+	ModifiedAt  *time.Time `json:"modified_at,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	Id            int                              `json:"id"`
+	DeliveryId    string                           `json:"delivery_id"`
+	JobId         int                              `json:"job_id"`
+	Event         models.ImageStatus               `json:"event"`
+	Url           string                           `json:"url"`
+	Payload       json.RawMessage                  `json:"payload" swaggertype:"object"`
+	Status        models.WebhookDeliveryStatus     `json:"status"`
+	AttemptCount  int                              `json:"attempt_count"`
+	NextAttemptAt *time.Time                       `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time                       `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time                        `json:"created_at"`
+	Attempts      []WebhookDeliveryAttemptResponse `json:"attempts"`
+}
+
+type WebhookDeliveryAttemptResponse struct {
+	StatusCode int       `json:"status_code,omitempty"` // Missing when no response was received
+	Error      string    `json:"error,omitempty"`
+	Duration   int64     `json:"duration"` // Duration in milliseconds
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func ToSaveWebhookSetting(from SaveWebhookSettingRequest) usecaseDto.SaveWebhookSetting {
+	return usecaseDto.SaveWebhookSetting{
+		CallbackUrl:  from.CallbackUrl,
+		RotateSecret: from.RotateSecret,
+	}
+}
+
+func ToWebhookSettingResponse(from usecaseDto.WebhookSettingResponse) WebhookSettingResponse {
+	return WebhookSettingResponse{
+		CallbackUrl: from.CallbackUrl,
+		Secret:      from.Secret,
+		CreatedAt:   from.CreatedAt,
+		ModifiedAt:  from.ModifiedAt,
+	}
+}
+
+func ToWebhookDeliveryResponse(from usecaseDto.WebhookDeliveryResponse) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		Id:            from.Id,
+		DeliveryId:    from.DeliveryId,
+		JobId:         from.JobId,
+		Event:         from.Event,
+		Url:           from.Url,
+		Payload:       json.RawMessage(from.Payload),
+		Status:        from.Status,
+		AttemptCount:  from.AttemptCount,
+		NextAttemptAt: from.NextAttemptAt,
+		DeliveredAt:   from.DeliveredAt,
+		CreatedAt:     from.CreatedAt,
+		Attempts:      make([]WebhookDeliveryAttemptResponse, 0, len(from.Attempts)),
+	}
+	for _, attempt := range from.Attempts {
+		response.Attempts = append(response.Attempts, WebhookDeliveryAttemptResponse{
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			Duration:   attempt.Duration,
+			CreatedAt:  attempt.CreatedAt,
+		})
+	}
+	return response
+}
+
+func ToWebhookDeliveryResponses(from []usecaseDto.WebhookDeliveryResponse) []WebhookDeliveryResponse {
+	response := make([]WebhookDeliveryResponse, 0, len(from))
+	for _, delivery := range from {
+		response = append(response, ToWebhookDeliveryResponse(delivery))
+	}
+	return response
+}
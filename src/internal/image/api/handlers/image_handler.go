@@ -2,18 +2,19 @@ package handlers
 
 import (
 	"fmt"
-	"image"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/alielmi98/image-processing-service/di"
 	"github.com/alielmi98/image-processing-service/internal/image/api/dto"
 	"github.com/alielmi98/image-processing-service/internal/image/usecase"
+	"github.com/alielmi98/image-processing-service/internal/processor"
 	"github.com/alielmi98/image-processing-service/pkg/config"
 	"github.com/alielmi98/image-processing-service/pkg/helper"
 	"github.com/gin-gonic/gin"
@@ -37,8 +38,10 @@ func NewImageHandler(cfg *config.Config) *ImageHandler {
 // @Accept multipart/form-data
 // @produces json
 // @Param file formData file true "Image file to upload"
+// @Param Idempotency-Key header string false "Replays the first response when the same upload is retried"
 // @Success 201 {object} helper.BaseHttpResponse{result=dto.ImageResponse} "Image response"
 // @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 409 {object} helper.BaseHttpResponse "Idempotency key reused or in progress"
 // @Router /v1/images/ [post]
 // @Security AuthBearer
 func (h *ImageHandler) Create(c *gin.Context) {
@@ -76,6 +79,59 @@ func (h *ImageHandler) Create(c *gin.Context) {
 
 }
 
+// GetJobs godoc
+// @Summary List the processing jobs of an image
+// @Description List the processing jobs created for an image, oldest first. Pass the id of the last job as after_id to get the next page.
+// @Tags Images
+// @produces json
+// @Param id path int true "Image id"
+// @Param after_id query int false "Only the jobs created after this one"
+// @Param limit query int false "Jobs per page, at most 100"
+// @Success 200 {object} helper.BaseHttpResponse{result=[]dto.ProcessingJobResponse} "Processing jobs"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/images/{id}/jobs [get]
+// @Security AuthBearer
+func (h *ImageHandler) GetJobs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	afterId, err := queryInt(c, "after_id")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.GetImageJobs(c, id, afterId, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToProcessingJobResponses(res), true, helper.Success))
+}
+
+// queryInt returns an integer query parameter, zero when it is omitted
+func queryInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
 func saveUploadedFile(file *multipart.FileHeader, directory string) (fileName, originalName string, err error) {
 	allowedExtensions := map[string]bool{
 		"jpg":  true,
@@ -125,10 +181,6 @@ func extractImageMetadata(fileHeader *multipart.FileHeader) (width, height int,
 	}
 	defer file.Close()
 
-	file.Seek(0, 0) // Reset pointer
-	config, _, err := image.DecodeConfig(file)
-	if err != nil {
-		return 0, 0, err
-	}
-	return config.Width, config.Height, nil
+	// Parameters are checked against the size the worker sees, after it applied the EXIF orientation
+	return processor.ImageSize(file)
 }
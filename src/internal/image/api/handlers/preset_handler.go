@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alielmi98/image-processing-service/di"
+	"github.com/alielmi98/image-processing-service/internal/image/api/dto"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/helper"
+	"github.com/gin-gonic/gin"
+)
+
+type PresetHandler struct {
+	usecase *usecase.PresetUsecase
+}
+
+func NewPresetHandler(cfg *config.Config) *PresetHandler {
+	return &PresetHandler{
+		usecase: di.GetPresetUsecase(cfg),
+	}
+}
+
+// Create godoc
+// @Summary Create a processing preset
+// @Description Store named processing parameters that jobs can refer to by name. Global presets are available to every user and can only be created by admins.
+// @Tags Presets
+// @Accept json
+// @produces json
+// @param request body dto.SavePresetRequest true "Preset"
+// @Success 201 {object} helper.BaseHttpResponse{result=dto.PresetResponse} "Preset"
+// @Failure 400 {object} helper.BaseHttpResponse{error=[]entity.FieldError} "Invalid parameters"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 409 {object} helper.BaseHttpResponse "Name already used"
+// @Router /v1/presets [post]
+// @Security AuthBearer
+func (h *PresetHandler) Create(c *gin.Context) {
+	var request dto.SavePresetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithValidationError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.CreatePreset(c, dto.ToSavePreset(request))
+	if abortWithPresetError(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, helper.GenerateBaseResponse(dto.ToPresetResponse(res), true, helper.Success))
+}
+
+// GetAll godoc
+// @Summary List processing presets
+// @Description List the presets of the current user along with the global ones
+// @Tags Presets
+// @produces json
+// @Success 200 {object} helper.BaseHttpResponse{result=[]dto.PresetResponse} "Presets"
+// @Router /v1/presets [get]
+// @Security AuthBearer
+func (h *PresetHandler) GetAll(c *gin.Context) {
+	res, err := h.usecase.GetPresets(c)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToPresetResponses(res), true, helper.Success))
+}
+
+// Get godoc
+// @Summary Get a processing preset
+// @Description Get a preset of the current user or a global one
+// @Tags Presets
+// @produces json
+// @Param id path int true "Preset id"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.PresetResponse} "Preset"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/presets/{id} [get]
+// @Security AuthBearer
+func (h *PresetHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.GetPreset(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToPresetResponse(res), true, helper.Success))
+}
+
+// Update godoc
+// @Summary Update a processing preset
+// @Description Replace a preset of the current user, or a global one as an admin. Jobs created from the preset keep their parameters.
+// @Tags Presets
+// @Accept json
+// @produces json
+// @Param id path int true "Preset id"
+// @param request body dto.SavePresetRequest true "Preset"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.PresetResponse} "Preset"
+// @Failure 400 {object} helper.BaseHttpResponse{error=[]entity.FieldError} "Invalid parameters"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Failure 409 {object} helper.BaseHttpResponse "Name already used"
+// @Router /v1/presets/{id} [put]
+// @Security AuthBearer
+func (h *PresetHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+	var request dto.SavePresetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithValidationError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.UpdatePreset(c, id, dto.ToSavePreset(request))
+	if abortWithPresetError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToPresetResponse(res), true, helper.Success))
+}
+
+// Delete godoc
+// @Summary Delete a processing preset
+// @Description Delete a preset of the current user, or a global one as an admin. Jobs created from the preset are not affected.
+// @Tags Presets
+// @produces json
+// @Param id path int true "Preset id"
+// @Success 200 {object} helper.BaseHttpResponse "Deleted"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/presets/{id} [delete]
+// @Security AuthBearer
+func (h *PresetHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	if err := h.usecase.DeletePreset(c, id); err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(nil, true, helper.Success))
+}
+
+// abortWithPresetError responds with the error of saving a preset, invalid
+// parameters are reported field by field. It reports whether there was one.
+func abortWithPresetError(c *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	var validationErrors entity.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithAnyError(nil, false, helper.ValidationError, validationErrors))
+		return true
+	}
+	c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+		helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+	return true
+}
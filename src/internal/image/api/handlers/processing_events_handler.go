@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/api/dto"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	jobEventName   = "job"
+	eventKeepAlive = 15 * time.Second
+	eventWriteWait = 10 * time.Second
+)
+
+// StreamProcessingJob godoc
+// @Summary Stream the events of an image processing job
+// @Description Push the state transitions and pipeline progress of a job as Server-Sent Events named "job".
+// @Description The first event is the current state and the stream ends once the job has finished.
+// @Description EventSource clients may pass the token in the access_token query parameter.
+// @Tags Processing
+// @Produce event-stream
+// @Param id path int true "Job id"
+// @Success 200 {object} dto.ProcessingJobEvent "Stream of job events"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/processing/{id}/events [get]
+// @Security AuthBearer
+func (h *ProcessingHandler) StreamProcessingJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	current, updates, unsubscribe, err := h.usecase.SubscribeProcessingJob(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent(jobEventName, dto.ToProcessingJobEvent(current))
+	c.Writer.Flush()
+	if current.Status.IsFinal() {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-updates:
+			if !ok {
+				return false
+			}
+			c.SSEvent(jobEventName, dto.ToProcessingJobEvent(event))
+			return !event.Status.IsFinal()
+		case <-keepAlive.C:
+			// A comment keeps proxies from closing an idle stream
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		}
+	})
+}
+
+// WatchProcessingJob godoc
+// @Summary Watch the events of an image processing job over WebSocket
+// @Description Upgrade to a WebSocket that receives the state transitions and pipeline progress of a job as JSON messages.
+// @Description The first message is the current state and the server closes the socket once the job has finished.
+// @Description Browser clients may pass the token in the access_token query parameter.
+// @Tags Processing
+// @Param id path int true "Job id"
+// @Success 101 {object} dto.ProcessingJobEvent "Job events"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/processing/{id}/ws [get]
+// @Security AuthBearer
+func (h *ProcessingHandler) WatchProcessingJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	current, updates, unsubscribe, err := h.usecase.SubscribeProcessingJob(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	defer unsubscribe()
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// Clients only send control frames, reading is needed to notice them leave
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if !writeJobEvent(conn, dto.ToProcessingJobEvent(current)) {
+		return
+	}
+	ping := time.NewTicker(eventKeepAlive)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-updates:
+			if !ok {
+				// The subscription ends when the server shuts down
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+					time.Now().Add(eventWriteWait))
+				return
+			}
+			if !writeJobEvent(conn, dto.ToProcessingJobEvent(event)) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeJobEvent sends an event and closes the socket after a final one. It
+// reports whether more events should follow.
+func writeJobEvent(conn *websocket.Conn, event dto.ProcessingJobEvent) bool {
+	conn.SetWriteDeadline(time.Now().Add(eventWriteWait))
+	if err := conn.WriteJSON(event); err != nil {
+		return false
+	}
+	if event.Status.IsFinal() {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job finished"),
+			time.Now().Add(eventWriteWait))
+		return false
+	}
+	return true
+}
+
+// newUpgrader only accepts WebSocket connections from the origins allowed by CORS
+func newUpgrader(cfg *config.Config) websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || cfg.Cors.AllowOrigins == "*" {
+				return true
+			}
+			for _, allowed := range strings.Split(cfg.Cors.AllowOrigins, ",") {
+				if strings.TrimSpace(allowed) == origin {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
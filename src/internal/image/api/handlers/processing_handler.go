@@ -1,35 +1,49 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/alielmi98/image-processing-service/di"
 	"github.com/alielmi98/image-processing-service/internal/image/api/dto"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
 	"github.com/alielmi98/image-processing-service/internal/image/usecase"
 	"github.com/alielmi98/image-processing-service/pkg/config"
 	"github.com/alielmi98/image-processing-service/pkg/helper"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
 type ProcessingHandler struct {
-	usecase *usecase.ProcessingUsecase
+	usecase  *usecase.ProcessingUsecase
+	upgrader websocket.Upgrader
 }
 
 func NewProcessingHandler(cfg *config.Config) *ProcessingHandler {
 	return &ProcessingHandler{
-		usecase: usecase.NewProcessingUseCase(cfg, di.GetProcessingRepository(cfg), di.GetMessageSender(cfg)),
+		usecase:  di.GetProcessingUsecase(cfg),
+		upgrader: newUpgrader(cfg),
 	}
 }
 
 // CreateProcessingJob godoc
 // @Summary Create an image processing job
-// @Description Create an image processing job
+// @Description Create an image processing job, queued right away or scheduled with run_at or delay_seconds
 // @Tags Processing
 // @Accept json
 // @produces json
 // @param request body dto.CreateProcessImageRequest true "Processing request"
+// @Param Idempotency-Key header string false "Replays the first response when the same request is retried"
 // @Success 201 {object} helper.BaseHttpResponse{result=dto.ProcessImageResponse} "Processing response"
-// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 400 {object} helper.BaseHttpResponse{error=[]entity.FieldError} "Invalid parameters"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Image not found"
+// @Failure 409 {object} helper.BaseHttpResponse "Idempotency key reused or in progress"
 // @Router /v1/processing [post]
 // @Security AuthBearer
 func (h *ProcessingHandler) CreateProcessingJob(c *gin.Context) {
@@ -40,10 +54,232 @@ func (h *ProcessingHandler) CreateProcessingJob(c *gin.Context) {
 	}
 
 	response, err := h.usecase.CreateProcessingJob(c, dto.ToCreateProcessImageRequest(request))
+	var validationErrors entity.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		c.JSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithAnyError(nil, false, helper.ValidationError, validationErrors))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, helper.BaseHttpResponse{Error: err.Error()})
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
 		return
 	}
 
 	c.JSON(http.StatusCreated, helper.BaseHttpResponse{Result: response})
 }
+
+// GetProcessingJobs godoc
+// @Summary List image processing jobs
+// @Description List the latest processing jobs of the current user, e.g. the scheduled ones
+// @Tags Processing
+// @produces json
+// @Param status query string false "Only the jobs in this status" Enums(scheduled, pending, processing, completed, failed, cancelled)
+// @Success 200 {object} helper.BaseHttpResponse{result=[]dto.ProcessingJobResponse} "Processing jobs"
+// @Router /v1/processing [get]
+// @Security AuthBearer
+func (h *ProcessingHandler) GetProcessingJobs(c *gin.Context) {
+	res, err := h.usecase.GetProcessingJobs(c, models.ImageStatus(c.Query("status")))
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToProcessingJobResponses(res), true, helper.Success))
+}
+
+// GetProcessingJob godoc
+// @Summary Get an image processing job
+// @Description Get the status, timings and result metadata of a processing job
+// @Tags Processing
+// @produces json
+// @Param id path int true "Job id"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.ProcessingJobResponse} "Processing job"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/processing/{id} [get]
+// @Security AuthBearer
+func (h *ProcessingHandler) GetProcessingJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.GetProcessingJob(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToProcessingJobResponse(res), true, helper.Success))
+}
+
+// CancelProcessingJob godoc
+// @Summary Cancel an image processing job
+// @Description Cancel a scheduled, pending or running processing job
+// @Tags Processing
+// @produces json
+// @Param id path int true "Job id"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.ProcessingJobResponse} "Cancelled processing job"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Failure 409 {object} helper.BaseHttpResponse "Job already finished"
+// @Router /v1/processing/{id} [delete]
+// @Security AuthBearer
+func (h *ProcessingHandler) CancelProcessingJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.CancelProcessingJob(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToProcessingJobResponse(res), true, helper.Success))
+}
+
+// CreateProcessingBatch godoc
+// @Summary Create a batch of image processing jobs
+// @Description Apply the same processing to many images, selected by id or by a filter. Images that cannot be processed are reported as rejected.
+// @Tags Processing
+// @Accept json
+// @produces json
+// @param request body dto.CreateProcessingBatchRequest true "Batch request"
+// @Param Idempotency-Key header string false "Replays the first response when the same request is retried"
+// @Success 201 {object} helper.BaseHttpResponse{result=dto.ProcessingBatchResponse} "Processing batch"
+// @Failure 400 {object} helper.BaseHttpResponse{error=[]entity.FieldError} "Invalid parameters"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 409 {object} helper.BaseHttpResponse "Idempotency key reused or in progress"
+// @Router /v1/processing/batch [post]
+// @Security AuthBearer
+func (h *ProcessingHandler) CreateProcessingBatch(c *gin.Context) {
+	var request dto.CreateProcessingBatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithValidationError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.CreateProcessingBatch(c, dto.ToProcessingBatchRequest(request))
+	var validationErrors entity.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		c.JSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithAnyError(nil, false, helper.ValidationError, validationErrors))
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusCreated, helper.GenerateBaseResponse(dto.ToProcessingBatchResponse(res), true, helper.Success))
+}
+
+// GetProcessingBatch godoc
+// @Summary Get a batch of image processing jobs
+// @Description Get the progress of a batch along with its failed jobs
+// @Tags Processing
+// @produces json
+// @Param id path int true "Batch id"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.ProcessingBatchResponse} "Processing batch"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/processing/batch/{id} [get]
+// @Security AuthBearer
+func (h *ProcessingHandler) GetProcessingBatch(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.GetProcessingBatch(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToProcessingBatchResponse(res), true, helper.Success))
+}
+
+// CancelProcessingBatch godoc
+// @Summary Cancel a batch of image processing jobs
+// @Description Cancel every job of a batch that has not finished yet
+// @Tags Processing
+// @produces json
+// @Param id path int true "Batch id"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.ProcessingBatchResponse} "Cancelled batch"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Failure 409 {object} helper.BaseHttpResponse "Batch already finished"
+// @Router /v1/processing/batch/{id} [delete]
+// @Security AuthBearer
+func (h *ProcessingHandler) CancelProcessingBatch(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.CancelProcessingBatch(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToProcessingBatchResponse(res), true, helper.Success))
+}
+
+// GetProcessingResult godoc
+// @Summary Download the result of an image processing job
+// @Description Stream the file produced by a completed processing job
+// @Tags Processing
+// @produces octet-stream
+// @Param id path int true "Job id"
+// @Success 200 {file} file "Processed image"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Failure 409 {object} helper.BaseHttpResponse "Result not ready"
+// @Router /v1/processing/{id}/result [get]
+// @Security AuthBearer
+func (h *ProcessingHandler) GetProcessingResult(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	file, err := h.usecase.GetProcessingResultFile(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	if _, err := os.Stat(file.Path); err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound,
+			helper.GenerateBaseResponseWithError(nil, false, helper.NotFoundError,
+				&service_errors.ServiceError{EndUserMessage: service_errors.RecordNotFound}))
+		return
+	}
+
+	if file.MimeType != "" {
+		c.Header("Content-Type", file.MimeType)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", file.FileName))
+	c.File(file.Path)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alielmi98/image-processing-service/di"
+	"github.com/alielmi98/image-processing-service/internal/image/api/dto"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/helper"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	usecase *usecase.WebhookUsecase
+}
+
+func NewWebhookHandler(cfg *config.Config) *WebhookHandler {
+	return &WebhookHandler{
+		usecase: di.GetWebhookUsecase(cfg),
+	}
+}
+
+// GetSetting godoc
+// @Summary Get the webhook settings
+// @Description Get the default callback URL of new jobs and the secret deliveries are signed with.
+// @Description Every delivery carries the X-Webhook-Signature header "sha256=<hex>", the HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" keyed with the secret.
+// @Tags Webhooks
+// @produces json
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.WebhookSettingResponse} "Webhook settings"
+// @Router /v1/webhooks/settings [get]
+// @Security AuthBearer
+func (h *WebhookHandler) GetSetting(c *gin.Context) {
+	res, err := h.usecase.GetWebhookSetting(c)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToWebhookSettingResponse(res), true, helper.Success))
+}
+
+// SaveSetting godoc
+// @Summary Update the webhook settings
+// @Description Set the default callback URL of new jobs and optionally rotate the signing secret
+// @Tags Webhooks
+// @Accept json
+// @produces json
+// @param request body dto.SaveWebhookSettingRequest true "Webhook settings"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.WebhookSettingResponse} "Webhook settings"
+// @Failure 400 {object} helper.BaseHttpResponse{error=[]entity.FieldError} "Invalid callback URL, e.g. one in a private network"
+// @Router /v1/webhooks/settings [put]
+// @Security AuthBearer
+func (h *WebhookHandler) SaveSetting(c *gin.Context) {
+	var request dto.SaveWebhookSettingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithValidationError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.SaveWebhookSetting(c, dto.ToSaveWebhookSetting(request))
+	var validationErrors entity.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithAnyError(nil, false, helper.ValidationError, validationErrors))
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToWebhookSettingResponse(res), true, helper.Success))
+}
+
+// GetDeliveries godoc
+// @Summary List webhook deliveries
+// @Description List the latest webhook deliveries of the current user along with their attempts
+// @Tags Webhooks
+// @produces json
+// @Param job_id query int false "Only the deliveries of this job"
+// @Success 200 {object} helper.BaseHttpResponse{result=[]dto.WebhookDeliveryResponse} "Webhook deliveries"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Router /v1/webhooks/deliveries [get]
+// @Security AuthBearer
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	jobId := 0
+	if value := c.Query("job_id"); value != "" {
+		var err error
+		if jobId, err = strconv.Atoi(value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest,
+				helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+			return
+		}
+	}
+
+	res, err := h.usecase.GetWebhookDeliveries(c, jobId)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToWebhookDeliveryResponses(res), true, helper.Success))
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook
+// @Description Send a past delivery again with the same delivery id
+// @Tags Webhooks
+// @produces json
+// @Param id path int true "Delivery id"
+// @Success 200 {object} helper.BaseHttpResponse{result=dto.WebhookDeliveryResponse} "Scheduled delivery"
+// @Failure 400 {object} helper.BaseHttpResponse "Bad request"
+// @Failure 403 {object} helper.BaseHttpResponse "Forbidden"
+// @Failure 404 {object} helper.BaseHttpResponse "Not found"
+// @Router /v1/webhooks/deliveries/{id}/redeliver [post]
+// @Security AuthBearer
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+		return
+	}
+
+	res, err := h.usecase.RedeliverWebhook(c, id)
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err),
+			helper.GenerateBaseResponseWithError(nil, false, helper.InternalError, err))
+		return
+	}
+	c.JSON(http.StatusOK, helper.GenerateBaseResponse(dto.ToWebhookDeliveryResponse(res), true, helper.Success))
+}
@@ -1,19 +1,57 @@
 package routers
 
 import (
+	"github.com/alielmi98/image-processing-service/di"
 	"github.com/alielmi98/image-processing-service/internal/image/api/handlers"
+	"github.com/alielmi98/image-processing-service/internal/middlewares"
 	"github.com/alielmi98/image-processing-service/pkg/config"
 	"github.com/gin-gonic/gin"
 )
 
 func Image(r *gin.RouterGroup, cfg *config.Config) {
 	handler := handlers.NewImageHandler(cfg)
-	r.POST("/", handler.Create)
+	r.POST("/", middlewares.Idempotency(cfg, di.GetIdempotencyRepository(cfg)), handler.Create)
+	r.GET("/:id/jobs", handler.GetJobs)
 
 }
 
+// Routes streaming the events of a job. Browsers cannot set headers on them, so
+// they accept the access token in the query as well.
+const (
+	ProcessingEventsRoute = "/:id/events"
+	ProcessingWatchRoute  = "/:id/ws"
+)
+
 func Processing(r *gin.RouterGroup, cfg *config.Config) {
 	handler := handlers.NewProcessingHandler(cfg)
 
-	r.POST("/", handler.CreateProcessingJob)
+	r.POST("/", middlewares.Idempotency(cfg, di.GetIdempotencyRepository(cfg)), handler.CreateProcessingJob)
+	r.GET("/", handler.GetProcessingJobs)
+	r.POST("/batch", middlewares.Idempotency(cfg, di.GetIdempotencyRepository(cfg)), handler.CreateProcessingBatch)
+	r.GET("/batch/:id", handler.GetProcessingBatch)
+	r.DELETE("/batch/:id", handler.CancelProcessingBatch)
+	r.GET("/:id", handler.GetProcessingJob)
+	r.DELETE("/:id", handler.CancelProcessingJob)
+	r.GET("/:id/result", handler.GetProcessingResult)
+	r.GET(ProcessingEventsRoute, handler.StreamProcessingJob)
+	r.GET(ProcessingWatchRoute, handler.WatchProcessingJob)
+}
+
+func Preset(r *gin.RouterGroup, cfg *config.Config) {
+	handler := handlers.NewPresetHandler(cfg)
+
+	r.POST("/", handler.Create)
+	r.GET("/", handler.GetAll)
+	r.GET("/:id", handler.Get)
+	r.PUT("/:id", handler.Update)
+	r.DELETE("/:id", handler.Delete)
+}
+
+func Webhook(r *gin.RouterGroup, cfg *config.Config) {
+	handler := handlers.NewWebhookHandler(cfg)
+
+	r.GET("/settings", handler.GetSetting)
+	r.PUT("/settings", handler.SaveSetting)
+	r.GET("/deliveries", handler.GetDeliveries)
+	r.POST("/deliveries/:id/redeliver", handler.Redeliver)
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ProcessingBatch groups the jobs created by one batch request, each applying
+// the same processing to a different image
+type ProcessingBatch struct {
+	Id             int                    `gorm:"primarykey"`
+	UserId         int                    `gorm:"not null;index"`
+	ProcessingType ProcessingType         `gorm:"type:varchar(50);not null"`
+	Parameters     map[string]interface{} `gorm:"type:jsonb"`
+	Priority       int                    `gorm:"not null;default:5"`
+	Total          int                    `gorm:"not null"` // Jobs created for the batch
+
+	CreatedAt  time.Time    `gorm:"type:TIMESTAMP with time zone;not null"`
+	ModifiedAt sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+	DeletedAt  sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+
+	CreatedBy  int            `gorm:"not null"`
+	ModifiedBy *sql.NullInt64 `gorm:"null"`
+	DeletedBy  *sql.NullInt64 `gorm:"null"`
+}
+
+// ProcessingBatchCount is the number of jobs of a batch in one status
+type ProcessingBatchCount struct {
+	Status ImageStatus
+	Count  int
+}
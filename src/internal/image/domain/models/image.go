@@ -9,12 +9,22 @@ import (
 type ImageStatus string
 
 const (
+	ImageStatusScheduled  ImageStatus = "scheduled"
 	ImageStatusPending    ImageStatus = "pending"
 	ImageStatusProcessing ImageStatus = "processing"
 	ImageStatusCompleted  ImageStatus = "completed"
 	ImageStatusFailed     ImageStatus = "failed"
+	ImageStatusCancelled  ImageStatus = "cancelled"
 )
 
+// FinalStatuses are the statuses a job does not leave anymore
+var FinalStatuses = []ImageStatus{ImageStatusCompleted, ImageStatusFailed, ImageStatusCancelled}
+
+// IsFinal reports whether a job in this status will not change anymore
+func (s ImageStatus) IsFinal() bool {
+	return s == ImageStatusCompleted || s == ImageStatusFailed || s == ImageStatusCancelled
+}
+
 // ProcessingType represents different types of image processing operations
 type ProcessingType string
 
@@ -26,6 +36,7 @@ const (
 	ProcessingTypeWatermark ProcessingType = "watermark"
 	ProcessingTypeCompress  ProcessingType = "compress"
 	ProcessingTypeFormat    ProcessingType = "format"
+	ProcessingTypePipeline  ProcessingType = "pipeline"
 )
 
 // Image represents an image record in the database
@@ -63,9 +74,16 @@ type ProcessingJob struct {
 	Status         ImageStatus            `gorm:"type:varchar(20);not null;default:'pending'"`
 	ResultPath     sql.NullString         `gorm:"type:text;null"`
 	ErrorMessage   sql.NullString         `gorm:"type:text;null"`
+	Priority       int                    `gorm:"not null;default:5"` // 1-10, higher is consumed first
+	RetryCount     int                    `gorm:"not null;default:0"`
+	CallbackUrl    sql.NullString         `gorm:"type:text;null"` // Receives the result once the job completes or fails
+	BatchId        sql.NullInt64          `gorm:"null;index"`     // Set for the jobs of a batch request
+	Result         *ProcessingResult      `gorm:"foreignKey:ProcessingJobId"`
 
 	// Processing metrics
+	RunAt       sql.NullTime  `gorm:"type:TIMESTAMP with time zone;null;index"` // When a scheduled job is queued
 	StartedAt   sql.NullTime  `gorm:"type:TIMESTAMP with time zone;null"`
+	DeadlineAt  sql.NullTime  `gorm:"type:TIMESTAMP with time zone;null;index"` // When the running attempt times out, stuck jobs are reaped after it
 	CompletedAt sql.NullTime  `gorm:"type:TIMESTAMP with time zone;null"`
 	Duration    sql.NullInt64 `gorm:"null"` // Duration in milliseconds
 
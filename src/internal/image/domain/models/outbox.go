@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// OutboxStatus represents the state of an outbox message
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending"
+	OutboxStatusSent    OutboxStatus = "sent"
+)
+
+// OutboxMessage is a broker message stored in the same transaction as the
+// change it announces and published afterwards by the outbox relay
+type OutboxMessage struct {
+	Id            int                    `gorm:"primarykey"`
+	MessageId     string                 `gorm:"type:varchar(100);not null;index"`
+	Topic         string                 `gorm:"type:varchar(255);not null"`
+	RoutingKey    string                 `gorm:"type:varchar(255);not null"`
+	Body          []byte                 `gorm:"type:bytea;not null"`
+	Headers       map[string]interface{} `gorm:"type:jsonb;serializer:json"`
+	Priority      int                    `gorm:"not null;default:0"`
+	RetryCount    int                    `gorm:"not null;default:0"`
+	MaxRetries    int                    `gorm:"not null;default:0"`
+	Status        OutboxStatus           `gorm:"type:varchar(20);not null;default:'pending';index"`
+	Attempts      int                    `gorm:"not null;default:0"` // Failed publish attempts
+	LastError     sql.NullString         `gorm:"type:text;null"`
+	NextAttemptAt time.Time              `gorm:"type:TIMESTAMP with time zone;not null;index"`
+	SentAt        sql.NullTime           `gorm:"type:TIMESTAMP with time zone;null"`
+
+	CreatedAt time.Time `gorm:"type:TIMESTAMP with time zone;not null"`
+}
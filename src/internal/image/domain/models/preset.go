@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ProcessingPreset is a named processing setup jobs can refer to instead of
+// repeating its parameters. Presets without a user are global and available
+// to everyone.
+type ProcessingPreset struct {
+	Id             int                    `gorm:"primarykey"`
+	Name           string                 `gorm:"type:varchar(100);not null;index"`
+	UserId         sql.NullInt64          `gorm:"null;index"` // Null for global presets
+	Description    sql.NullString         `gorm:"type:text;null"`
+	ProcessingType ProcessingType         `gorm:"type:varchar(50);not null"`
+	Parameters     map[string]interface{} `gorm:"type:jsonb"`
+
+	CreatedAt  time.Time    `gorm:"type:TIMESTAMP with time zone;not null"`
+	ModifiedAt sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+	DeletedAt  sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+
+	CreatedBy  int            `gorm:"not null"`
+	ModifiedBy *sql.NullInt64 `gorm:"null"`
+	DeletedBy  *sql.NullInt64 `gorm:"null"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WebhookDeliveryStatus represents the state of a webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookSetting holds the default callback URL of a user and the secret
+// every delivery to that user is signed with
+type WebhookSetting struct {
+	Id          int            `gorm:"primarykey"`
+	UserId      int            `gorm:"not null;unique"`
+	CallbackUrl sql.NullString `gorm:"type:text;null"`
+	Secret      string         `gorm:"type:varchar(100);not null"`
+
+	CreatedAt  time.Time    `gorm:"type:TIMESTAMP with time zone;not null"`
+	ModifiedAt sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+	DeletedAt  sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+
+	CreatedBy  int            `gorm:"not null"`
+	ModifiedBy *sql.NullInt64 `gorm:"null"`
+	DeletedBy  *sql.NullInt64 `gorm:"null"`
+}
+
+// WebhookDelivery is a processing result to be posted to a callback URL
+type WebhookDelivery struct {
+	Id              int                      `gorm:"primarykey"`
+	DeliveryId      string                   `gorm:"type:varchar(36);not null;unique"` // Sent to the receiver, stays the same across attempts
+	UserId          int                      `gorm:"not null;index"`
+	ProcessingJobId int                      `gorm:"not null;index"`
+	ProcessingJob   ProcessingJob            `gorm:"foreignKey:ProcessingJobId;constraint:OnUpdate:NO ACTION;OnDelete:CASCADE"`
+	Event           ImageStatus              `gorm:"type:varchar(20);not null"` // Job status that triggered the delivery
+	Url             string                   `gorm:"type:text;not null"`
+	Payload         string                   `gorm:"type:text;not null"`
+	Status          WebhookDeliveryStatus    `gorm:"type:varchar(20);not null;default:'pending';index"`
+	AttemptCount    int                      `gorm:"not null;default:0"`
+	NextAttemptAt   sql.NullTime             `gorm:"type:TIMESTAMP with time zone;null;index"`
+	DeliveredAt     sql.NullTime             `gorm:"type:TIMESTAMP with time zone;null"`
+	Attempts        []WebhookDeliveryAttempt `gorm:"foreignKey:WebhookDeliveryId"`
+
+	CreatedAt  time.Time    `gorm:"type:TIMESTAMP with time zone;not null"`
+	ModifiedAt sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+	DeletedAt  sql.NullTime `gorm:"type:TIMESTAMP with time zone;null"`
+
+	CreatedBy  int            `gorm:"not null"`
+	ModifiedBy *sql.NullInt64 `gorm:"null"`
+	DeletedBy  *sql.NullInt64 `gorm:"null"`
+}
+
+// WebhookDeliveryAttempt records a single request made for a delivery
+type WebhookDeliveryAttempt struct {
+	Id                int            `gorm:"primarykey"`
+	WebhookDeliveryId int            `gorm:"not null;index"`
+	StatusCode        sql.NullInt64  `gorm:"null"` // Not set when no response was received
+	Error             sql.NullString `gorm:"type:text;null"`
+	Duration          int64          `gorm:"not null"` // Duration in milliseconds
+
+	CreatedAt time.Time `gorm:"type:TIMESTAMP with time zone;not null"`
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
 )
@@ -12,12 +14,91 @@ type ImageRepository interface {
 	UpdateImage(ctx context.Context, id int, image map[string]interface{}) (models.Image, error)
 	DeleteImage(ctx context.Context, id int) error
 	GetImageByID(ctx context.Context, id int) (models.Image, error)
+	GetImageByFileName(ctx context.Context, fileName string) (models.Image, error)
+	GetImagesByIDs(ctx context.Context, ids []int) ([]models.Image, error)
+	// FindImages returns the images of a user that match filter, oldest first
+	FindImages(ctx context.Context, userId int, filter ImageFilter, limit int) ([]models.Image, error)
+	// GetImageJobs returns the jobs of an image created after the job afterId, oldest first
+	GetImageJobs(ctx context.Context, imageId, afterId, limit int) ([]models.ProcessingJob, error)
+}
+
+// ImageFilter selects images, zero fields match every image
+type ImageFilter struct {
+	MimeType      string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
 }
 
 // ProcessingRepository defines the contract for processing job data operations
 type ProcessingRepository interface {
-	CreateProcessingJob(ctx context.Context, job models.ProcessingJob) (models.ProcessingJob, error)
+	// CreateProcessingJob inserts a job along with the message that queues it,
+	// which newMessage builds from the inserted job. Scheduled jobs are inserted
+	// without a message.
+	CreateProcessingJob(ctx context.Context, job models.ProcessingJob, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (models.ProcessingJob, error)
 	UpdateProcessingJob(ctx context.Context, id int, job map[string]interface{}) (models.ProcessingJob, error)
 	DeleteProcessingJob(ctx context.Context, id int) error
 	GetProcessingJobByID(ctx context.Context, id int) (models.ProcessingJob, error)
+	// GetProcessingJobs lists the latest jobs of a user, all of them when status is empty
+	GetProcessingJobs(ctx context.Context, userId int, status models.ImageStatus, limit int) ([]models.ProcessingJob, error)
+	CancelProcessingJob(ctx context.Context, id int) (bool, error)
+	// RecordProcessingResult updates a job that has not finished yet and stores
+	// its result and webhook delivery, if any, in one transaction. It reports
+	// false when the job finished in the meantime, e.g. because it was
+	// cancelled, or when attempt is older than the current attempt of the job.
+	RecordProcessingResult(ctx context.Context, id int, attempt int, job map[string]interface{}, result *models.ProcessingResult, delivery *models.WebhookDelivery) (bool, error)
+	// GetStuckProcessingJobs returns processing jobs whose deadline passed before the given time
+	GetStuckProcessingJobs(ctx context.Context, before time.Time, limit int) ([]models.ProcessingJob, error)
+	// RequeueStuckProcessingJob puts a stuck job back to pending for another
+	// attempt along with the message that queues it again. It reports false when
+	// the job is no longer stuck.
+	RequeueStuckProcessingJob(ctx context.Context, job models.ProcessingJob, before time.Time, reason string, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (bool, error)
+	// FailStuckProcessingJob marks a stuck job failed and stores its webhook
+	// delivery, if any, in one transaction. It reports false when the job is no
+	// longer stuck.
+	FailStuckProcessingJob(ctx context.Context, id int, before time.Time, reason string, delivery *models.WebhookDelivery) (bool, error)
+	// QueueDueProcessingJobs moves the scheduled jobs whose run time is not
+	// after now to pending, along with the messages that queue them
+	QueueDueProcessingJobs(ctx context.Context, now time.Time, limit int, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) ([]models.ProcessingJob, error)
+	// CreateProcessingBatch inserts a batch along with its jobs and the messages
+	// that queue them, like CreateProcessingJob does for a single job
+	CreateProcessingBatch(ctx context.Context, batch models.ProcessingBatch, jobs []models.ProcessingJob, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (models.ProcessingBatch, error)
+	GetProcessingBatchByID(ctx context.Context, id int) (models.ProcessingBatch, error)
+	// CountProcessingBatchJobs returns how many jobs of a batch are in each status
+	CountProcessingBatchJobs(ctx context.Context, batchId int) ([]models.ProcessingBatchCount, error)
+	GetProcessingBatchJobs(ctx context.Context, batchId int, status models.ImageStatus, limit int) ([]models.ProcessingJob, error)
+	// CancelProcessingBatch cancels the unfinished jobs of a batch and returns their ids
+	CancelProcessingBatch(ctx context.Context, batchId int) ([]int, error)
+}
+
+// PresetRepository defines the contract for processing preset data operations
+type PresetRepository interface {
+	CreatePreset(ctx context.Context, preset models.ProcessingPreset) (models.ProcessingPreset, error)
+	UpdatePreset(ctx context.Context, id int, preset map[string]interface{}) (models.ProcessingPreset, error)
+	DeletePreset(ctx context.Context, id int) error
+	GetPresetByID(ctx context.Context, id int) (models.ProcessingPreset, error)
+	GetPresets(ctx context.Context, userId int) ([]models.ProcessingPreset, error)
+	// GetPresetByName returns the preset of a user, or the global one when userId is null
+	GetPresetByName(ctx context.Context, userId sql.NullInt64, name string) (models.ProcessingPreset, error)
+	// ResolvePreset returns the preset a user refers to by name, their own or a global one
+	ResolvePreset(ctx context.Context, userId int, name string) (models.ProcessingPreset, error)
+}
+
+// WebhookRepository defines the contract for webhook settings and deliveries
+type WebhookRepository interface {
+	GetWebhookSetting(ctx context.Context, userId int) (models.WebhookSetting, error)
+	SaveWebhookSetting(ctx context.Context, setting models.WebhookSetting) (models.WebhookSetting, error)
+	UpdateWebhookDelivery(ctx context.Context, id int, delivery map[string]interface{}) (models.WebhookDelivery, error)
+	GetWebhookDeliveryByID(ctx context.Context, id int) (models.WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, userId int, jobId int, limit int) ([]models.WebhookDelivery, error)
+	ClaimDueWebhookDeliveries(ctx context.Context, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, attempt models.WebhookDeliveryAttempt, delivery map[string]interface{}) error
+}
+
+// OutboxRepository defines the contract for the messages waiting to be published
+type OutboxRepository interface {
+	ClaimPendingOutboxMessages(ctx context.Context, lease time.Duration, limit int) ([]models.OutboxMessage, error)
+	MarkOutboxMessagesSent(ctx context.Context, ids []int) error
+	MarkOutboxMessageFailed(ctx context.Context, id int, publishErr string, nextAttemptAt time.Time) error
+	// DeleteSentOutboxMessages deletes the messages sent before the given time
+	DeleteSentOutboxMessages(ctx context.Context, before time.Time) (int64, error)
 }
@@ -6,6 +6,12 @@ import (
 	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
 )
 
+// Job priorities, a higher priority is consumed first
+const (
+	MinPriority = 1
+	MaxPriority = 10
+)
+
 // ProcessingMessage represents a message for image processing
 type ProcessingMessage struct {
 	JobId          int                    `json:"job_id"`
@@ -30,10 +36,20 @@ type ProcessingResult struct {
 	ResultPath   string                 `json:"result_path,omitempty"`
 	ErrorMessage string                 `json:"error_message,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
-	Duration     int64                  `json:"duration"` // Duration in milliseconds
+	Duration     int64                  `json:"duration"`    // Duration in milliseconds
+	RetryCount   int                    `json:"retry_count"` // Number of earlier failed attempts
+	Progress     int                    `json:"progress"`    // Percent done while processing, 0-100
 	ProcessedAt  time.Time              `json:"processed_at"`
 }
 
+// ResultMetadata describes the file produced by a completed job
+type ResultMetadata struct {
+	FileSize int64  `json:"file_size"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MimeType string `json:"mime_type"`
+}
+
 // ResizeParameters represents parameters for image resize operation
 type ResizeParameters struct {
 	Width         int    `json:"width"`
@@ -54,35 +70,62 @@ type CropParameters struct {
 
 // RotateParameters represents parameters for image rotation
 type RotateParameters struct {
-	Angle  float64 `json:"angle"` // Rotation angle in degrees
-	Format string  `json:"format,omitempty"`
+	Angle      float64 `json:"angle"`                // Rotation angle in degrees, counter-clockwise
+	Background string  `json:"background,omitempty"` // Fill for uncovered corners: #rrggbb, #rrggbbaa or transparent
+	Format     string  `json:"format,omitempty"`
 }
 
 // FilterParameters represents parameters for image filters
 type FilterParameters struct {
 	FilterType string                 `json:"filter_type"` // blur, sharpen, grayscale, sepia, etc.
-	Intensity  float64                `json:"intensity"`   // Filter intensity 0.0-1.0
+	Intensity  float64                `json:"intensity"`   // Filter intensity 0.0-1.0, full strength when omitted. Required for brightness, contrast and saturation, where 0.5 is unchanged.
 	Options    map[string]interface{} `json:"options,omitempty"`
 	Format     string                 `json:"format,omitempty"`
 }
 
+// Watermark positions
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+)
+
 // WatermarkParameters represents parameters for watermark operation
 type WatermarkParameters struct {
 	WatermarkPath string  `json:"watermark_path"`
-	Position      string  `json:"position"` // top-left, top-right, bottom-left, bottom-right, center
-	Opacity       float64 `json:"opacity"`  // 0.0-1.0
-	Scale         float64 `json:"scale"`    // Scale of watermark relative to image
+	Position      string  `json:"position"`         // top-left, top-right, bottom-left, bottom-right, center
+	Opacity       float64 `json:"opacity"`          // 0.0-1.0
+	Scale         float64 `json:"scale"`            // Scale of watermark relative to image
+	Margin        int     `json:"margin,omitempty"` // Distance from the edges in pixels
 	Format        string  `json:"format,omitempty"`
 }
 
 // CompressParameters represents parameters for image compression
 type CompressParameters struct {
-	Quality int    `json:"quality"` // 1-100
-	Format  string `json:"format"`  // jpg, webp, etc.
+	Quality          int    `json:"quality"`                     // 1-100
+	Format           string `json:"format"`                      // jpg, webp, etc.
+	CompressionLevel string `json:"compression_level,omitempty"` // PNG only: default, none, best-speed, best-compression
+	Background       string `json:"background,omitempty"`        // Fill for transparent pixels when the format has no alpha
 }
 
 // FormatParameters represents parameters for format conversion
 type FormatParameters struct {
-	TargetFormat string `json:"target_format"` // jpg, png, webp, gif, etc.
-	Quality      int    `json:"quality"`       // 1-100 (for lossy formats)
+	TargetFormat     string `json:"target_format"`               // jpg, png, webp, gif, bmp, tiff
+	Quality          int    `json:"quality"`                     // 1-100 (for lossy formats)
+	CompressionLevel string `json:"compression_level,omitempty"` // PNG only: default, none, best-speed, best-compression
+	Background       string `json:"background,omitempty"`        // Fill for transparent pixels when the format has no alpha
+}
+
+// PipelineStep represents a single operation of a pipeline
+type PipelineStep struct {
+	ProcessingType models.ProcessingType  `json:"processing_type"`
+	Parameters     map[string]interface{} `json:"parameters"`
+}
+
+// PipelineParameters represents an ordered list of operations applied to the
+// same image in memory and encoded once at the end
+type PipelineParameters struct {
+	Steps []PipelineStep `json:"steps"`
 }
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes a single invalid field of a processing request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every invalid field of a processing request
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, 0, len(v))
+	for _, e := range v {
+		messages = append(messages, fmt.Sprintf("%s: %s", e.Field, e.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records an invalid field
+func (v *ValidationErrors) Add(field string, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
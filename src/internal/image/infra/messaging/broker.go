@@ -0,0 +1,68 @@
+package messaging
+
+import (
+	"fmt"
+
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+)
+
+// MemoryDriver selects the in-process broker, which lets the API run the
+// worker itself without RabbitMQ
+const MemoryDriver = "memory"
+
+const (
+	// ProcessingTopic is the exchange processing jobs are published to
+	ProcessingTopic = "image.processing"
+	// ResultTopic is the exchange workers publish job results to
+	ResultTopic = "image.result"
+)
+
+// NewBroker creates a broker of the configured driver
+func NewBroker(config *config.Config) rabbitmq.RabbitMQ {
+	if config.RabbitMQ.Driver == MemoryDriver {
+		return NewMemoryBroker(config)
+	}
+	return rabbitmq.NewRabbitMQBroker(brokerConfig(config))
+}
+
+// NewMemoryBroker creates an in-process broker, whatever the configured driver
+func NewMemoryBroker(config *config.Config) *rabbitmq.MemoryBroker {
+	return rabbitmq.NewMemoryBroker(brokerConfig(config))
+}
+
+func brokerConfig(config *config.Config) *rabbitmq.Config {
+	// Build connection URL
+	connectionURL := fmt.Sprintf("amqp://%s:%s@%s:%s/%s",
+		config.RabbitMQ.User,
+		config.RabbitMQ.Password,
+		config.RabbitMQ.Host,
+		config.RabbitMQ.Port,
+		config.RabbitMQ.VHost,
+	)
+
+	// Convert to rabbitmq.Config
+	rbConfig := &rabbitmq.Config{
+		URL:                  connectionURL,
+		Host:                 config.RabbitMQ.Host,
+		Port:                 config.RabbitMQ.Port,
+		Username:             config.RabbitMQ.User,
+		Password:             config.RabbitMQ.Password,
+		VHost:                config.RabbitMQ.VHost,
+		PrefetchCount:        config.RabbitMQ.PrefetchCount,
+		ReconnectDelay:       config.RabbitMQ.ReconnectDelay,
+		MaxReconnectAttempts: config.RabbitMQ.MaxReconnectAttempts,
+		MaxRetries:           config.RabbitMQ.MaxRetries,
+		RetryDelay:           config.RabbitMQ.RetryDelay,
+		MaxRetryDelay:        config.RabbitMQ.MaxRetryDelay,
+		PublishTimeout:       config.RabbitMQ.PublishTimeout,
+		PublisherChannels:    config.RabbitMQ.PublisherChannels,
+		MaxPriority:          entity.MaxPriority, // Job priorities map one to one onto AMQP priorities
+		Workers: map[string]int{
+			ProcessingTopic: config.RabbitMQ.ProcessingWorkers,
+			ResultTopic:     config.RabbitMQ.ResultWorkers,
+		},
+	}
+	return rbConfig
+}
@@ -0,0 +1,64 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+)
+
+type MessageConsumer struct {
+	config *config.RabbitMQConfig
+	broker rabbitmq.RabbitMQ
+}
+
+func NewMessageConsumer(config *config.Config, broker rabbitmq.RabbitMQ) (*MessageConsumer, error) {
+	// Connect to the broker, consuming starts once it can be reached
+	broker.Open()
+
+	return &MessageConsumer{
+		config: &config.RabbitMQ,
+		broker: broker,
+	}, nil
+}
+
+// Subscribe registers the handler for messages published to topic
+func (mc *MessageConsumer) Subscribe(topic string, handler rabbitmq.MessageHandler) error {
+	if err := mc.broker.Subscribe(topic, handler); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Start starts delivering messages to the subscribed handlers
+func (mc *MessageConsumer) Start(ctx context.Context) error {
+	return mc.broker.Start(ctx)
+}
+
+// Shutdown stops consuming and closes the broker once the messages being
+// handled are finished, or requeued when ctx is done first
+func (mc *MessageConsumer) Shutdown(ctx context.Context) error {
+	return mc.broker.Shutdown(ctx)
+}
+
+func (mc *MessageConsumer) Close() error {
+	if mc.broker != nil {
+		return mc.broker.Close()
+	}
+	return nil
+}
+
+// NewResultHandler decodes processing results before passing them to handle
+func NewResultHandler(handle func(ctx context.Context, result *entity.ProcessingResult) error) rabbitmq.MessageHandler {
+	return func(ctx context.Context, msg *rabbitmq.Message) error {
+		var result entity.ProcessingResult
+		if err := json.Unmarshal(msg.Body, &result); err != nil {
+			// A malformed result can never succeed, so it is dead-lettered right away
+			return rabbitmq.Permanent(fmt.Errorf("failed to decode processing result %s: %w", msg.ID, err))
+		}
+		return handle(ctx, &result)
+	}
+}
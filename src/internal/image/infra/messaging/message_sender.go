@@ -13,38 +13,14 @@ import (
 
 type MessageSender struct {
 	config *config.RabbitMQConfig
-	broker *rabbitmq.RabbitMQBroker
+	broker rabbitmq.RabbitMQ
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func NewMessageSender(config *config.Config) (*MessageSender, error) {
+func NewMessageSender(config *config.Config, broker rabbitmq.RabbitMQ) (*MessageSender, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Build connection URL
-	connectionURL := fmt.Sprintf("amqp://%s:%s@%s:%s/%s",
-		config.RabbitMQ.User,
-		config.RabbitMQ.Password,
-		config.RabbitMQ.Host,
-		config.RabbitMQ.Port,
-		config.RabbitMQ.VHost,
-	)
-
-	// Convert to rabbitmq.Config
-	rbConfig := &rabbitmq.Config{
-		URL:                  connectionURL,
-		Host:                 config.RabbitMQ.Host,
-		Port:                 config.RabbitMQ.Port,
-		Username:             config.RabbitMQ.User,
-		Password:             config.RabbitMQ.Password,
-		VHost:                config.RabbitMQ.VHost,
-		PrefetchCount:        config.RabbitMQ.PrefetchCount,
-		ReconnectDelay:       config.RabbitMQ.ReconnectDelay,
-		MaxReconnectAttempts: config.RabbitMQ.MaxReconnectAttempts,
-	}
-
-	broker := rabbitmq.NewRabbitMQBroker(rbConfig)
-
 	client := &MessageSender{
 		config: &config.RabbitMQ,
 		broker: broker,
@@ -52,35 +28,90 @@ func NewMessageSender(config *config.Config) (*MessageSender, error) {
 		cancel: cancel,
 	}
 
-	// Connect to RabbitMQ
-	if err := broker.Connect(); err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
-	}
+	// Connect to the broker, messages are kept in the outbox until it can be reached
+	broker.Open()
 
-	dummyHandler := func(ctx context.Context, msg *rabbitmq.Message) error {
-		return nil
-	}
-	if err := broker.Subscribe("image.processing", dummyHandler); err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to subscribe and create queue: %w", err)
+	// Declare the queues up front so nothing is lost before the consumers start
+	for _, topic := range []string{ProcessingTopic, ResultTopic} {
+		if err := broker.DeclareTopic(topic); err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to declare topic %s: %w", topic, err)
+		}
 	}
 
 	return client, nil
 }
 
 func (ms *MessageSender) SendMessage(ctx context.Context, message *entity.ProcessingMessage) error {
+	rabbitMsg, err := EncodeProcessingMessage(ms.config, message)
+	if err != nil {
+		return err
+	}
+
+	// Publish message
+	err = ms.broker.Publish(ctx, rabbitMsg)
+	if err != nil {
+		return fmt.Errorf("failed to publish processing message: %w", err)
+	}
+
+	log.Printf("Sent processing message for job %d", message.JobId)
+	return nil
+}
+
+// Publish publishes an already encoded message
+func (ms *MessageSender) Publish(ctx context.Context, message *rabbitmq.Message) error {
+	return ms.broker.Publish(ctx, message)
+}
+
+// PublishBatch publishes already encoded messages, see rabbitmq.RabbitMQ.PublishBatch
+func (ms *MessageSender) PublishBatch(ctx context.Context, messages []*rabbitmq.Message) error {
+	return ms.broker.PublishBatch(ctx, messages)
+}
+
+func (ms *MessageSender) SendResult(ctx context.Context, result *entity.ProcessingResult) error {
+	// Marshal result to JSON
+	resultBody, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal processing result: %w", err)
+	}
+
+	// Create RabbitMQ message
+	rabbitMsg := &rabbitmq.Message{
+		ID:         fmt.Sprintf("job_%d_%s", result.JobId, result.Status),
+		Topic:      ResultTopic,
+		RoutingKey: ms.config.ResultRoutingKey,
+		Body:       resultBody,
+		Headers: map[string]interface{}{
+			"content_type": "application/json",
+			"job_id":       result.JobId,
+			"status":       string(result.Status),
+		},
+		Timestamp: result.ProcessedAt,
+	}
+
+	// Publish result
+	err = ms.broker.Publish(ctx, rabbitMsg)
+	if err != nil {
+		return fmt.Errorf("failed to publish processing result: %w", err)
+	}
+
+	log.Printf("Sent %s result for job %d", result.Status, result.JobId)
+	return nil
+}
+
+// EncodeProcessingMessage builds the broker message that queues a processing job
+func EncodeProcessingMessage(config *config.RabbitMQConfig, message *entity.ProcessingMessage) (*rabbitmq.Message, error) {
 	// Marshal message to JSON
 	messageBody, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("failed to marshal processing message: %w", err)
+		return nil, fmt.Errorf("failed to marshal processing message: %w", err)
 	}
 
 	// Create RabbitMQ message
-	rabbitMsg := &rabbitmq.Message{
+	return &rabbitmq.Message{
 		ID:         fmt.Sprintf("job_%d", message.JobId),
-		Topic:      "image.processing",
-		RoutingKey: ms.config.ProcessingRoutingKey,
+		Topic:      ProcessingTopic,
+		RoutingKey: config.ProcessingRoutingKey,
 		Body:       messageBody,
 		Headers: map[string]interface{}{
 			"content_type": "application/json",
@@ -88,20 +119,11 @@ func (ms *MessageSender) SendMessage(ctx context.Context, message *entity.Proces
 			"image_id":     message.ImageId,
 			"user_id":      message.UserId,
 		},
-		Priority:   5, // Default priority
+		Priority:   uint8(min(max(message.Priority, entity.MinPriority), entity.MaxPriority)),
 		Timestamp:  message.Timestamp,
 		RetryCount: message.RetryCount,
 		MaxRetries: message.MaxRetries,
-	}
-
-	// Publish message
-	err = ms.broker.Publish(ctx, rabbitMsg)
-	if err != nil {
-		return fmt.Errorf("failed to publish processing message: %w", err)
-	}
-
-	log.Printf("Sent processing message for job %d", message.JobId)
-	return nil
+	}, nil
 }
 
 func (ms *MessageSender) Close() error {
@@ -0,0 +1,167 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+)
+
+// outboxLease is how long claimed messages are hidden from other relays. It
+// only matters when a relay dies before recording the outcome of a publish.
+const outboxLease = 30 * time.Second
+
+// NewOutboxMessage stores a broker message for the outbox relay to publish
+func NewOutboxMessage(message *rabbitmq.Message) models.OutboxMessage {
+	return models.OutboxMessage{
+		MessageId:     message.ID,
+		Topic:         message.Topic,
+		RoutingKey:    message.RoutingKey,
+		Body:          message.Body,
+		Headers:       message.Headers,
+		Priority:      int(message.Priority),
+		RetryCount:    message.RetryCount,
+		MaxRetries:    message.MaxRetries,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now().UTC(),
+		CreatedAt:     message.Timestamp,
+	}
+}
+
+func toBrokerMessage(message models.OutboxMessage) *rabbitmq.Message {
+	return &rabbitmq.Message{
+		ID:         message.MessageId,
+		Topic:      message.Topic,
+		RoutingKey: message.RoutingKey,
+		Body:       message.Body,
+		Headers:    message.Headers,
+		Priority:   uint8(message.Priority),
+		Timestamp:  message.CreatedAt,
+		RetryCount: message.RetryCount,
+		MaxRetries: message.MaxRetries,
+	}
+}
+
+// OutboxRelay publishes the messages of the outbox and marks them sent. While
+// the broker is unavailable messages stay in the outbox and are retried with
+// exponential backoff, so writers never depend on the broker.
+type OutboxRelay struct {
+	config *config.OutboxConfig
+	repo   repository.OutboxRepository
+	sender *MessageSender
+}
+
+func NewOutboxRelay(config *config.Config, repo repository.OutboxRepository, sender *MessageSender) *OutboxRelay {
+	return &OutboxRelay{
+		config: &config.Outbox,
+		repo:   repo,
+		sender: sender,
+	}
+}
+
+// Run relays pending messages every PollInterval and deletes the old sent
+// ones every PurgeInterval until ctx is done
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	purgeTicker := time.NewTicker(r.config.PurgeInterval)
+	defer purgeTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-purgeTicker.C:
+			r.purge(ctx)
+		case <-ticker.C:
+			if err := r.relay(ctx); err != nil {
+				log.Printf("Caller:%s Level:%s Msg:%s", constants.RabbitMQ, constants.Publish, err.Error())
+			}
+		}
+	}
+}
+
+// relay publishes a batch of due messages at once. The messages the broker
+// confirmed are marked sent, the others are retried after a backoff.
+func (r *OutboxRelay) relay(ctx context.Context) error {
+	messages, err := r.repo.ClaimPendingOutboxMessages(ctx, outboxLease, r.config.BatchSize)
+	if err != nil || len(messages) == 0 {
+		return err
+	}
+	brokerMessages := make([]*rabbitmq.Message, 0, len(messages))
+	for _, message := range messages {
+		brokerMessages = append(brokerMessages, toBrokerMessage(message))
+	}
+	publishErr := r.sender.PublishBatch(ctx, brokerMessages)
+	failed := failedMessages(publishErr, messages)
+
+	sent := make([]int, 0, len(messages))
+	for _, message := range messages {
+		err, ok := failed[message.Id]
+		if !ok {
+			sent = append(sent, message.Id)
+			continue
+		}
+		next := time.Now().UTC().Add(r.retryDelay(message.Attempts + 1))
+		if err := r.repo.MarkOutboxMessageFailed(ctx, message.Id, err.Error(), next); err != nil {
+			return err
+		}
+	}
+	if len(sent) > 0 {
+		// Unless marked, the messages are published again after the lease, consumers skip finished jobs
+		if err := r.repo.MarkOutboxMessagesSent(ctx, sent); err != nil {
+			return err
+		}
+	}
+	return publishErr
+}
+
+// failedMessages maps the ids of the outbox messages a batch publish did not
+// confirm to their error. Several messages of a batch may share a broker
+// message id, e.g. the attempts of a requeued job, so they are told apart by
+// their position. An error that is not tied to a message, like a lost
+// connection, fails every message.
+func failedMessages(err error, messages []models.OutboxMessage) map[int]error {
+	failed := make(map[int]error)
+	if err == nil {
+		return failed
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		var publishErr *rabbitmq.PublishError
+		if !errors.As(e, &publishErr) || publishErr.Index < 0 || publishErr.Index >= len(messages) {
+			for _, message := range messages {
+				failed[message.Id] = err
+			}
+			return failed
+		}
+		failed[messages[publishErr.Index].Id] = publishErr
+	}
+	return failed
+}
+
+// purge deletes the messages sent longer than Retention ago
+func (r *OutboxRelay) purge(ctx context.Context) {
+	count, err := r.repo.DeleteSentOutboxMessages(ctx, time.Now().UTC().Add(-r.config.Retention))
+	if err == nil && count > 0 {
+		log.Printf("Caller:%s Level:%s Msg:%d sent outbox messages deleted", constants.Postgres, constants.Delete, count)
+	}
+}
+
+// retryDelay returns the delay after the given failed attempt, starting at
+// RetryDelay and doubling up to MaxRetryDelay
+func (r *OutboxRelay) retryDelay(attempt int) time.Duration {
+	delay := r.config.RetryDelay
+	for i := 1; i < attempt && delay < r.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, r.config.MaxRetryDelay)
+}
@@ -0,0 +1,44 @@
+package messaging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+)
+
+func TestOutboxMessageRoundTrip(t *testing.T) {
+	message := &rabbitmq.Message{
+		ID:         "job_1",
+		Topic:      ProcessingTopic,
+		RoutingKey: "image.process",
+		Body:       []byte(`{"job_id":1}`),
+		Headers:    map[string]interface{}{"job_id": 1},
+		Priority:   7,
+		Timestamp:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		MaxRetries: 3,
+	}
+	if got := toBrokerMessage(NewOutboxMessage(message)); !reflect.DeepEqual(got, message) {
+		t.Errorf("relayed %+v, want %+v", got, message)
+	}
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	relay := NewOutboxRelay(&config.Config{Outbox: config.OutboxConfig{RetryDelay: time.Second, MaxRetryDelay: 10 * time.Second}}, nil, nil)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 1000, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := relay.retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"log"
 
+	"github.com/alielmi98/image-processing-service/constants"
 	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
 	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
 	"github.com/alielmi98/image-processing-service/pkg/config"
@@ -39,3 +41,67 @@ func (r *ImagePgRepository) DeleteImage(ctx context.Context, id int) error {
 func (r *ImagePgRepository) GetImageByID(ctx context.Context, id int) (models.Image, error) {
 	return r.GetById(ctx, id)
 }
+
+func (r *ImagePgRepository) GetImageByFileName(ctx context.Context, fileName string) (models.Image, error) {
+	var image models.Image
+	err := r.db.WithContext(ctx).
+		Where("file_name = ? and deleted_by is null", fileName).
+		First(&image).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+		return image, err
+	}
+	return image, nil
+}
+
+func (r *ImagePgRepository) GetImagesByIDs(ctx context.Context, ids []int) ([]models.Image, error) {
+	var images []models.Image
+	err := r.db.WithContext(ctx).
+		Where("id in ? and deleted_by is null", ids).
+		Find(&images).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return images, err
+}
+
+func (r *ImagePgRepository) FindImages(ctx context.Context, userId int, filter repository.ImageFilter, limit int) ([]models.Image, error) {
+	var images []models.Image
+	query := r.db.WithContext(ctx).
+		Where("user_id = ? and deleted_by is null", userId)
+	if filter.MimeType != "" {
+		query = query.Where("mime_type = ?", filter.MimeType)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	err := query.
+		Order("id").
+		Limit(limit).
+		Find(&images).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return images, err
+}
+
+func (r *ImagePgRepository) GetImageJobs(ctx context.Context, imageId, afterId, limit int) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	err := r.db.WithContext(ctx).
+		Preload("Result").
+		Where("image_id = ? and id > ? and deleted_by is null", imageId, afterId).
+		Order("id").
+		Limit(limit).
+		Find(&jobs).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return jobs, err
+}
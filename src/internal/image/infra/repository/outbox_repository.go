@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository() repository.OutboxRepository {
+	return &OutboxRepository{db: db.GetDb()}
+}
+
+// ClaimPendingOutboxMessages picks up the pending messages that are due, oldest
+// first, and leases them so other relays skip them until the lease expires
+func (r *OutboxRepository) ClaimPendingOutboxMessages(ctx context.Context, lease time.Duration, limit int) ([]models.OutboxMessage, error) {
+	now := time.Now().UTC()
+	var messages []models.OutboxMessage
+	tx := r.db.WithContext(ctx).Begin()
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? and next_attempt_at <= ?", models.OutboxStatusPending, now).
+		Order("id").
+		Limit(limit).
+		Find(&messages).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+		return nil, err
+	}
+	if len(messages) == 0 {
+		tx.Rollback()
+		return messages, nil
+	}
+
+	ids := make([]int, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.Id)
+	}
+	err = tx.
+		Model(&models.OutboxMessage{}).
+		Where("id in ?", ids).
+		Update("next_attempt_at", now.Add(lease)).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return nil, err
+	}
+	// Without the lease, the messages would be published by other relays as well
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *OutboxRepository) MarkOutboxMessagesSent(ctx context.Context, ids []int) error {
+	err := r.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id in ?", ids).
+		Updates(map[string]interface{}{
+			"status":  models.OutboxStatusSent,
+			"sent_at": sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		}).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+	}
+	return err
+}
+
+func (r *OutboxRepository) MarkOutboxMessageFailed(ctx context.Context, id int, publishErr string, nextAttemptAt time.Time) error {
+	err := r.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      sql.NullString{String: publishErr, Valid: true},
+			"next_attempt_at": nextAttemptAt,
+		}).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+	}
+	return err
+}
+
+func (r *OutboxRepository) DeleteSentOutboxMessages(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status = ? and sent_at < ?", models.OutboxStatusSent, before).
+		Delete(&models.OutboxMessage{})
+	if result.Error != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Delete, result.Error.Error())
+	}
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+	baseRepo "github.com/alielmi98/image-processing-service/pkg/repository"
+	"gorm.io/gorm"
+)
+
+type PresetRepository struct {
+	*baseRepo.BaseRepository[models.ProcessingPreset]
+	db *gorm.DB
+}
+
+func NewPresetRepository(cfg *config.Config, preloads []db.PreloadEntity) repository.PresetRepository {
+	database := db.GetDb()
+	return &PresetRepository{
+		BaseRepository: baseRepo.NewBaseRepository[models.ProcessingPreset](cfg, database, preloads),
+		db:             database,
+	}
+}
+
+func (r *PresetRepository) CreatePreset(ctx context.Context, preset models.ProcessingPreset) (models.ProcessingPreset, error) {
+	return r.Create(ctx, preset)
+}
+
+func (r *PresetRepository) UpdatePreset(ctx context.Context, id int, preset map[string]interface{}) (models.ProcessingPreset, error) {
+	return r.Update(ctx, id, preset)
+}
+
+func (r *PresetRepository) DeletePreset(ctx context.Context, id int) error {
+	return r.Delete(ctx, id)
+}
+
+func (r *PresetRepository) GetPresetByID(ctx context.Context, id int) (models.ProcessingPreset, error) {
+	return r.GetById(ctx, id)
+}
+
+// GetPresets lists the presets of a user along with the global ones
+func (r *PresetRepository) GetPresets(ctx context.Context, userId int) ([]models.ProcessingPreset, error) {
+	var presets []models.ProcessingPreset
+	err := r.db.WithContext(ctx).
+		Where("(user_id = ? or user_id is null) and deleted_by is null", userId).
+		Order("name, user_id nulls last").
+		Find(&presets).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return presets, err
+}
+
+func (r *PresetRepository) GetPresetByName(ctx context.Context, userId sql.NullInt64, name string) (models.ProcessingPreset, error) {
+	var preset models.ProcessingPreset
+	query := r.db.WithContext(ctx).
+		Where("name = ? and deleted_by is null", name)
+	if userId.Valid {
+		query = query.Where("user_id = ?", userId.Int64)
+	} else {
+		query = query.Where("user_id is null")
+	}
+	err := query.
+		First(&preset).
+		Error
+	return preset, err
+}
+
+// ResolvePreset prefers the preset of the user over a global one of the same name
+func (r *PresetRepository) ResolvePreset(ctx context.Context, userId int, name string) (models.ProcessingPreset, error) {
+	var preset models.ProcessingPreset
+	err := r.db.WithContext(ctx).
+		Where("name = ? and (user_id = ? or user_id is null) and deleted_by is null", name, userId).
+		Order("user_id nulls last").
+		First(&preset).
+		Error
+	return preset, err
+}
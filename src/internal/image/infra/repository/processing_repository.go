@@ -2,15 +2,24 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"log"
+	"time"
 
+	"github.com/alielmi98/image-processing-service/common"
+	"github.com/alielmi98/image-processing-service/constants"
 	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
 	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
 	"github.com/alielmi98/image-processing-service/pkg/config"
 	"github.com/alielmi98/image-processing-service/pkg/db"
 	baseRepo "github.com/alielmi98/image-processing-service/pkg/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// processingBatchInsertSize is how many rows of a batch are inserted per statement
+const processingBatchInsertSize = 100
+
 type ProcessingRepository struct {
 	*baseRepo.BaseRepository[models.ProcessingJob]
 	db *gorm.DB
@@ -24,8 +33,38 @@ func NewProcessingRepository(cfg *config.Config, preloads []db.PreloadEntity) re
 	}
 }
 
-func (r *ProcessingRepository) CreateProcessingJob(ctx context.Context, job models.ProcessingJob) (models.ProcessingJob, error) {
-	return r.Create(ctx, job)
+// CreateProcessingJob inserts the job and its outbox message in one
+// transaction, so a job is never left without a message or the other way round.
+// Scheduled jobs are inserted alone, their message is inserted once they are due.
+func (r *ProcessingRepository) CreateProcessingJob(ctx context.Context, job models.ProcessingJob, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (models.ProcessingJob, error) {
+	tx := r.db.WithContext(ctx).Begin()
+	if err := tx.Create(&job).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return job, err
+	}
+	if job.Status == models.ImageStatusScheduled {
+		if err := tx.Commit().Error; err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+			return job, err
+		}
+		return job, nil
+	}
+	message, err := newMessage(job)
+	if err != nil {
+		tx.Rollback()
+		return job, err
+	}
+	if err := tx.Create(&message).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return job, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return job, err
+	}
+	return job, nil
 }
 
 func (r *ProcessingRepository) UpdateProcessingJob(ctx context.Context, id int, job map[string]interface{}) (models.ProcessingJob, error) {
@@ -39,3 +78,377 @@ func (r *ProcessingRepository) DeleteProcessingJob(ctx context.Context, id int)
 func (r *ProcessingRepository) GetProcessingJobByID(ctx context.Context, id int) (models.ProcessingJob, error) {
 	return r.GetById(ctx, id)
 }
+
+// CancelProcessingJob marks a job cancelled unless it has already finished and
+// reports whether it did
+func (r *ProcessingRepository) CancelProcessingJob(ctx context.Context, id int) (bool, error) {
+	now := sql.NullTime{Valid: true, Time: time.Now().UTC()}
+	tx := r.db.WithContext(ctx).
+		Model(&models.ProcessingJob{}).
+		Where("id = ? and deleted_by is null and status in ?", id,
+			[]models.ImageStatus{models.ImageStatusScheduled, models.ImageStatusPending, models.ImageStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":       models.ImageStatusCancelled,
+			"completed_at": now,
+			"modified_by":  &sql.NullInt64{Int64: int64(ctx.Value(constants.UserIdKey).(float64)), Valid: true},
+			"modified_at":  now,
+		})
+	if tx.Error != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, tx.Error.Error())
+		return false, tx.Error
+	}
+	return tx.RowsAffected > 0, nil
+}
+
+// GetProcessingJobs lists the latest jobs of a user, optionally only those in one status
+func (r *ProcessingRepository) GetProcessingJobs(ctx context.Context, userId int, status models.ImageStatus, limit int) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	query := r.db.WithContext(ctx).
+		Preload("Result").
+		Where("image_id in (?) and deleted_by is null",
+			r.db.Model(&models.Image{}).Select("id").Where("user_id = ?", userId))
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.
+		Order("id desc").
+		Limit(limit).
+		Find(&jobs).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return jobs, err
+}
+
+// RecordProcessingResult updates the job on condition that it has not
+// finished, so a job cancelled while it was processed stays cancelled, and
+// that attempt is not behind its retry count, so an attempt that was retried
+// or reaped cannot move the job back. The result replaces a previously stored
+// one, the webhook delivery is only inserted when the job was updated.
+func (r *ProcessingRepository) RecordProcessingResult(ctx context.Context, id int, attempt int, job map[string]interface{}, result *models.ProcessingResult, delivery *models.WebhookDelivery) (bool, error) {
+	update := map[string]interface{}{}
+	for k, v := range job {
+		update[common.ToSnakeCase(k)] = v
+	}
+	update["modified_by"] = &sql.NullInt64{Int64: int64(ctx.Value(constants.UserIdKey).(float64)), Valid: true}
+	update["modified_at"] = sql.NullTime{Valid: true, Time: time.Now().UTC()}
+
+	tx := r.db.WithContext(ctx).Begin()
+	updated := tx.
+		Model(&models.ProcessingJob{}).
+		Where("id = ? and deleted_by is null and status not in ? and retry_count <= ?", id, models.FinalStatuses, attempt).
+		Updates(update)
+	if updated.Error != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, updated.Error.Error())
+		return false, updated.Error
+	}
+	if updated.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if result != nil {
+		err := tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "processing_job_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"result_path", "file_size", "width", "height", "mime_type", "modified_at"}),
+			}).
+			Omit("ProcessingJob").
+			Create(result).
+			Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+			return false, err
+		}
+	}
+	if err := createWebhookDelivery(tx, delivery); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+// createWebhookDelivery inserts the delivery, if any, within tx
+func createWebhookDelivery(tx *gorm.DB, delivery *models.WebhookDelivery) error {
+	if delivery == nil {
+		return nil
+	}
+	if err := tx.Omit("ProcessingJob").Create(delivery).Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *ProcessingRepository) GetStuckProcessingJobs(ctx context.Context, before time.Time, limit int) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	err := r.db.WithContext(ctx).
+		Preload("Image").
+		Where("status = ? and deadline_at < ? and deleted_by is null", models.ImageStatusProcessing, before).
+		Order("deadline_at").
+		Limit(limit).
+		Find(&jobs).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return jobs, err
+}
+
+// RequeueStuckProcessingJob resets the job and inserts its new message in one
+// transaction. The status condition keeps a job that reported back in the
+// meantime, or that another reaper took over, from being queued twice.
+func (r *ProcessingRepository) RequeueStuckProcessingJob(ctx context.Context, job models.ProcessingJob, before time.Time, reason string, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (bool, error) {
+	tx := r.db.WithContext(ctx).Begin()
+	result := tx.
+		Model(&models.ProcessingJob{}).
+		Where("id = ? and status = ? and deadline_at < ?", job.Id, models.ImageStatusProcessing, before).
+		Updates(map[string]interface{}{
+			"status":        models.ImageStatusPending,
+			"retry_count":   job.RetryCount + 1,
+			"error_message": sql.NullString{String: reason, Valid: true},
+			"started_at":    sql.NullTime{},
+			"deadline_at":   sql.NullTime{},
+			"modified_at":   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	job.Status = models.ImageStatusPending
+	job.RetryCount++
+	message, err := newMessage(job)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Create(&message).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+// FailStuckProcessingJob marks the job failed and inserts its webhook delivery
+// in one transaction, on the same condition as RequeueStuckProcessingJob
+func (r *ProcessingRepository) FailStuckProcessingJob(ctx context.Context, id int, before time.Time, reason string, delivery *models.WebhookDelivery) (bool, error) {
+	now := sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	tx := r.db.WithContext(ctx).Begin()
+	result := tx.
+		Model(&models.ProcessingJob{}).
+		Where("id = ? and status = ? and deadline_at < ?", id, models.ImageStatusProcessing, before).
+		Updates(map[string]interface{}{
+			"status":        models.ImageStatusFailed,
+			"error_message": sql.NullString{String: reason, Valid: true},
+			"completed_at":  now,
+			"modified_at":   now,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := createWebhookDelivery(tx, delivery); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+// QueueDueProcessingJobs moves the scheduled jobs that are due to pending and
+// inserts the messages that queue them in one transaction. Due jobs are locked
+// while they are queued, so concurrent schedulers skip them.
+func (r *ProcessingRepository) QueueDueProcessingJobs(ctx context.Context, now time.Time, limit int, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	tx := r.db.WithContext(ctx).Begin()
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Preload("Image").
+		Where("status = ? and run_at <= ? and deleted_by is null", models.ImageStatusScheduled, now).
+		Order("run_at").
+		Limit(limit).
+		Find(&jobs).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		tx.Rollback()
+		return jobs, nil
+	}
+
+	ids := make([]int, 0, len(jobs))
+	for i := range jobs {
+		ids = append(ids, jobs[i].Id)
+		jobs[i].Status = models.ImageStatusPending
+		message, err := newMessage(jobs[i])
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Create(&message).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+			return nil, err
+		}
+	}
+	err = tx.
+		Model(&models.ProcessingJob{}).
+		Where("id in ?", ids).
+		Updates(map[string]interface{}{
+			"status":      models.ImageStatusPending,
+			"modified_at": sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		}).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// CreateProcessingBatch inserts the batch, its jobs and the messages of the
+// jobs that are not scheduled in one transaction, so either the whole batch is
+// accepted or none of it
+func (r *ProcessingRepository) CreateProcessingBatch(ctx context.Context, batch models.ProcessingBatch, jobs []models.ProcessingJob, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (models.ProcessingBatch, error) {
+	tx := r.db.WithContext(ctx).Begin()
+	if err := tx.Create(&batch).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return batch, err
+	}
+	for i := range jobs {
+		jobs[i].BatchId = sql.NullInt64{Int64: int64(batch.Id), Valid: true}
+	}
+	if err := tx.Omit(clause.Associations).CreateInBatches(&jobs, processingBatchInsertSize).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return batch, err
+	}
+
+	messages := make([]models.OutboxMessage, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Status == models.ImageStatusScheduled {
+			continue
+		}
+		message, err := newMessage(job)
+		if err != nil {
+			tx.Rollback()
+			return batch, err
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) > 0 {
+		if err := tx.CreateInBatches(&messages, processingBatchInsertSize).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+			return batch, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return batch, err
+	}
+	return batch, nil
+}
+
+func (r *ProcessingRepository) GetProcessingBatchByID(ctx context.Context, id int) (models.ProcessingBatch, error) {
+	var batch models.ProcessingBatch
+	err := r.db.WithContext(ctx).
+		Where("id = ? and deleted_by is null", id).
+		First(&batch).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return batch, err
+}
+
+func (r *ProcessingRepository) CountProcessingBatchJobs(ctx context.Context, batchId int) ([]models.ProcessingBatchCount, error) {
+	var counts []models.ProcessingBatchCount
+	err := r.db.WithContext(ctx).
+		Model(&models.ProcessingJob{}).
+		Select("status, count(*) as count").
+		Where("batch_id = ? and deleted_by is null", batchId).
+		Group("status").
+		Scan(&counts).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return counts, err
+}
+
+func (r *ProcessingRepository) GetProcessingBatchJobs(ctx context.Context, batchId int, status models.ImageStatus, limit int) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	err := r.db.WithContext(ctx).
+		Where("batch_id = ? and status = ? and deleted_by is null", batchId, status).
+		Order("id").
+		Limit(limit).
+		Find(&jobs).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+	}
+	return jobs, err
+}
+
+// CancelProcessingBatch cancels the jobs of a batch that have not finished yet,
+// the jobs that finished in the meantime keep their outcome
+func (r *ProcessingRepository) CancelProcessingBatch(ctx context.Context, batchId int) ([]int, error) {
+	now := sql.NullTime{Valid: true, Time: time.Now().UTC()}
+	var jobs []models.ProcessingJob
+	err := r.db.WithContext(ctx).
+		Model(&jobs).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("batch_id = ? and deleted_by is null and status in ?", batchId,
+			[]models.ImageStatus{models.ImageStatusScheduled, models.ImageStatusPending, models.ImageStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":       models.ImageStatusCancelled,
+			"completed_at": now,
+			"modified_by":  &sql.NullInt64{Int64: int64(ctx.Value(constants.UserIdKey).(float64)), Valid: true},
+			"modified_at":  now,
+		}).
+		Error
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return nil, err
+	}
+	ids := make([]int, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.Id)
+	}
+	return ids, nil
+}
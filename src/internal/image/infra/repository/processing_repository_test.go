@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDriver accepts transactions but no statements, DryRun keeps gorm
+// from sending any
+type dryRunDriver struct{}
+
+func (dryRunDriver) Open(name string) (driver.Conn, error) { return dryRunConn{}, nil }
+
+type dryRunConn struct{}
+
+func (dryRunConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("dry run, no statements are sent")
+}
+func (dryRunConn) Close() error              { return nil }
+func (dryRunConn) Begin() (driver.Tx, error) { return dryRunConn{}, nil }
+func (dryRunConn) Commit() error             { return nil }
+func (dryRunConn) Rollback() error           { return nil }
+
+func init() {
+	sql.Register("dryrun", dryRunDriver{})
+}
+
+type statement struct {
+	sql  string
+	vars []interface{}
+}
+
+// newDryRunRepository returns a repository that records the statements it
+// would run against Postgres
+func newDryRunRepository(t *testing.T) (*ProcessingRepository, *[]statement) {
+	t.Helper()
+	conn, err := sql.Open("dryrun", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []statement
+	record := func(db *gorm.DB) {
+		statements = append(statements, statement{sql: db.Statement.SQL.String(), vars: db.Statement.Vars})
+	}
+	database.Callback().Query().After("gorm:query").Register("test:record", record)
+	database.Callback().Update().After("gorm:update").Register("test:record", record)
+	return &ProcessingRepository{db: database}, &statements
+}
+
+// assertStatement checks that the statement contains every fragment and
+// binds every value
+func assertStatement(t *testing.T, got statement, fragments []string, vars []interface{}) {
+	t.Helper()
+	for _, fragment := range fragments {
+		if !strings.Contains(got.sql, fragment) {
+			t.Errorf("statement %q lacks %q", got.sql, fragment)
+		}
+	}
+	for _, want := range vars {
+		found := false
+		for _, v := range got.vars {
+			if v == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("statement %q does not bind %v, bound %v", got.sql, want, got.vars)
+		}
+	}
+}
+
+func TestReaperQueries(t *testing.T) {
+	before := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		run       func(r *ProcessingRepository) error
+		fragments []string
+		vars      []interface{}
+	}{
+		{
+			name: "stuck jobs",
+			run: func(r *ProcessingRepository) error {
+				_, err := r.GetStuckProcessingJobs(context.Background(), before, 25)
+				return err
+			},
+			fragments: []string{
+				`FROM "processing_jobs"`,
+				"status = $1 and deadline_at < $2 and deleted_by is null",
+				"ORDER BY deadline_at",
+				"LIMIT $3",
+			},
+			vars: []interface{}{models.ImageStatusProcessing, before, 25},
+		},
+		{
+			// Only a job that is still overdue is taken over, one that reported
+			// back or that another reaper requeued is left alone
+			name: "requeue",
+			run: func(r *ProcessingRepository) error {
+				job := models.ProcessingJob{Id: 7, RetryCount: 1, Status: models.ImageStatusProcessing}
+				_, err := r.RequeueStuckProcessingJob(context.Background(), job, before, "timed out", func(models.ProcessingJob) (models.OutboxMessage, error) {
+					return models.OutboxMessage{}, nil
+				})
+				return err
+			},
+			fragments: []string{
+				`UPDATE "processing_jobs" SET`,
+				"id = $",
+				"status = $",
+				"deadline_at < $",
+			},
+			vars: []interface{}{models.ImageStatusPending, 2, 7, models.ImageStatusProcessing, before},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, statements := newDryRunRepository(t)
+			if err := tt.run(r); err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if len(*statements) == 0 {
+				t.Fatal("no statement recorded")
+			}
+			assertStatement(t, (*statements)[0], tt.fragments, tt.vars)
+		})
+	}
+}
+
+// Schedulers running side by side skip the rows another one claimed
+func TestSchedulerQuery(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r, statements := newDryRunRepository(t)
+	_, err := r.QueueDueProcessingJobs(context.Background(), now, 50, func(models.ProcessingJob) (models.OutboxMessage, error) {
+		return models.OutboxMessage{}, nil
+	})
+	if err != nil {
+		t.Fatalf("QueueDueProcessingJobs: %v", err)
+	}
+	if len(*statements) == 0 {
+		t.Fatal("no statement recorded")
+	}
+	assertStatement(t, (*statements)[0], []string{
+		`FROM "processing_jobs"`,
+		"status = $1 and run_at <= $2 and deleted_by is null",
+		"ORDER BY run_at",
+		"LIMIT $3",
+		"FOR UPDATE SKIP LOCKED",
+	}, []interface{}{models.ImageStatusScheduled, now, 50})
+}
+
+// A result only applies to a job that has not finished and whose retry count
+// is not ahead of the attempt that reported it
+func TestRecordProcessingResultQuery(t *testing.T) {
+	r, statements := newDryRunRepository(t)
+	ctx := context.WithValue(context.Background(), constants.UserIdKey, float64(1))
+	_, err := r.RecordProcessingResult(ctx, 7, 2, map[string]interface{}{"Status": models.ImageStatusProcessing}, nil, nil)
+	if err != nil {
+		t.Fatalf("RecordProcessingResult: %v", err)
+	}
+	if len(*statements) == 0 {
+		t.Fatal("no statement recorded")
+	}
+	assertStatement(t, (*statements)[0], []string{
+		`UPDATE "processing_jobs" SET`,
+		"status not in",
+		"retry_count <= $",
+	}, []interface{}{models.ImageStatusProcessing, 7, 2})
+}
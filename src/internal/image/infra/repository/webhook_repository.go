@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/common"
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+	baseRepo "github.com/alielmi98/image-processing-service/pkg/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	*baseRepo.BaseRepository[models.WebhookDelivery]
+	db *gorm.DB
+}
+
+func NewWebhookRepository(cfg *config.Config, preloads []db.PreloadEntity) repository.WebhookRepository {
+	database := db.GetDb()
+	return &WebhookRepository{
+		BaseRepository: baseRepo.NewBaseRepository[models.WebhookDelivery](cfg, database, preloads),
+		db:             database,
+	}
+}
+
+func (r *WebhookRepository) GetWebhookSetting(ctx context.Context, userId int) (models.WebhookSetting, error) {
+	var setting models.WebhookSetting
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? and deleted_by is null", userId).
+		First(&setting).
+		Error
+	return setting, err
+}
+
+// SaveWebhookSetting inserts the setting of a user, replacing a previously stored one
+func (r *WebhookRepository) SaveWebhookSetting(ctx context.Context, setting models.WebhookSetting) (models.WebhookSetting, error) {
+	// The row is matched on user_id, a stored id would conflict on its own
+	setting.Id = 0
+	setting.ModifiedAt = sql.NullTime{Valid: true, Time: time.Now().UTC()}
+	setting.ModifiedBy = &sql.NullInt64{Int64: int64(setting.UserId), Valid: true}
+	tx := r.db.WithContext(ctx).Begin()
+	err := tx.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"callback_url", "secret", "modified_at", "modified_by"}),
+		}).
+		Create(&setting).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return setting, err
+	}
+	tx.Commit()
+	return setting, nil
+}
+
+func (r *WebhookRepository) UpdateWebhookDelivery(ctx context.Context, id int, delivery map[string]interface{}) (models.WebhookDelivery, error) {
+	return r.Update(ctx, id, delivery)
+}
+
+func (r *WebhookRepository) GetWebhookDeliveryByID(ctx context.Context, id int) (models.WebhookDelivery, error) {
+	return r.GetById(ctx, id)
+}
+
+// GetWebhookDeliveries lists the latest deliveries of a user, optionally only those of one job
+func (r *WebhookRepository) GetWebhookDeliveries(ctx context.Context, userId int, jobId int, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	query := r.db.WithContext(ctx).
+		Preload("Attempts", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("user_id = ? and deleted_by is null", userId)
+	if jobId > 0 {
+		query = query.Where("processing_job_id = ?", jobId)
+	}
+	err := query.
+		Order("id desc").
+		Limit(limit).
+		Find(&deliveries).
+		Error
+	return deliveries, err
+}
+
+// ClaimDueWebhookDeliveries picks up pending deliveries whose next attempt is
+// due and leases them, so other instances skip them until the lease expires
+func (r *WebhookRepository) ClaimDueWebhookDeliveries(ctx context.Context, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	now := time.Now().UTC()
+	var deliveries []models.WebhookDelivery
+	tx := r.db.WithContext(ctx).Begin()
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? and next_attempt_at <= ? and deleted_by is null", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&deliveries).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Select, err.Error())
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		tx.Rollback()
+		return deliveries, nil
+	}
+
+	ids := make([]int, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.Id)
+	}
+	err = tx.
+		Model(&models.WebhookDelivery{}).
+		Where("id in ?", ids).
+		Update("next_attempt_at", sql.NullTime{Valid: true, Time: now.Add(lease)}).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return nil, err
+	}
+	tx.Commit()
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt stores an attempt together with the resulting state of its delivery
+func (r *WebhookRepository) RecordWebhookAttempt(ctx context.Context, attempt models.WebhookDeliveryAttempt, delivery map[string]interface{}) error {
+	snakeMap := map[string]interface{}{}
+	for k, v := range delivery {
+		snakeMap[common.ToSnakeCase(k)] = v
+	}
+	snakeMap["modified_at"] = sql.NullTime{Valid: true, Time: time.Now().UTC()}
+
+	tx := r.db.WithContext(ctx).Begin()
+	if err := tx.Create(&attempt).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Insert, err.Error())
+		return err
+	}
+	err := tx.
+		Model(&models.WebhookDelivery{}).
+		Where("id = ?", attempt.WebhookDeliveryId).
+		Updates(snakeMap).
+		Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		return err
+	}
+	tx.Commit()
+	return nil
+}
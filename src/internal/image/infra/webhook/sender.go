@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/pkg/config"
+)
+
+// Headers sent with every delivery. Receivers verify a delivery by computing
+// the HMAC-SHA256 of "<timestamp>.<body>" with their secret and comparing it
+// to the signature, and use the delivery id to drop duplicates.
+const (
+	SignatureHeader  = "X-Webhook-Signature"
+	TimestampHeader  = "X-Webhook-Timestamp"
+	DeliveryIdHeader = "X-Webhook-Delivery"
+	EventHeader      = "X-Webhook-Event"
+)
+
+const signaturePrefix = "sha256="
+
+// ErrForbiddenAddress is returned for callback URLs that point into private
+// networks, e.g. the loopback interface or cloud metadata endpoints
+var ErrForbiddenAddress = errors.New("callback URL points to a private address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP does not
+// count as private
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Request is a single attempt to post a delivery
+type Request struct {
+	Url        string
+	Secret     string
+	DeliveryId string
+	Event      string
+	Payload    []byte
+}
+
+// Sender posts signed webhook deliveries. Unless AllowPrivateNetworks is set,
+// it refuses to connect to private addresses. The check runs when dialing, so
+// host names that resolve to such addresses are refused as well. Redirects
+// are not followed.
+type Sender struct {
+	client       *http.Client
+	allowPrivate bool
+}
+
+func NewSender(cfg *config.Config) *Sender {
+	s := &Sender{allowPrivate: cfg.Webhook.AllowPrivateNetworks}
+	dialer := &net.Dialer{Timeout: cfg.Webhook.Timeout, Control: s.control}
+	s.client = &http.Client{
+		Timeout: cfg.Webhook.Timeout,
+		Transport: &http.Transport{
+			Proxy:               nil, // A proxy would dial the receiver on our behalf
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.Webhook.Timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// CheckUrl reports whether a callback URL may be used. Host names are only
+// resolved when a delivery is sent, so this catches literal addresses early.
+func (s *Sender) CheckUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if s.allowPrivate {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && forbiddenIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// control runs before every connection, once the address is resolved
+func (s *Sender) control(network, address string, _ syscall.RawConn) error {
+	if s.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// forbiddenIP reports whether ip is not reachable from the public internet
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// Send posts the payload and returns the status code of the response. Any
+// status outside of 2xx is reported as an error.
+func (s *Sender) Send(ctx context.Context, req Request) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.Url, bytes.NewReader(req.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "image-processing-service-webhook")
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, timestamp, req.Payload))
+	httpReq.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set(DeliveryIdHeader, req.DeliveryId)
+	httpReq.Header.Set(EventHeader, req.Event)
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Draining a bounded part of the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a payload sent at timestamp
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/pkg/config"
+)
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"job_id":1}`)
+	reference := Sign("secret", 1700000000, payload)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		payload   []byte
+		wantSame  bool // As the reference signature
+	}{
+		{name: "same delivery", secret: "secret", timestamp: 1700000000, payload: payload, wantSame: true},
+		{name: "other secret", secret: "other", timestamp: 1700000000, payload: payload},
+		{name: "other timestamp", secret: "secret", timestamp: 1700000001, payload: payload},
+		{name: "other payload", secret: "secret", timestamp: 1700000000, payload: []byte(`{"job_id":2}`)},
+		// The separator keeps the timestamp from running into the payload
+		{name: "digits moved into the payload", secret: "secret", timestamp: 170000000, payload: append([]byte("0"), payload...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sign(tt.secret, tt.timestamp, tt.payload)
+			if (got == reference) != tt.wantSame {
+				t.Errorf("Sign = %s, reference %s, want same %v", got, reference, tt.wantSame)
+			}
+			if want := expectedSignature(tt.secret, tt.timestamp, tt.payload); got != want {
+				t.Errorf("Sign = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// expectedSignature computes the signature the way the receivers are told to
+func expectedSignature(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + string(payload)))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCheckUrl(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		allowPrivate bool
+		wantErr      bool
+		wantRefused  bool // Refused as a private address
+	}{
+		{name: "public host", url: "https://example.com/hook"},
+		{name: "public address", url: "http://93.184.216.34/hook"},
+		{name: "unsupported scheme", url: "ftp://example.com/hook", wantErr: true},
+		{name: "malformed", url: "http://[::1", wantErr: true},
+		{name: "localhost", url: "http://localhost:8080/hook", wantErr: true, wantRefused: true},
+		{name: "localhost with a trailing dot", url: "http://LocalHost./hook", wantErr: true, wantRefused: true},
+		{name: "subdomain of localhost", url: "http://api.localhost/hook", wantErr: true, wantRefused: true},
+		{name: "loopback", url: "http://127.0.0.1/hook", wantErr: true, wantRefused: true},
+		{name: "metadata endpoint", url: "http://169.254.169.254/latest", wantErr: true, wantRefused: true},
+		{name: "private network", url: "http://10.0.0.5/hook", wantErr: true, wantRefused: true},
+		{name: "ipv6 loopback", url: "http://[::1]/hook", wantErr: true, wantRefused: true},
+		{name: "localhost allowed", url: "http://localhost:8080/hook", allowPrivate: true},
+		{name: "scheme checked when private networks are allowed", url: "file:///etc/passwd", allowPrivate: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSender(&config.Config{Webhook: config.WebhookConfig{AllowPrivateNetworks: tt.allowPrivate}})
+			err := s.CheckUrl(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckUrl = %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrForbiddenAddress) != tt.wantRefused {
+				t.Errorf("CheckUrl = %v, want refused %v", err, tt.wantRefused)
+			}
+		})
+	}
+}
+
+func TestForbiddenIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: false},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: false},
+		{ip: "100.63.255.255", want: false},
+		{ip: "100.64.0.1", want: true},
+		{ip: "100.127.255.255", want: true},
+		{ip: "127.0.0.1", want: true},
+		{ip: "10.1.2.3", want: true},
+		{ip: "172.16.0.1", want: true},
+		{ip: "192.168.1.1", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "0.0.0.0", want: true},
+		{ip: "224.0.0.1", want: true},
+		{ip: "::1", want: true},
+		{ip: "fc00::1", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "::ffff:127.0.0.1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := forbiddenIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("forbiddenIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		allowPrivate bool
+		wantStatus   int
+		wantErr      bool
+		wantReceived bool
+	}{
+		{name: "delivered", status: http.StatusOK, allowPrivate: true, wantStatus: http.StatusOK, wantReceived: true},
+		{name: "rejected by the receiver", status: http.StatusServiceUnavailable, allowPrivate: true, wantStatus: http.StatusServiceUnavailable, wantErr: true, wantReceived: true},
+		{name: "redirect is not followed", status: http.StatusFound, allowPrivate: true, wantStatus: http.StatusFound, wantErr: true, wantReceived: true},
+		// The test server listens on the loopback interface
+		{name: "refused when dialing", status: http.StatusOK, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(`{"job_id":1}`)
+			received := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = true
+				body, _ := io.ReadAll(r.Body)
+				timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+				if err != nil {
+					t.Errorf("timestamp header %q: %v", r.Header.Get(TimestampHeader), err)
+				}
+				if got, want := r.Header.Get(SignatureHeader), expectedSignature("secret", timestamp, body); got != want {
+					t.Errorf("signature %s, want %s", got, want)
+				}
+				if r.Header.Get(DeliveryIdHeader) != "d1" || r.Header.Get(EventHeader) != "completed" {
+					t.Errorf("delivery headers %v", r.Header)
+				}
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			s := NewSender(&config.Config{Webhook: config.WebhookConfig{Timeout: 5 * time.Second, AllowPrivateNetworks: tt.allowPrivate}})
+			status, err := s.Send(context.Background(), Request{
+				Url:        server.URL,
+				Secret:     "secret",
+				DeliveryId: "d1",
+				Event:      "completed",
+				Payload:    payload,
+			})
+			if status != tt.wantStatus {
+				t.Errorf("status %d, want %d", status, tt.wantStatus)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.allowPrivate && !errors.Is(err, ErrForbiddenAddress) {
+				t.Errorf("Send = %v, want %v", err, ErrForbiddenAddress)
+			}
+			if received != tt.wantReceived {
+				t.Errorf("received %v, want %v", received, tt.wantReceived)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+)
+
+type SavePreset struct {
+	Name           string
+	Description    string
+	ProcessingType models.ProcessingType
+	Parameters     map[string]interface{}
+	Global         bool // Only admins may create global presets
+}
+
+type PresetResponse struct {
+	Id             int
+	Name           string
+	Description    string
+	ProcessingType models.ProcessingType
+	Parameters     map[string]interface{}
+	Global         bool
+	CreatedAt      time.Time
+	ModifiedAt     *time.Time
+}
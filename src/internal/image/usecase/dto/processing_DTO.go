@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
 )
 
@@ -8,8 +10,103 @@ type ProcessingRequest struct {
 	ImageId        int
 	ProcessingType models.ProcessingType
 	Parameters     map[string]interface{}
+	Priority       int
+	CallbackUrl    string
+	Preset         string        // Name of the preset whose parameters Parameters override
+	RunAt          *time.Time    // Queues the job at this time instead of right away
+	Delay          time.Duration // Queues the job after this delay, instead of RunAt
 }
 
 type ProcessingResponse struct {
 	JobId int
 }
+
+type ProcessingJobResponse struct {
+	Id             int
+	ImageId        int
+	ProcessingType models.ProcessingType
+	Parameters     map[string]interface{}
+	Status         models.ImageStatus
+	Priority       int
+	ErrorMessage   string
+	BatchId        int
+	RunAt          *time.Time
+	StartedAt      *time.Time
+	CompletedAt    *time.Time
+	Duration       int64
+	RetryCount     int
+	CallbackUrl    string
+	CreatedAt      time.Time
+	Result         *ProcessingResultResponse
+}
+
+type ProcessingResultResponse struct {
+	FileSize int64
+	Width    int
+	Height   int
+	MimeType string
+}
+
+type ProcessingJobEvent struct {
+	JobId        int
+	Status       models.ImageStatus
+	Progress     int
+	ErrorMessage string
+	Timestamp    time.Time
+}
+
+type ProcessingResultFile struct {
+	Path     string
+	FileName string
+	MimeType string
+}
+
+type ProcessingBatchRequest struct {
+	ImageIds       []int
+	Filter         *ImageFilter // Selects the images of the current user instead of ImageIds
+	ProcessingType models.ProcessingType
+	Parameters     map[string]interface{}
+	Priority       int
+	CallbackUrl    string
+	Preset         string
+	RunAt          *time.Time
+	Delay          time.Duration
+}
+
+type ImageFilter struct {
+	MimeType      string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+type ProcessingBatchResponse struct {
+	Id             int
+	ProcessingType models.ProcessingType
+	Parameters     map[string]interface{}
+	Priority       int
+	Total          int
+	Scheduled      int
+	Pending        int
+	Processing     int
+	Completed      int
+	Failed         int
+	Cancelled      int
+	Progress       int // Percent of the jobs that finished, 0-100
+	Finished       bool
+	CreatedAt      time.Time
+	Rejected       []ProcessingBatchRejection // Only reported when the batch is created
+	Failures       []ProcessingBatchFailure
+}
+
+// ProcessingBatchRejection is an image of a batch request no job was created for
+type ProcessingBatchRejection struct {
+	ImageId int
+	Error   string
+}
+
+// ProcessingBatchFailure is a job of a batch that failed
+type ProcessingBatchFailure struct {
+	JobId        int
+	ImageId      int
+	ErrorMessage string
+}
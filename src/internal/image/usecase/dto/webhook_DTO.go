@@ -0,0 +1,41 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+)
+
+type SaveWebhookSetting struct {
+	CallbackUrl  string
+	RotateSecret bool
+}
+
+type WebhookSettingResponse struct {
+	CallbackUrl string
+	Secret      string
+	CreatedAt   time.Time
+	ModifiedAt  *time.Time
+}
+
+type WebhookDeliveryResponse struct {
+	Id            int
+	DeliveryId    string
+	JobId         int
+	Event         models.ImageStatus
+	Url           string
+	Payload       string
+	Status        models.WebhookDeliveryStatus
+	AttemptCount  int
+	NextAttemptAt *time.Time
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time
+	Attempts      []WebhookDeliveryAttemptResponse
+}
+
+type WebhookDeliveryAttemptResponse struct {
+	StatusCode int
+	Error      string
+	Duration   int64
+	CreatedAt  time.Time
+}
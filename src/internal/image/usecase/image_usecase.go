@@ -9,6 +9,7 @@ import (
 	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
 	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
 	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
 )
 
 type ImageUsecase struct {
@@ -39,3 +40,30 @@ func (uc *ImageUsecase) CreateImage(ctx context.Context, req dto.CreateImage) (d
 	response, _ := common.TypeConverter[dto.ImageResponse](image)
 	return response, nil
 }
+
+// GetImageJobs lists the processing jobs of an image owned by the current
+// user, oldest first, starting after the job afterId. A page holds at most
+// processingJobsLimit jobs.
+func (uc *ImageUsecase) GetImageJobs(ctx context.Context, id, afterId, limit int) ([]dto.ProcessingJobResponse, error) {
+	image, err := uc.repo.GetImageByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if image.UserId != userId {
+		return nil, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+
+	if limit <= 0 || limit > processingJobsLimit {
+		limit = processingJobsLimit
+	}
+	jobs, err := uc.repo.GetImageJobs(ctx, id, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]dto.ProcessingJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		response = append(response, toProcessingJobResponse(job))
+	}
+	return response, nil
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"gorm.io/gorm"
+)
+
+type memoryImageRepository struct {
+	repository.ImageRepository
+	image models.Image
+}
+
+func (r *memoryImageRepository) GetImageByID(ctx context.Context, id int) (models.Image, error) {
+	if r.image.Id != id {
+		return models.Image{}, gorm.ErrRecordNotFound
+	}
+	return r.image, nil
+}
+
+func (r *memoryImageRepository) GetImageJobs(ctx context.Context, imageId, afterId, limit int) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	for _, job := range r.image.ProcessingJobs {
+		if job.Id > afterId && len(jobs) < limit {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func TestGetImageJobs(t *testing.T) {
+	image := models.Image{Id: 1, UserId: 1}
+	for id := 1; id <= processingJobsLimit+1; id++ {
+		image.ProcessingJobs = append(image.ProcessingJobs, models.ProcessingJob{Id: id})
+	}
+	tests := []struct {
+		name        string
+		userId      int
+		afterId     int
+		limit       int
+		wantFirst   int
+		wantCount   int
+		wantMessage string
+	}{
+		{name: "first page", userId: 1, limit: 2, wantFirst: 1, wantCount: 2},
+		{name: "after a job", userId: 1, afterId: 2, limit: 2, wantFirst: 3, wantCount: 2},
+		{name: "default limit", userId: 1, wantFirst: 1, wantCount: processingJobsLimit},
+		{name: "limit above the maximum", userId: 1, limit: processingJobsLimit + 1, wantFirst: 1, wantCount: processingJobsLimit},
+		{name: "image of another user", userId: 2, wantMessage: service_errors.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewImageUsecase(&config.Config{}, &memoryImageRepository{image: image})
+			jobs, err := uc.GetImageJobs(userContext(tt.userId), image.Id, tt.afterId, tt.limit)
+			if got := endUserMessage(err); got != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if len(jobs) != tt.wantCount {
+				t.Fatalf("%d jobs, want %d", len(jobs), tt.wantCount)
+			}
+			if len(jobs) > 0 && jobs[0].Id != tt.wantFirst {
+				t.Errorf("page starts at job %d, want %d", jobs[0].Id, tt.wantFirst)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+)
+
+func toProcessingJobResponse(job models.ProcessingJob) dto.ProcessingJobResponse {
+	response := dto.ProcessingJobResponse{
+		Id:             job.Id,
+		ImageId:        job.ImageId,
+		ProcessingType: job.ProcessingType,
+		Parameters:     job.Parameters,
+		Status:         job.Status,
+		Priority:       job.Priority,
+		ErrorMessage:   job.ErrorMessage.String,
+		BatchId:        int(job.BatchId.Int64),
+		RunAt:          nullTimeToPtr(job.RunAt),
+		StartedAt:      nullTimeToPtr(job.StartedAt),
+		CompletedAt:    nullTimeToPtr(job.CompletedAt),
+		Duration:       job.Duration.Int64,
+		RetryCount:     job.RetryCount,
+		CallbackUrl:    job.CallbackUrl.String,
+		CreatedAt:      job.CreatedAt,
+	}
+	if job.Result != nil {
+		response.Result = &dto.ProcessingResultResponse{
+			FileSize: job.Result.FileSize,
+			Width:    job.Result.Width,
+			Height:   job.Result.Height,
+			MimeType: job.Result.MimeType,
+		}
+	}
+	return response
+}
+
+func toProcessingBatchResponse(batch models.ProcessingBatch, counts []models.ProcessingBatchCount, failed []models.ProcessingJob) dto.ProcessingBatchResponse {
+	response := dto.ProcessingBatchResponse{
+		Id:             batch.Id,
+		ProcessingType: batch.ProcessingType,
+		Parameters:     batch.Parameters,
+		Priority:       batch.Priority,
+		Total:          batch.Total,
+		CreatedAt:      batch.CreatedAt,
+		Failures:       make([]dto.ProcessingBatchFailure, 0, len(failed)),
+	}
+	for _, count := range counts {
+		switch count.Status {
+		case models.ImageStatusScheduled:
+			response.Scheduled = count.Count
+		case models.ImageStatusPending:
+			response.Pending = count.Count
+		case models.ImageStatusProcessing:
+			response.Processing = count.Count
+		case models.ImageStatusCompleted:
+			response.Completed = count.Count
+		case models.ImageStatusFailed:
+			response.Failed = count.Count
+		case models.ImageStatusCancelled:
+			response.Cancelled = count.Count
+		}
+	}
+	finished := response.Completed + response.Failed + response.Cancelled
+	if batch.Total > 0 {
+		response.Progress = finished * 100 / batch.Total
+	}
+	response.Finished = finished >= batch.Total
+	for _, job := range failed {
+		response.Failures = append(response.Failures, dto.ProcessingBatchFailure{
+			JobId:        job.Id,
+			ImageId:      job.ImageId,
+			ErrorMessage: job.ErrorMessage.String,
+		})
+	}
+	return response
+}
+
+func toPresetResponse(preset models.ProcessingPreset) dto.PresetResponse {
+	return dto.PresetResponse{
+		Id:             preset.Id,
+		Name:           preset.Name,
+		Description:    preset.Description.String,
+		ProcessingType: preset.ProcessingType,
+		Parameters:     preset.Parameters,
+		Global:         !preset.UserId.Valid,
+		CreatedAt:      preset.CreatedAt,
+		ModifiedAt:     nullTimeToPtr(preset.ModifiedAt),
+	}
+}
+
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func toWebhookSettingResponse(setting models.WebhookSetting) dto.WebhookSettingResponse {
+	return dto.WebhookSettingResponse{
+		CallbackUrl: setting.CallbackUrl.String,
+		Secret:      setting.Secret,
+		CreatedAt:   setting.CreatedAt,
+		ModifiedAt:  nullTimeToPtr(setting.ModifiedAt),
+	}
+}
+
+func toWebhookDeliveryResponse(delivery models.WebhookDelivery) dto.WebhookDeliveryResponse {
+	response := dto.WebhookDeliveryResponse{
+		Id:            delivery.Id,
+		DeliveryId:    delivery.DeliveryId,
+		JobId:         delivery.ProcessingJobId,
+		Event:         delivery.Event,
+		Url:           delivery.Url,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		AttemptCount:  delivery.AttemptCount,
+		NextAttemptAt: nullTimeToPtr(delivery.NextAttemptAt),
+		DeliveredAt:   nullTimeToPtr(delivery.DeliveredAt),
+		CreatedAt:     delivery.CreatedAt,
+		Attempts:      make([]dto.WebhookDeliveryAttemptResponse, 0, len(delivery.Attempts)),
+	}
+	for _, attempt := range delivery.Attempts {
+		response.Attempts = append(response.Attempts, dto.WebhookDeliveryAttemptResponse{
+			StatusCode: int(attempt.StatusCode.Int64),
+			Error:      attempt.Error.String,
+			Duration:   attempt.Duration,
+			CreatedAt:  attempt.CreatedAt,
+		})
+	}
+	return response
+}
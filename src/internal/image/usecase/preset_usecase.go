@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"gorm.io/gorm"
+)
+
+type PresetUsecase struct {
+	cfg  *config.Config
+	repo repository.PresetRepository
+}
+
+func NewPresetUsecase(cfg *config.Config, repo repository.PresetRepository) *PresetUsecase {
+	return &PresetUsecase{
+		cfg:  cfg,
+		repo: repo,
+	}
+}
+
+// CreatePreset stores a preset of the current user, or a global one when an
+// admin asks for it
+func (uc *PresetUsecase) CreatePreset(ctx context.Context, req dto.SavePreset) (dto.PresetResponse, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if req.Global && !hasRole(ctx, constants.AdminRoleName) {
+		return dto.PresetResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+	if err := uc.validatePreset(req); err != nil {
+		return dto.PresetResponse{}, err
+	}
+	owner := sql.NullInt64{Int64: int64(userId), Valid: !req.Global}
+	if err := uc.ensureNameAvailable(ctx, owner, req.Name, 0); err != nil {
+		return dto.PresetResponse{}, err
+	}
+	preset, err := uc.repo.CreatePreset(ctx, models.ProcessingPreset{
+		Name:           req.Name,
+		UserId:         owner,
+		Description:    sql.NullString{String: req.Description, Valid: req.Description != ""},
+		ProcessingType: req.ProcessingType,
+		Parameters:     req.Parameters,
+		CreatedBy:      userId,
+	})
+	if err != nil {
+		return dto.PresetResponse{}, err
+	}
+	return toPresetResponse(preset), nil
+}
+
+// GetPresets lists the presets of the current user along with the global ones
+func (uc *PresetUsecase) GetPresets(ctx context.Context) ([]dto.PresetResponse, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	presets, err := uc.repo.GetPresets(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]dto.PresetResponse, 0, len(presets))
+	for _, preset := range presets {
+		response = append(response, toPresetResponse(preset))
+	}
+	return response, nil
+}
+
+func (uc *PresetUsecase) GetPreset(ctx context.Context, id int) (dto.PresetResponse, error) {
+	preset, err := uc.repo.GetPresetByID(ctx, id)
+	if err != nil {
+		return dto.PresetResponse{}, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if preset.UserId.Valid && int(preset.UserId.Int64) != userId {
+		return dto.PresetResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+	return toPresetResponse(preset), nil
+}
+
+// UpdatePreset replaces a preset. Whether it is global is fixed when it is
+// created. Jobs keep the parameters they were created with.
+func (uc *PresetUsecase) UpdatePreset(ctx context.Context, id int, req dto.SavePreset) (dto.PresetResponse, error) {
+	preset, err := uc.getEditablePreset(ctx, id)
+	if err != nil {
+		return dto.PresetResponse{}, err
+	}
+	if err := uc.validatePreset(req); err != nil {
+		return dto.PresetResponse{}, err
+	}
+	if err := uc.ensureNameAvailable(ctx, preset.UserId, req.Name, id); err != nil {
+		return dto.PresetResponse{}, err
+	}
+	_, err = uc.repo.UpdatePreset(ctx, id, map[string]interface{}{
+		"Name":           req.Name,
+		"Description":    sql.NullString{String: req.Description, Valid: req.Description != ""},
+		"ProcessingType": req.ProcessingType,
+		"Parameters":     req.Parameters,
+	})
+	if err != nil {
+		return dto.PresetResponse{}, err
+	}
+	return uc.GetPreset(ctx, id)
+}
+
+func (uc *PresetUsecase) DeletePreset(ctx context.Context, id int) error {
+	if _, err := uc.getEditablePreset(ctx, id); err != nil {
+		return err
+	}
+	return uc.repo.DeletePreset(ctx, id)
+}
+
+// ApplyPreset resolves the parameters of a job that refers to a preset: those
+// of the preset with the top-level keys of overrides replacing its own. The
+// job keeps the result, so later changes of the preset do not affect it.
+func (uc *PresetUsecase) ApplyPreset(ctx context.Context, name string, processingType models.ProcessingType, overrides map[string]interface{}) (models.ProcessingType, map[string]interface{}, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	preset, err := uc.repo.ResolvePreset(ctx, userId, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var errs entity.ValidationErrors
+		errs.Add("preset", "unknown preset %q", name)
+		return processingType, nil, errs
+	}
+	if err != nil {
+		return processingType, nil, err
+	}
+	if processingType != "" && processingType != preset.ProcessingType {
+		var errs entity.ValidationErrors
+		errs.Add("processing_type", "preset %q is a %s preset", name, preset.ProcessingType)
+		return processingType, nil, errs
+	}
+
+	parameters := make(map[string]interface{}, len(preset.Parameters)+len(overrides))
+	for k, v := range preset.Parameters {
+		parameters[k] = v
+	}
+	for k, v := range overrides {
+		parameters[k] = v
+	}
+	return preset.ProcessingType, parameters, nil
+}
+
+// getEditablePreset loads a preset the current user may change: their own,
+// or a global one for admins
+func (uc *PresetUsecase) getEditablePreset(ctx context.Context, id int) (models.ProcessingPreset, error) {
+	preset, err := uc.repo.GetPresetByID(ctx, id)
+	if err != nil {
+		return preset, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if preset.UserId.Valid && int(preset.UserId.Int64) == userId {
+		return preset, nil
+	}
+	if !preset.UserId.Valid && hasRole(ctx, constants.AdminRoleName) {
+		return preset, nil
+	}
+	return preset, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+}
+
+// ensureNameAvailable makes sure no other preset of the same owner has the name
+func (uc *PresetUsecase) ensureNameAvailable(ctx context.Context, owner sql.NullInt64, name string, id int) error {
+	existing, err := uc.repo.GetPresetByName(ctx, owner, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Id != id {
+		return &service_errors.ServiceError{EndUserMessage: service_errors.PresetExists}
+	}
+	return nil
+}
+
+// validatePreset checks the parameters of a preset. The images it will be
+// applied to are unknown, so crops are only checked against their bounds
+// once a job uses it.
+func (uc *PresetUsecase) validatePreset(req dto.SavePreset) error {
+	return validation.ValidateParameters(req.ProcessingType, req.Parameters, 0, 0, validation.NewLimits(uc.cfg))
+}
@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"gorm.io/gorm"
+)
+
+// memoryPresetRepository keeps presets in a slice, ids are their index plus one
+type memoryPresetRepository struct {
+	repository.PresetRepository
+	presets []models.ProcessingPreset
+}
+
+func (r *memoryPresetRepository) CreatePreset(ctx context.Context, preset models.ProcessingPreset) (models.ProcessingPreset, error) {
+	preset.Id = len(r.presets) + 1
+	r.presets = append(r.presets, preset)
+	return preset, nil
+}
+
+func (r *memoryPresetRepository) GetPresetByName(ctx context.Context, userId sql.NullInt64, name string) (models.ProcessingPreset, error) {
+	for _, preset := range r.presets {
+		if preset.UserId == userId && preset.Name == name {
+			return preset, nil
+		}
+	}
+	return models.ProcessingPreset{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryPresetRepository) ResolvePreset(ctx context.Context, userId int, name string) (models.ProcessingPreset, error) {
+	preset, err := r.GetPresetByName(ctx, sql.NullInt64{Int64: int64(userId), Valid: true}, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.GetPresetByName(ctx, sql.NullInt64{}, name)
+	}
+	return preset, err
+}
+
+func adminContext(userId int) context.Context {
+	return context.WithValue(userContext(userId), constants.RolesKey, []interface{}{constants.AdminRoleName})
+}
+
+func TestCreatePreset(t *testing.T) {
+	resize := map[string]interface{}{"width": 100, "height": 100}
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		req         dto.SavePreset
+		wantMessage string
+		wantInvalid bool
+	}{
+		{name: "own", ctx: userContext(1), req: dto.SavePreset{Name: "thumb", ProcessingType: models.ProcessingTypeResize, Parameters: resize}},
+		{name: "global by admin", ctx: adminContext(1), req: dto.SavePreset{Name: "thumb", ProcessingType: models.ProcessingTypeResize, Parameters: resize, Global: true}},
+		{
+			name:        "global by user",
+			ctx:         userContext(1),
+			req:         dto.SavePreset{Name: "thumb", ProcessingType: models.ProcessingTypeResize, Parameters: resize, Global: true},
+			wantMessage: service_errors.PermissionDenied,
+		},
+		{
+			name:        "name taken",
+			ctx:         userContext(2),
+			req:         dto.SavePreset{Name: "taken", ProcessingType: models.ProcessingTypeResize, Parameters: resize},
+			wantMessage: service_errors.PresetExists,
+		},
+		{
+			name:        "invalid parameters",
+			ctx:         userContext(1),
+			req:         dto.SavePreset{Name: "thumb", ProcessingType: models.ProcessingTypeResize},
+			wantInvalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memoryPresetRepository{presets: []models.ProcessingPreset{
+				{Id: 1, Name: "taken", UserId: sql.NullInt64{Int64: 2, Valid: true}},
+			}}
+			uc := NewPresetUsecase(&config.Config{}, repo)
+
+			response, err := uc.CreatePreset(tt.ctx, tt.req)
+			var invalid entity.ValidationErrors
+			if errors.As(err, &invalid) != tt.wantInvalid || endUserMessage(err) != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if err != nil {
+				if len(repo.presets) != 1 {
+					t.Errorf("preset stored despite %v", err)
+				}
+				return
+			}
+			if response.Global != tt.req.Global || repo.presets[1].UserId.Valid == tt.req.Global {
+				t.Errorf("preset %+v stored with user %v, want global %v", response, repo.presets[1].UserId, tt.req.Global)
+			}
+		})
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	repo := &memoryPresetRepository{presets: []models.ProcessingPreset{
+		{Id: 1, Name: "thumb", ProcessingType: models.ProcessingTypeResize, Parameters: map[string]interface{}{"width": 100, "height": 100}},
+		{Id: 2, Name: "thumb", UserId: sql.NullInt64{Int64: 1, Valid: true}, ProcessingType: models.ProcessingTypeResize, Parameters: map[string]interface{}{"width": 50, "height": 50}},
+	}}
+	uc := NewPresetUsecase(&config.Config{}, repo)
+	tests := []struct {
+		name           string
+		userId         int
+		preset         string
+		processingType models.ProcessingType
+		overrides      map[string]interface{}
+		want           map[string]interface{}
+		wantInvalid    bool
+	}{
+		{name: "global", userId: 2, preset: "thumb", want: map[string]interface{}{"width": 100, "height": 100}},
+		{name: "own before global", userId: 1, preset: "thumb", want: map[string]interface{}{"width": 50, "height": 50}},
+		{
+			name:      "overrides replace top-level keys",
+			userId:    2,
+			preset:    "thumb",
+			overrides: map[string]interface{}{"width": 200, "format": "png"},
+			want:      map[string]interface{}{"width": 200, "height": 100, "format": "png"},
+		},
+		{name: "unknown", userId: 2, preset: "missing", wantInvalid: true},
+		{name: "other type", userId: 2, preset: "thumb", processingType: models.ProcessingTypeCrop, wantInvalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processingType, parameters, err := uc.ApplyPreset(userContext(tt.userId), tt.preset, tt.processingType, tt.overrides)
+			var invalid entity.ValidationErrors
+			if errors.As(err, &invalid) != tt.wantInvalid {
+				t.Fatalf("error %v, want validation errors %v", err, tt.wantInvalid)
+			}
+			if tt.wantInvalid {
+				return
+			}
+			if processingType != models.ProcessingTypeResize || !reflect.DeepEqual(parameters, tt.want) {
+				t.Errorf("got %s %v, want resize %v", processingType, parameters, tt.want)
+			}
+		})
+	}
+	if repo.presets[0].Parameters["width"] != 100 {
+		t.Errorf("overrides changed the preset: %v", repo.presets[0].Parameters)
+	}
+}
@@ -0,0 +1,214 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+)
+
+// CreateProcessingBatch creates one job per image of the request, all with the
+// same processing. Images that cannot be processed are reported as rejected
+// while the jobs of the others are created, the request only fails when no
+// image is left.
+func (uc *ProcessingUsecase) CreateProcessingBatch(ctx context.Context, req dto.ProcessingBatchRequest) (dto.ProcessingBatchResponse, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	var err error
+	if req.Preset != "" {
+		req.ProcessingType, req.Parameters, err = uc.presets.ApplyPreset(ctx, req.Preset, req.ProcessingType, req.Parameters)
+		if err != nil {
+			return dto.ProcessingBatchResponse{}, err
+		}
+	}
+	images, rejected, err := uc.batchImages(ctx, userId, req)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	req.Priority, err = uc.resolvePriority(ctx, req.Priority)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	runAt, err := uc.resolveRunAt(req.RunAt, req.Delay)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	callbackUrl, err := uc.webhooks.ResolveCallbackUrl(ctx, req.CallbackUrl)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+
+	status := models.ImageStatusPending
+	if runAt.Valid {
+		status = models.ImageStatusScheduled
+	}
+	imagesById := make(map[int]models.Image, len(images))
+	jobs := make([]models.ProcessingJob, 0, len(images))
+	for _, image := range images {
+		// The parameters are checked against every image, e.g. a crop may fit some but not others
+		if err := validation.ValidateParameters(req.ProcessingType, req.Parameters, image.Width, image.Height, validation.NewLimits(uc.cfg)); err != nil {
+			rejected = append(rejected, dto.ProcessingBatchRejection{ImageId: image.Id, Error: err.Error()})
+			continue
+		}
+		imagesById[image.Id] = image
+		jobs = append(jobs, models.ProcessingJob{
+			ImageId:        image.Id,
+			ProcessingType: req.ProcessingType,
+			Parameters:     req.Parameters,
+			Status:         status,
+			Priority:       req.Priority,
+			CallbackUrl:    sql.NullString{String: callbackUrl, Valid: callbackUrl != ""},
+			RunAt:          runAt,
+			CreatedBy:      userId,
+		})
+	}
+	if len(jobs) == 0 {
+		var errs entity.ValidationErrors
+		for _, rejection := range rejected {
+			errs.Add("image_ids", "image %d: %s", rejection.ImageId, rejection.Error)
+		}
+		if len(errs) == 0 {
+			errs.Add("filter", "matches no image")
+		}
+		return dto.ProcessingBatchResponse{}, errs
+	}
+
+	batch, err := uc.repo.CreateProcessingBatch(ctx, models.ProcessingBatch{
+		UserId:         userId,
+		ProcessingType: req.ProcessingType,
+		Parameters:     req.Parameters,
+		Priority:       req.Priority,
+		Total:          len(jobs),
+		CreatedBy:      userId,
+	}, jobs, func(job models.ProcessingJob) (models.OutboxMessage, error) {
+		job.Image = imagesById[job.ImageId]
+		return uc.newProcessingMessage(&job)
+	})
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	response, err := uc.processingBatchResponse(ctx, batch)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	response.Rejected = rejected
+	return response, nil
+}
+
+// GetProcessingBatch returns the progress of an owned batch along with its failed jobs
+func (uc *ProcessingUsecase) GetProcessingBatch(ctx context.Context, id int) (dto.ProcessingBatchResponse, error) {
+	batch, err := uc.getOwnedProcessingBatch(ctx, id)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	return uc.processingBatchResponse(ctx, batch)
+}
+
+// CancelProcessingBatch cancels every job of a batch that has not finished yet
+func (uc *ProcessingUsecase) CancelProcessingBatch(ctx context.Context, id int) (dto.ProcessingBatchResponse, error) {
+	if _, err := uc.getOwnedProcessingBatch(ctx, id); err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	cancelled, err := uc.repo.CancelProcessingBatch(ctx, id)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	if len(cancelled) == 0 {
+		return dto.ProcessingBatchResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.BatchAlreadyFinished}
+	}
+	for _, jobId := range cancelled {
+		uc.events.Publish(jobId, dto.ProcessingJobEvent{
+			JobId:     jobId,
+			Status:    models.ImageStatusCancelled,
+			Timestamp: time.Now().UTC(),
+		})
+	}
+	return uc.GetProcessingBatch(ctx, id)
+}
+
+// batchImages loads the images of a batch request. Requested images that do
+// not exist or belong to another user are rejected, a filter only matches the
+// images of the current user.
+func (uc *ProcessingUsecase) batchImages(ctx context.Context, userId int, req dto.ProcessingBatchRequest) ([]models.Image, []dto.ProcessingBatchRejection, error) {
+	tooLarge := &service_errors.ServiceError{EndUserMessage: service_errors.BatchTooLarge}
+	if len(req.ImageIds) == 0 && req.Filter != nil {
+		images, err := uc.imageRepo.FindImages(ctx, userId, repository.ImageFilter{
+			MimeType:      req.Filter.MimeType,
+			CreatedAfter:  req.Filter.CreatedAfter,
+			CreatedBefore: req.Filter.CreatedBefore,
+		}, uc.cfg.Processing.MaxBatchSize+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(images) > uc.cfg.Processing.MaxBatchSize {
+			return nil, nil, tooLarge
+		}
+		return images, nil, nil
+	}
+
+	ids := make([]int, 0, len(req.ImageIds))
+	seen := make(map[int]bool, len(req.ImageIds))
+	for _, id := range req.ImageIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > uc.cfg.Processing.MaxBatchSize {
+		return nil, nil, tooLarge
+	}
+	found, err := uc.imageRepo.GetImagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	byId := make(map[int]models.Image, len(found))
+	for _, image := range found {
+		byId[image.Id] = image
+	}
+
+	images := make([]models.Image, 0, len(ids))
+	var rejected []dto.ProcessingBatchRejection
+	for _, id := range ids {
+		image, ok := byId[id]
+		switch {
+		case !ok:
+			rejected = append(rejected, dto.ProcessingBatchRejection{ImageId: id, Error: service_errors.RecordNotFound})
+		case image.UserId != userId:
+			rejected = append(rejected, dto.ProcessingBatchRejection{ImageId: id, Error: service_errors.PermissionDenied})
+		default:
+			images = append(images, image)
+		}
+	}
+	return images, rejected, nil
+}
+
+// getOwnedProcessingBatch loads a batch and makes sure it belongs to the current user
+func (uc *ProcessingUsecase) getOwnedProcessingBatch(ctx context.Context, id int) (models.ProcessingBatch, error) {
+	batch, err := uc.repo.GetProcessingBatchByID(ctx, id)
+	if err != nil {
+		return batch, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if batch.UserId != userId {
+		return batch, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+	return batch, nil
+}
+
+func (uc *ProcessingUsecase) processingBatchResponse(ctx context.Context, batch models.ProcessingBatch) (dto.ProcessingBatchResponse, error) {
+	counts, err := uc.repo.CountProcessingBatchJobs(ctx, batch.Id)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	failed, err := uc.repo.GetProcessingBatchJobs(ctx, batch.Id, models.ImageStatusFailed, processingJobsLimit)
+	if err != nil {
+		return dto.ProcessingBatchResponse{}, err
+	}
+	return toProcessingBatchResponse(batch, counts, failed), nil
+}
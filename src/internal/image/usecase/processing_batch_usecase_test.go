@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/webhook"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/events"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"gorm.io/gorm"
+)
+
+// memoryBatchRepository holds a single batch and its jobs
+type memoryBatchRepository struct {
+	repository.ProcessingRepository
+	batch    models.ProcessingBatch
+	jobs     []models.ProcessingJob
+	messages []models.OutboxMessage
+}
+
+func (r *memoryBatchRepository) CreateProcessingBatch(ctx context.Context, batch models.ProcessingBatch, jobs []models.ProcessingJob, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (models.ProcessingBatch, error) {
+	batch.Id = 1
+	for i := range jobs {
+		jobs[i].Id = i + 1
+		message, err := newMessage(jobs[i])
+		if err != nil {
+			return models.ProcessingBatch{}, err
+		}
+		r.messages = append(r.messages, message)
+	}
+	r.batch, r.jobs = batch, jobs
+	return batch, nil
+}
+
+func (r *memoryBatchRepository) GetProcessingBatchByID(ctx context.Context, id int) (models.ProcessingBatch, error) {
+	if r.batch.Id != id {
+		return models.ProcessingBatch{}, gorm.ErrRecordNotFound
+	}
+	return r.batch, nil
+}
+
+func (r *memoryBatchRepository) CountProcessingBatchJobs(ctx context.Context, batchId int) ([]models.ProcessingBatchCount, error) {
+	counts := map[models.ImageStatus]int{}
+	for _, job := range r.jobs {
+		counts[job.Status]++
+	}
+	var result []models.ProcessingBatchCount
+	for status, count := range counts {
+		result = append(result, models.ProcessingBatchCount{Status: status, Count: count})
+	}
+	return result, nil
+}
+
+func (r *memoryBatchRepository) GetProcessingBatchJobs(ctx context.Context, batchId int, status models.ImageStatus, limit int) ([]models.ProcessingJob, error) {
+	var jobs []models.ProcessingJob
+	for _, job := range r.jobs {
+		if job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (r *memoryBatchRepository) CancelProcessingBatch(ctx context.Context, batchId int) ([]int, error) {
+	var cancelled []int
+	for i := range r.jobs {
+		if !r.jobs[i].Status.IsFinal() {
+			r.jobs[i].Status = models.ImageStatusCancelled
+			cancelled = append(cancelled, r.jobs[i].Id)
+		}
+	}
+	return cancelled, nil
+}
+
+type memoryImagesRepository struct {
+	repository.ImageRepository
+	images []models.Image
+}
+
+func (r *memoryImagesRepository) GetImagesByIDs(ctx context.Context, ids []int) ([]models.Image, error) {
+	var images []models.Image
+	for _, image := range r.images {
+		for _, id := range ids {
+			if image.Id == id {
+				images = append(images, image)
+			}
+		}
+	}
+	return images, nil
+}
+
+func TestCreateProcessingBatch(t *testing.T) {
+	images := &memoryImagesRepository{images: []models.Image{
+		{Id: 1, UserId: 1, Width: 400, Height: 300},
+		{Id: 2, UserId: 1, Width: 40, Height: 30},
+		{Id: 3, UserId: 2, Width: 400, Height: 300},
+	}}
+	crop := map[string]interface{}{"x": 0, "y": 0, "width": 100, "height": 100}
+	tests := []struct {
+		name         string
+		imageIds     []int
+		wantJobs     int
+		wantRejected map[int]string // Error of every rejected image, empty for validation errors
+		wantInvalid  bool
+		wantMessage  string
+	}{
+		{
+			name:     "partially rejected",
+			imageIds: []int{1, 2, 3, 1, 99},
+			wantJobs: 1,
+			wantRejected: map[int]string{
+				2:  "",
+				3:  service_errors.PermissionDenied,
+				99: service_errors.RecordNotFound,
+			},
+		},
+		{name: "every image rejected", imageIds: []int{2, 3}, wantInvalid: true},
+		{name: "too large", imageIds: []int{1, 2, 3, 4, 5}, wantMessage: service_errors.BatchTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Processing: config.ProcessingConfig{MaxBatchSize: 4, DefaultPriority: 5, MaxUserPriority: 5}}
+			repo := &memoryBatchRepository{}
+			uc := NewProcessingUseCase(cfg, repo, images, events.NewHub[dto.ProcessingJobEvent](), NewWebhookUsecase(cfg, &memoryWebhookRepository{}, webhook.NewSender(cfg)), nil)
+
+			response, err := uc.CreateProcessingBatch(userContext(1), dto.ProcessingBatchRequest{
+				ImageIds:       tt.imageIds,
+				ProcessingType: models.ProcessingTypeCrop,
+				Parameters:     crop,
+				CallbackUrl:    "https://example.com/hook",
+			})
+			var invalid entity.ValidationErrors
+			if errors.As(err, &invalid) != tt.wantInvalid {
+				t.Fatalf("error %v, want validation errors %v", err, tt.wantInvalid)
+			}
+			if got := endUserMessage(err); got != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if len(repo.jobs) != tt.wantJobs || len(repo.messages) != tt.wantJobs {
+				t.Errorf("%d jobs and %d messages, want %d", len(repo.jobs), len(repo.messages), tt.wantJobs)
+			}
+			if len(response.Rejected) != len(tt.wantRejected) {
+				t.Fatalf("rejected %+v, want %v", response.Rejected, tt.wantRejected)
+			}
+			for _, rejection := range response.Rejected {
+				want, ok := tt.wantRejected[rejection.ImageId]
+				if !ok || (want != "" && rejection.Error != want) {
+					t.Errorf("image %d rejected with %q, want %q", rejection.ImageId, rejection.Error, want)
+				}
+			}
+			if tt.wantJobs > 0 && (response.Total != tt.wantJobs || response.Pending != tt.wantJobs) {
+				t.Errorf("batch %+v, want %d pending jobs", response, tt.wantJobs)
+			}
+		})
+	}
+}
+
+func TestCancelProcessingBatch(t *testing.T) {
+	repo := &memoryBatchRepository{
+		batch: models.ProcessingBatch{Id: 1, UserId: 1, Total: 3},
+		jobs: []models.ProcessingJob{
+			{Id: 1, Status: models.ImageStatusCompleted},
+			{Id: 2, Status: models.ImageStatusPending},
+			{Id: 3, Status: models.ImageStatusProcessing},
+		},
+	}
+	hub := events.NewHub[dto.ProcessingJobEvent]()
+	updates, unsubscribe := hub.Subscribe(2)
+	defer unsubscribe()
+	uc := NewProcessingUseCase(&config.Config{}, repo, nil, hub, nil, nil)
+
+	if _, err := uc.CancelProcessingBatch(userContext(2), 1); endUserMessage(err) != service_errors.PermissionDenied {
+		t.Fatalf("batch of another user cancelled with %v", err)
+	}
+	response, err := uc.CancelProcessingBatch(userContext(1), 1)
+	if err != nil {
+		t.Fatalf("CancelProcessingBatch: %v", err)
+	}
+	if response.Completed != 1 || response.Cancelled != 2 || response.Progress != 100 || !response.Finished {
+		t.Errorf("batch %+v, want one completed and two cancelled jobs", response)
+	}
+	if event := <-updates; event.Status != models.ImageStatusCancelled {
+		t.Errorf("event %+v, want cancelled", event)
+	}
+	if _, err := uc.CancelProcessingBatch(userContext(1), 1); endUserMessage(err) != service_errors.BatchAlreadyFinished {
+		t.Errorf("finished batch cancelled with %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/events"
+	"gorm.io/gorm"
+)
+
+// memoryProcessingRepository holds a single job and the results, webhook
+// deliveries and outbox messages stored for it. Its conditional updates behave like the Postgres
+// ones, beforeRecord lets a test change the job between reading it and
+// recording a result.
+type memoryProcessingRepository struct {
+	repository.ProcessingRepository
+	job          *models.ProcessingJob
+	beforeRecord func(job *models.ProcessingJob)
+	results      []models.ProcessingResult
+	deliveries   []models.WebhookDelivery
+	messages     []models.OutboxMessage
+}
+
+func (r *memoryProcessingRepository) CreateProcessingJob(ctx context.Context, job models.ProcessingJob, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (models.ProcessingJob, error) {
+	job.Id = 1
+	message, err := newMessage(job)
+	if err != nil {
+		return models.ProcessingJob{}, err
+	}
+	r.job = &job
+	r.messages = append(r.messages, message)
+	return job, nil
+}
+
+func (r *memoryProcessingRepository) GetProcessingJobByID(ctx context.Context, id int) (models.ProcessingJob, error) {
+	if r.job == nil || r.job.Id != id {
+		return models.ProcessingJob{}, gorm.ErrRecordNotFound
+	}
+	return *r.job, nil
+}
+
+func (r *memoryProcessingRepository) CancelProcessingJob(ctx context.Context, id int) (bool, error) {
+	if r.job.Status.IsFinal() {
+		return false, nil
+	}
+	r.job.Status = models.ImageStatusCancelled
+	return true, nil
+}
+
+func (r *memoryProcessingRepository) RecordProcessingResult(ctx context.Context, id int, attempt int, job map[string]interface{}, result *models.ProcessingResult, delivery *models.WebhookDelivery) (bool, error) {
+	if r.beforeRecord != nil {
+		r.beforeRecord(r.job)
+	}
+	if r.job == nil || r.job.Id != id || r.job.Status.IsFinal() || r.job.RetryCount > attempt {
+		return false, nil
+	}
+	r.job.Status = job["Status"].(models.ImageStatus)
+	r.job.RetryCount = job["RetryCount"].(int)
+	if deadline, ok := job["DeadlineAt"].(sql.NullTime); ok {
+		r.job.DeadlineAt = deadline
+	}
+	if result != nil {
+		r.results = append(r.results, *result)
+	}
+	if delivery != nil {
+		r.deliveries = append(r.deliveries, *delivery)
+	}
+	return true, nil
+}
+
+func TestHandleProcessingResult(t *testing.T) {
+	cancel := func(job *models.ProcessingJob) { job.Status = models.ImageStatusCancelled }
+	tests := []struct {
+		name           string
+		status         models.ImageStatus // Of the job when the result arrives
+		retryCount     int
+		beforeRecord   func(job *models.ProcessingJob)
+		result         entity.ProcessingResult
+		wantStatus     models.ImageStatus
+		wantEvent      bool
+		wantResult     bool
+		wantDeliveries int
+	}{
+		{
+			name:       "started",
+			status:     models.ImageStatusPending,
+			result:     entity.ProcessingResult{Status: models.ImageStatusProcessing},
+			wantStatus: models.ImageStatusProcessing,
+			wantEvent:  true,
+		},
+		{
+			name:       "progress is only streamed",
+			status:     models.ImageStatusProcessing,
+			result:     entity.ProcessingResult{Status: models.ImageStatusProcessing, Progress: 50, RetryCount: 1},
+			wantStatus: models.ImageStatusProcessing,
+			wantEvent:  true,
+		},
+		{
+			name:           "completed",
+			status:         models.ImageStatusProcessing,
+			result:         entity.ProcessingResult{Status: models.ImageStatusCompleted, ResultPath: "out.png", Metadata: map[string]interface{}{"width": 10, "height": 10}},
+			wantStatus:     models.ImageStatusCompleted,
+			wantEvent:      true,
+			wantResult:     true,
+			wantDeliveries: 1,
+		},
+		{
+			name:           "failed",
+			status:         models.ImageStatusProcessing,
+			result:         entity.ProcessingResult{Status: models.ImageStatusFailed, ErrorMessage: "broken"},
+			wantStatus:     models.ImageStatusFailed,
+			wantEvent:      true,
+			wantDeliveries: 1,
+		},
+		{
+			name:       "late start of a finished job",
+			status:     models.ImageStatusCompleted,
+			result:     entity.ProcessingResult{Status: models.ImageStatusProcessing},
+			wantStatus: models.ImageStatusCompleted,
+		},
+		{
+			name:       "result of a cancelled job",
+			status:     models.ImageStatusCancelled,
+			result:     entity.ProcessingResult{Status: models.ImageStatusCompleted, ResultPath: "out.png"},
+			wantStatus: models.ImageStatusCancelled,
+		},
+		{
+			name:         "cancelled while the result is recorded",
+			status:       models.ImageStatusProcessing,
+			beforeRecord: cancel,
+			result:       entity.ProcessingResult{Status: models.ImageStatusCompleted, ResultPath: "out.png"},
+			wantStatus:   models.ImageStatusCancelled,
+		},
+		{
+			name:         "cancelled while the start is recorded",
+			status:       models.ImageStatusPending,
+			beforeRecord: cancel,
+			result:       entity.ProcessingResult{Status: models.ImageStatusProcessing},
+			wantStatus:   models.ImageStatusCancelled,
+		},
+		{
+			name:       "duplicate result",
+			status:     models.ImageStatusCompleted,
+			result:     entity.ProcessingResult{Status: models.ImageStatusFailed, ErrorMessage: "late"},
+			wantStatus: models.ImageStatusCompleted,
+		},
+		{
+			name:       "attempt failed and is retried",
+			status:     models.ImageStatusProcessing,
+			result:     entity.ProcessingResult{Status: models.ImageStatusPending, ErrorMessage: "broken"},
+			wantStatus: models.ImageStatusPending,
+			wantEvent:  true,
+		},
+		{
+			name:       "late start of a retried attempt",
+			status:     models.ImageStatusPending,
+			retryCount: 1,
+			result:     entity.ProcessingResult{Status: models.ImageStatusProcessing},
+			wantStatus: models.ImageStatusPending,
+		},
+		{
+			name:       "start of the retry",
+			status:     models.ImageStatusPending,
+			retryCount: 1,
+			result:     entity.ProcessingResult{Status: models.ImageStatusProcessing, RetryCount: 1},
+			wantStatus: models.ImageStatusProcessing,
+			wantEvent:  true,
+		},
+		{
+			name:       "unexpected status",
+			status:     models.ImageStatusProcessing,
+			result:     entity.ProcessingResult{Status: models.ImageStatusScheduled},
+			wantStatus: models.ImageStatusProcessing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &models.ProcessingJob{
+				Id:          1,
+				ImageId:     1,
+				Image:       models.Image{Id: 1, UserId: 1},
+				Status:      tt.status,
+				RetryCount:  tt.retryCount,
+				CallbackUrl: sql.NullString{String: "https://example.com/hook", Valid: true},
+			}
+			repo := &memoryProcessingRepository{job: job, beforeRecord: tt.beforeRecord}
+			hub := events.NewHub[dto.ProcessingJobEvent]()
+			updates, unsubscribe := hub.Subscribe(job.Id)
+			defer unsubscribe()
+			cfg := &config.Config{}
+			uc := NewProcessingUseCase(cfg, repo, nil, hub, NewWebhookUsecase(cfg, &memoryWebhookRepository{}, nil), nil)
+
+			result := tt.result
+			result.JobId = job.Id
+			result.UserId = 1
+			result.ProcessedAt = time.Now().UTC()
+			if err := uc.HandleProcessingResult(context.Background(), &result); err != nil {
+				t.Fatalf("HandleProcessingResult: %v", err)
+			}
+
+			if job.Status != tt.wantStatus {
+				t.Errorf("job status %s, want %s", job.Status, tt.wantStatus)
+			}
+			select {
+			case event := <-updates:
+				if !tt.wantEvent {
+					t.Errorf("unexpected event %+v", event)
+				} else if event.Status != tt.result.Status {
+					t.Errorf("event status %s, want %s", event.Status, tt.result.Status)
+				}
+			default:
+				if tt.wantEvent {
+					t.Error("no event published")
+				}
+			}
+			if got := len(repo.results) > 0; got != tt.wantResult {
+				t.Errorf("result stored %v, want %v", got, tt.wantResult)
+			}
+			if len(repo.deliveries) != tt.wantDeliveries {
+				t.Errorf("%d webhook deliveries, want %d", len(repo.deliveries), tt.wantDeliveries)
+			}
+		})
+	}
+}
+
+func TestHandleProcessingResultUnknownJob(t *testing.T) {
+	uc := NewProcessingUseCase(&config.Config{}, &memoryProcessingRepository{}, nil, events.NewHub[dto.ProcessingJobEvent](), nil, nil)
+	result := &entity.ProcessingResult{JobId: 1, UserId: 1, Status: models.ImageStatusCompleted}
+	if err := uc.HandleProcessingResult(context.Background(), result); err != nil {
+		t.Fatalf("result of an unknown job returned %v, want it dropped", err)
+	}
+}
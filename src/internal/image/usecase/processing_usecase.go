@@ -2,6 +2,11 @@ package usecase
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
 	"time"
 
 	"github.com/alielmi98/image-processing-service/common"
@@ -11,32 +16,83 @@ import (
 	"github.com/alielmi98/image-processing-service/internal/image/entity"
 	"github.com/alielmi98/image-processing-service/internal/image/infra/messaging"
 	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
 	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/events"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"gorm.io/gorm"
 )
 
+const processingJobsLimit = 100
+
 type ProcessingUsecase struct {
 	cfg       *config.Config
 	repo      repository.ProcessingRepository
-	messaging *messaging.MessageSender
+	imageRepo repository.ImageRepository
+	events    events.Bus[dto.ProcessingJobEvent]
+	webhooks  *WebhookUsecase
+	presets   *PresetUsecase
 }
 
-func NewProcessingUseCase(cfg *config.Config, repo repository.ProcessingRepository, messaging *messaging.MessageSender) *ProcessingUsecase {
+func NewProcessingUseCase(cfg *config.Config, repo repository.ProcessingRepository, imageRepo repository.ImageRepository, events events.Bus[dto.ProcessingJobEvent], webhooks *WebhookUsecase, presets *PresetUsecase) *ProcessingUsecase {
 	return &ProcessingUsecase{
 		cfg:       cfg,
 		repo:      repo,
-		messaging: messaging,
+		imageRepo: imageRepo,
+		events:    events,
+		webhooks:  webhooks,
+		presets:   presets,
 	}
 }
 
 func (uc *ProcessingUsecase) CreateProcessingJob(ctx context.Context, req dto.ProcessingRequest) (dto.ProcessingResponse, error) {
-	// Map DTO to domain model
-	entity, _ := common.TypeConverter[models.ProcessingJob](req)
-	// Call repository to save image
-	processingJob, err := uc.repo.CreateProcessingJob(ctx, entity)
+	image, err := uc.imageRepo.GetImageByID(ctx, req.ImageId)
+	if err != nil {
+		return dto.ProcessingResponse{}, err
+	}
+	if image.UserId != int(ctx.Value(constants.UserIdKey).(float64)) {
+		return dto.ProcessingResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+	if req.Preset != "" {
+		req.ProcessingType, req.Parameters, err = uc.presets.ApplyPreset(ctx, req.Preset, req.ProcessingType, req.Parameters)
+		if err != nil {
+			return dto.ProcessingResponse{}, err
+		}
+	}
+	// Reject invalid parameters here so they never reach the queue
+	if err := validation.ValidateParameters(req.ProcessingType, req.Parameters, image.Width, image.Height, validation.NewLimits(uc.cfg)); err != nil {
+		return dto.ProcessingResponse{}, err
+	}
+	req.Priority, err = uc.resolvePriority(ctx, req.Priority)
+	if err != nil {
+		return dto.ProcessingResponse{}, err
+	}
+	runAt, err := uc.resolveRunAt(req.RunAt, req.Delay)
+	if err != nil {
+		return dto.ProcessingResponse{}, err
+	}
+	callbackUrl, err := uc.webhooks.ResolveCallbackUrl(ctx, req.CallbackUrl)
 	if err != nil {
 		return dto.ProcessingResponse{}, err
 	}
-	err = uc.SendProcessingMessage(ctx, &processingJob)
+	// Map DTO to domain model
+	entity := models.ProcessingJob{
+		ImageId:        req.ImageId,
+		ProcessingType: req.ProcessingType,
+		Parameters:     req.Parameters,
+		Priority:       req.Priority,
+		CallbackUrl:    sql.NullString{String: callbackUrl, Valid: callbackUrl != ""},
+		RunAt:          runAt,
+	}
+	// Scheduled jobs wait in the database until the scheduler queues them
+	if runAt.Valid {
+		entity.Status = models.ImageStatusScheduled
+	}
+	// The job is queued through the outbox, so it is accepted while the broker is down
+	processingJob, err := uc.repo.CreateProcessingJob(ctx, entity, func(job models.ProcessingJob) (models.OutboxMessage, error) {
+		job.Image = image
+		return uc.newProcessingMessage(&job)
+	})
 	if err != nil {
 		return dto.ProcessingResponse{}, err
 	}
@@ -47,28 +103,387 @@ func (uc *ProcessingUsecase) CreateProcessingJob(ctx context.Context, req dto.Pr
 	return response, nil
 }
 
-func (uc *ProcessingUsecase) SendProcessingMessage(ctx context.Context, job *models.ProcessingJob) error {
+func (uc *ProcessingUsecase) GetProcessingJob(ctx context.Context, id int) (dto.ProcessingJobResponse, error) {
+	job, err := uc.getOwnedProcessingJob(ctx, id)
+	if err != nil {
+		return dto.ProcessingJobResponse{}, err
+	}
+	return toProcessingJobResponse(job), nil
+}
+
+// GetProcessingJobs lists the latest jobs of the current user, optionally only
+// those in one status
+func (uc *ProcessingUsecase) GetProcessingJobs(ctx context.Context, status models.ImageStatus) ([]dto.ProcessingJobResponse, error) {
 	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	jobs, err := uc.repo.GetProcessingJobs(ctx, userId, status, processingJobsLimit)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]dto.ProcessingJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		response = append(response, toProcessingJobResponse(job))
+	}
+	return response, nil
+}
+
+func (uc *ProcessingUsecase) GetProcessingResultFile(ctx context.Context, id int) (dto.ProcessingResultFile, error) {
+	job, err := uc.getOwnedProcessingJob(ctx, id)
+	if err != nil {
+		return dto.ProcessingResultFile{}, err
+	}
+	if job.Status != models.ImageStatusCompleted || !job.ResultPath.Valid {
+		return dto.ProcessingResultFile{}, &service_errors.ServiceError{EndUserMessage: service_errors.ResultNotReady}
+	}
+
+	file := dto.ProcessingResultFile{
+		Path:     job.ResultPath.String,
+		FileName: filepath.Base(job.ResultPath.String),
+	}
+	if job.Result != nil {
+		file.MimeType = job.Result.MimeType
+	}
+	return file, nil
+}
+
+// CancelProcessingJob cancels a scheduled, pending or running job. Scheduled
+// jobs are never queued, workers skip cancelled jobs when they are dequeued and
+// abort them while they run.
+func (uc *ProcessingUsecase) CancelProcessingJob(ctx context.Context, id int) (dto.ProcessingJobResponse, error) {
+	job, err := uc.getOwnedProcessingJob(ctx, id)
+	if err != nil {
+		return dto.ProcessingJobResponse{}, err
+	}
+	if job.Status.IsFinal() {
+		return dto.ProcessingJobResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.JobAlreadyFinished}
+	}
+	cancelled, err := uc.repo.CancelProcessingJob(ctx, id)
+	if err != nil {
+		return dto.ProcessingJobResponse{}, err
+	}
+	// The job finished between loading and cancelling it
+	if !cancelled {
+		return dto.ProcessingJobResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.JobAlreadyFinished}
+	}
+	uc.events.Publish(id, dto.ProcessingJobEvent{
+		JobId:     id,
+		Status:    models.ImageStatusCancelled,
+		Timestamp: time.Now().UTC(),
+	})
+	return uc.GetProcessingJob(ctx, id)
+}
+
+// SubscribeProcessingJob returns the current state of an owned job along with
+// the events of its later transitions. unsubscribe must be called once the
+// caller stops reading.
+func (uc *ProcessingUsecase) SubscribeProcessingJob(ctx context.Context, id int) (current dto.ProcessingJobEvent, updates <-chan dto.ProcessingJobEvent, unsubscribe func(), err error) {
+	// Subscribe before loading the job so no transition is missed in between
+	updates, unsubscribe = uc.events.Subscribe(id)
+	job, err := uc.getOwnedProcessingJob(ctx, id)
+	if err != nil {
+		unsubscribe()
+		return current, nil, nil, err
+	}
+
+	current = dto.ProcessingJobEvent{
+		JobId:        job.Id,
+		Status:       job.Status,
+		ErrorMessage: job.ErrorMessage.String,
+		Timestamp:    job.CreatedAt,
+	}
+	if job.ModifiedAt.Valid {
+		current.Timestamp = job.ModifiedAt.Time
+	}
+	if job.Status == models.ImageStatusCompleted {
+		current.Progress = 100
+	}
+	return current, updates, unsubscribe, nil
+}
+
+// resolvePriority applies the default priority and keeps the highest
+// priorities for admins, so bulk jobs cannot crowd out interactive ones
+func (uc *ProcessingUsecase) resolvePriority(ctx context.Context, priority int) (int, error) {
+	if priority == 0 {
+		priority = uc.cfg.Processing.DefaultPriority
+	}
+	if priority > uc.cfg.Processing.MaxUserPriority && !hasRole(ctx, constants.AdminRoleName) {
+		return 0, &service_errors.ServiceError{EndUserMessage: service_errors.PriorityNotAllowed}
+	}
+	return min(max(priority, entity.MinPriority), entity.MaxPriority), nil
+}
+
+// resolveRunAt returns when a job is to be queued, either at runAt or after
+// delay. It is null when the job is queued right away, which includes run
+// times that have already passed.
+func (uc *ProcessingUsecase) resolveRunAt(runAt *time.Time, delay time.Duration) (sql.NullTime, error) {
+	now := time.Now().UTC()
+	at := now.Add(delay)
+	if runAt != nil {
+		at = runAt.UTC()
+	}
+	if !at.After(now) {
+		return sql.NullTime{}, nil
+	}
+	if limit := uc.cfg.Processing.MaxScheduleAhead; limit > 0 && at.Sub(now) > limit {
+		return sql.NullTime{}, &service_errors.ServiceError{EndUserMessage: service_errors.ScheduleTooFar}
+	}
+	return sql.NullTime{Time: at, Valid: true}, nil
+}
+
+func hasRole(ctx context.Context, role string) bool {
+	roles, _ := ctx.Value(constants.RolesKey).([]interface{})
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// getOwnedProcessingJob loads a job and makes sure its image belongs to the current user
+func (uc *ProcessingUsecase) getOwnedProcessingJob(ctx context.Context, id int) (models.ProcessingJob, error) {
+	job, err := uc.repo.GetProcessingJobByID(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if job.Image.UserId != userId {
+		return job, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+	return job, nil
+}
+
+// newProcessingMessage builds the outbox message that queues a job, job.Image
+// must be loaded
+func (uc *ProcessingUsecase) newProcessingMessage(job *models.ProcessingJob) (models.OutboxMessage, error) {
 	message := &entity.ProcessingMessage{
 		JobId:          job.Id,
 		ImageId:        job.ImageId,
 		ProcessingType: job.ProcessingType,
 		Parameters:     job.Parameters,
-		UserId:         userId,
-		SourcePath:     "/uploads",
-		DestinationDir: "/uploads/processed",
-		Priority:       1,
+		UserId:         job.Image.UserId,
+		SourcePath:     filepath.Join(job.Image.FilePath, job.Image.FileName),
+		DestinationDir: filepath.Join(job.Image.FilePath, "processed"),
+		Priority:       job.Priority,
 		Timestamp:      time.Now(),
-		RetryCount:     0,
-		MaxRetries:     3,
+		RetryCount:     job.RetryCount,
+		MaxRetries:     uc.cfg.RabbitMQ.MaxRetries,
 	}
 
 	// Other fields as necessary
 
-	// Send message to processor via messaging system
-	return uc.messaging.SendMessage(ctx, message)
+	rabbitMsg, err := messaging.EncodeProcessingMessage(&uc.cfg.RabbitMQ, message)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+	return messaging.NewOutboxMessage(rabbitMsg), nil
 }
 
 func (uc *ProcessingUsecase) HandleProcessingResult(ctx context.Context, result *entity.ProcessingResult) error {
+	// Results are consumed outside of a request, so the job owner is the acting user
+	ctx = context.WithValue(ctx, constants.UserIdKey, float64(result.UserId))
+
+	job, err := uc.repo.GetProcessingJobByID(ctx, result.JobId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Caller:%s Level:%s Msg:result for unknown job %d dropped", constants.Internal, constants.UseCase, result.JobId)
+			return nil
+		}
+		return err
+	}
+	// Late or duplicate results must not move a finished job backwards
+	if job.Status.IsFinal() {
+		return nil
+	}
+	// Progress updates are only streamed to subscribers
+	if result.Status == models.ImageStatusProcessing && result.Progress > 0 {
+		uc.publishResult(result)
+		return nil
+	}
+
+	update := map[string]interface{}{
+		"Status":     result.Status,
+		"RetryCount": result.RetryCount,
+	}
+	var stored *models.ProcessingResult
+	switch result.Status {
+	case models.ImageStatusProcessing:
+		update["StartedAt"] = sql.NullTime{Time: result.ProcessedAt, Valid: true}
+		deadline := result.ProcessedAt.Add(uc.cfg.Processing.JobTimeout(string(job.ProcessingType)))
+		update["DeadlineAt"] = sql.NullTime{Time: deadline, Valid: true}
+	case models.ImageStatusCompleted:
+		metadata, err := common.TypeConverter[entity.ResultMetadata](result.Metadata)
+		if err != nil {
+			return err
+		}
+		stored = &models.ProcessingResult{
+			ProcessingJobId: result.JobId,
+			ResultPath:      result.ResultPath,
+			FileSize:        metadata.FileSize,
+			Width:           metadata.Width,
+			Height:          metadata.Height,
+			MimeType:        metadata.MimeType,
+			CreatedBy:       result.UserId,
+		}
+		update["ResultPath"] = sql.NullString{String: result.ResultPath, Valid: true}
+		update["CompletedAt"] = sql.NullTime{Time: result.ProcessedAt, Valid: true}
+		update["Duration"] = sql.NullInt64{Int64: result.Duration, Valid: true}
+	case models.ImageStatusFailed:
+		update["ErrorMessage"] = sql.NullString{String: result.ErrorMessage, Valid: true}
+		update["CompletedAt"] = sql.NullTime{Time: result.ProcessedAt, Valid: true}
+		update["Duration"] = sql.NullInt64{Int64: result.Duration, Valid: true}
+	case models.ImageStatusPending:
+		// The attempt failed and the broker retries it. Without a deadline the
+		// reaper leaves the job to the retry, and results of the failed attempt
+		// arriving late no longer apply.
+		update["RetryCount"] = result.RetryCount + 1
+		update["ErrorMessage"] = sql.NullString{String: result.ErrorMessage, Valid: true}
+		update["StartedAt"] = sql.NullTime{}
+		update["DeadlineAt"] = sql.NullTime{}
+	default:
+		log.Printf("Caller:%s Level:%s Msg:unexpected status %s for job %d", constants.Internal, constants.UseCase, result.Status, result.JobId)
+		return nil
+	}
+
+	var delivery *models.WebhookDelivery
+	if result.Status.IsFinal() {
+		if delivery, err = uc.webhooks.NewDelivery(job, result); err != nil {
+			return err
+		}
+	}
+	// The job may have been cancelled or retried since it was read, a conditional update keeps it that way
+	updated, err := uc.repo.RecordProcessingResult(ctx, result.JobId, result.RetryCount, update, stored, delivery)
+	if err != nil {
+		return err
+	}
+	if updated {
+		uc.publishResult(result)
+	}
+	return nil
+}
+
+// RunReaper reaps stuck jobs every ReapInterval until ctx is done
+func (uc *ProcessingUsecase) RunReaper(ctx context.Context) {
+	ticker := time.NewTicker(uc.cfg.Processing.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := uc.ReapStuckJobs(ctx); err != nil {
+				log.Printf("Caller:%s Level:%s Msg:%s", constants.Internal, constants.UseCase, err.Error())
+			}
+		}
+	}
+}
+
+// ReapStuckJobs takes over the jobs whose worker did not report back within
+// their timeout and ReapGracePeriod, most likely because it crashed. Jobs with
+// retries left are queued again, the others are marked failed.
+func (uc *ProcessingUsecase) ReapStuckJobs(ctx context.Context) error {
+	before := time.Now().UTC().Add(-uc.cfg.Processing.ReapGracePeriod)
+	jobs, err := uc.repo.GetStuckProcessingJobs(ctx, before, uc.cfg.Processing.ReapBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := uc.reap(ctx, job, before); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (uc *ProcessingUsecase) reap(ctx context.Context, job models.ProcessingJob, before time.Time) error {
+	// The job owner is the acting user, like for results
+	ctx = context.WithValue(ctx, constants.UserIdKey, float64(job.Image.UserId))
+	reason := fmt.Sprintf("job did not finish within %s", uc.cfg.Processing.JobTimeout(string(job.ProcessingType)))
+
+	if job.RetryCount < uc.cfg.RabbitMQ.MaxRetries {
+		requeued, err := uc.repo.RequeueStuckProcessingJob(ctx, job, before, reason, func(job models.ProcessingJob) (models.OutboxMessage, error) {
+			return uc.newProcessingMessage(&job)
+		})
+		if err != nil || !requeued {
+			return err
+		}
+		log.Printf("Caller:%s Level:%s Msg:stuck job %d requeued: %s", constants.Internal, constants.UseCase, job.Id, reason)
+		uc.events.Publish(job.Id, dto.ProcessingJobEvent{
+			JobId:        job.Id,
+			Status:       models.ImageStatusPending,
+			ErrorMessage: reason,
+			Timestamp:    time.Now().UTC(),
+		})
+		return nil
+	}
+
+	result := &entity.ProcessingResult{
+		JobId:        job.Id,
+		ImageId:      job.ImageId,
+		UserId:       job.Image.UserId,
+		Status:       models.ImageStatusFailed,
+		ErrorMessage: reason,
+		RetryCount:   job.RetryCount,
+		ProcessedAt:  time.Now().UTC(),
+	}
+	delivery, err := uc.webhooks.NewDelivery(job, result)
+	if err != nil {
+		return err
+	}
+	failed, err := uc.repo.FailStuckProcessingJob(ctx, job.Id, before, reason, delivery)
+	if err != nil || !failed {
+		return err
+	}
+	log.Printf("Caller:%s Level:%s Msg:stuck job %d failed: %s", constants.Internal, constants.UseCase, job.Id, reason)
+	uc.publishResult(result)
+	return nil
+}
+
+// RunScheduler queues the due scheduled jobs every ScheduleInterval until ctx is done
+func (uc *ProcessingUsecase) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(uc.cfg.Processing.ScheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := uc.QueueDueJobs(ctx); err != nil {
+				log.Printf("Caller:%s Level:%s Msg:%s", constants.Internal, constants.UseCase, err.Error())
+			}
+		}
+	}
+}
+
+// QueueDueJobs queues the scheduled jobs whose run time has come. Jobs are
+// queued through the outbox like new ones, so the schedule survives restarts
+// and broker outages.
+func (uc *ProcessingUsecase) QueueDueJobs(ctx context.Context) error {
+	jobs, err := uc.repo.QueueDueProcessingJobs(ctx, time.Now().UTC(), uc.cfg.Processing.ScheduleBatchSize, func(job models.ProcessingJob) (models.OutboxMessage, error) {
+		return uc.newProcessingMessage(&job)
+	})
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		uc.events.Publish(job.Id, dto.ProcessingJobEvent{
+			JobId:     job.Id,
+			Status:    models.ImageStatusPending,
+			Timestamp: time.Now().UTC(),
+		})
+	}
+	return nil
+}
+
+func (uc *ProcessingUsecase) publishResult(result *entity.ProcessingResult) {
+	event := dto.ProcessingJobEvent{
+		JobId:        result.JobId,
+		Status:       result.Status,
+		Progress:     result.Progress,
+		ErrorMessage: result.ErrorMessage,
+		Timestamp:    result.ProcessedAt,
+	}
+	if result.Status == models.ImageStatusCompleted {
+		event.Progress = 100
+	}
+	uc.events.Publish(result.JobId, event)
+}
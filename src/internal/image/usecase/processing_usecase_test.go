@@ -0,0 +1,384 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/webhook"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/events"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+)
+
+// userContext returns the context of a request made by userId
+func userContext(userId int) context.Context {
+	return context.WithValue(context.Background(), constants.UserIdKey, float64(userId))
+}
+
+// endUserMessage returns the message of a service error, or "" for any other error
+func endUserMessage(err error) string {
+	var serviceErr *service_errors.ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.EndUserMessage
+	}
+	return ""
+}
+
+func TestGetProcessingResultFile(t *testing.T) {
+	completed := models.ProcessingJob{
+		Id:         1,
+		Image:      models.Image{UserId: 1},
+		Status:     models.ImageStatusCompleted,
+		ResultPath: sql.NullString{String: "/results/job_1.png", Valid: true},
+		Result:     &models.ProcessingResult{MimeType: "image/png"},
+	}
+	running := completed
+	running.Status = models.ImageStatusProcessing
+	running.ResultPath = sql.NullString{}
+
+	tests := []struct {
+		name        string
+		job         models.ProcessingJob
+		userId      int
+		wantMessage string // Of the service error, empty for success
+		wantFile    string
+	}{
+		{name: "completed", job: completed, userId: 1, wantFile: "job_1.png"},
+		{name: "not finished", job: running, userId: 1, wantMessage: service_errors.ResultNotReady},
+		{name: "job of another user", job: completed, userId: 2, wantMessage: service_errors.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := tt.job
+			uc := NewProcessingUseCase(&config.Config{}, &memoryProcessingRepository{job: &job}, nil, events.NewHub[dto.ProcessingJobEvent](), nil, nil)
+			file, err := uc.GetProcessingResultFile(userContext(tt.userId), job.Id)
+			if got := endUserMessage(err); got != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if file.FileName != tt.wantFile {
+				t.Errorf("file name %q, want %q", file.FileName, tt.wantFile)
+			}
+			if tt.wantFile != "" && file.MimeType != "image/png" {
+				t.Errorf("mime type %q, want image/png", file.MimeType)
+			}
+		})
+	}
+}
+
+func TestGetProcessingJobOfAnotherUser(t *testing.T) {
+	job := models.ProcessingJob{Id: 1, Image: models.Image{UserId: 1}}
+	uc := NewProcessingUseCase(&config.Config{}, &memoryProcessingRepository{job: &job}, nil, events.NewHub[dto.ProcessingJobEvent](), nil, nil)
+	if _, err := uc.GetProcessingJob(userContext(2), job.Id); endUserMessage(err) != service_errors.PermissionDenied {
+		t.Errorf("job of another user returned %v, want permission denied", err)
+	}
+	response, err := uc.GetProcessingJob(userContext(1), job.Id)
+	if err != nil || response.Id != job.Id {
+		t.Errorf("own job returned %+v, %v", response, err)
+	}
+}
+
+func TestCreateProcessingJob(t *testing.T) {
+	cfg := &config.Config{
+		RabbitMQ:   config.RabbitMQConfig{ProcessingRoutingKey: "image.process", MaxRetries: 3},
+		Processing: config.ProcessingConfig{DefaultPriority: 5, MaxUserPriority: 7},
+	}
+	images := &memoryImageRepository{image: models.Image{Id: 1, UserId: 1, Width: 400, Height: 300, FilePath: "uploads", FileName: "cat.png"}}
+	repo := &memoryProcessingRepository{}
+	uc := NewProcessingUseCase(cfg, repo, images, events.NewHub[dto.ProcessingJobEvent](), NewWebhookUsecase(cfg, &memoryWebhookRepository{}, webhook.NewSender(cfg)), nil)
+
+	response, err := uc.CreateProcessingJob(userContext(1), dto.ProcessingRequest{
+		ImageId:        1,
+		ProcessingType: models.ProcessingTypeResize,
+		Parameters:     map[string]interface{}{"width": 100},
+		CallbackUrl:    "https://example.com/hook",
+	})
+	if err != nil {
+		t.Fatalf("CreateProcessingJob: %v", err)
+	}
+	if response.JobId != repo.job.Id || repo.job.CallbackUrl.String != "https://example.com/hook" {
+		t.Errorf("created job %+v, response %+v", repo.job, response)
+	}
+	// The job is queued through the outbox only
+	if len(repo.messages) != 1 {
+		t.Fatalf("%d outbox messages, want 1", len(repo.messages))
+	}
+	outbox := repo.messages[0]
+	if outbox.Status != models.OutboxStatusPending || outbox.RoutingKey != "image.process" || outbox.Priority != 5 || outbox.MaxRetries != 3 {
+		t.Errorf("outbox message %+v", outbox)
+	}
+	var message entity.ProcessingMessage
+	if err := json.Unmarshal(outbox.Body, &message); err != nil {
+		t.Fatalf("outbox body: %v", err)
+	}
+	if message.JobId != repo.job.Id || message.SourcePath != filepath.Join("uploads", "cat.png") || message.UserId != 1 {
+		t.Errorf("queued message %+v", message)
+	}
+}
+
+func TestCreateProcessingJobRejected(t *testing.T) {
+	images := &memoryImageRepository{image: models.Image{Id: 1, UserId: 1, Width: 400, Height: 300}}
+	tests := []struct {
+		name        string
+		userId      int
+		req         dto.ProcessingRequest
+		wantInvalid bool
+		wantMessage string
+	}{
+		{
+			name:        "image of another user",
+			userId:      2,
+			req:         dto.ProcessingRequest{ImageId: 1, ProcessingType: models.ProcessingTypeResize, Parameters: map[string]interface{}{"width": 10}},
+			wantMessage: service_errors.PermissionDenied,
+		},
+		{
+			name:        "invalid parameters",
+			userId:      1,
+			req:         dto.ProcessingRequest{ImageId: 1, ProcessingType: models.ProcessingTypeCrop, Parameters: map[string]interface{}{"x": 390, "y": 0, "width": 20, "height": 20}},
+			wantInvalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The repository has no jobs, creating one would panic
+			uc := NewProcessingUseCase(&config.Config{}, &memoryProcessingRepository{}, images, events.NewHub[dto.ProcessingJobEvent](), nil, nil)
+			_, err := uc.CreateProcessingJob(userContext(tt.userId), tt.req)
+			var invalid entity.ValidationErrors
+			if errors.As(err, &invalid) != tt.wantInvalid {
+				t.Errorf("error %v, want validation errors %v", err, tt.wantInvalid)
+			}
+			if got := endUserMessage(err); got != tt.wantMessage {
+				t.Errorf("error %v, want %q", err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestResolvePriority(t *testing.T) {
+	cfg := &config.Config{Processing: config.ProcessingConfig{DefaultPriority: 5, MaxUserPriority: 7}}
+	admin := context.WithValue(userContext(1), constants.RolesKey, []interface{}{constants.AdminRoleName})
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		priority    int
+		want        int
+		wantMessage string
+	}{
+		{name: "default", ctx: userContext(1), priority: 0, want: 5},
+		{name: "user", ctx: userContext(1), priority: 7, want: 7},
+		{name: "below range", ctx: userContext(1), priority: -3, want: entity.MinPriority},
+		{name: "user above limit", ctx: userContext(1), priority: 8, wantMessage: service_errors.PriorityNotAllowed},
+		{name: "admin above limit", ctx: admin, priority: 9, want: 9},
+		{name: "admin above range", ctx: admin, priority: 50, want: entity.MaxPriority},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewProcessingUseCase(cfg, nil, nil, events.NewHub[dto.ProcessingJobEvent](), nil, nil)
+			got, err := uc.resolvePriority(tt.ctx, tt.priority)
+			if msg := endUserMessage(err); msg != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if got != tt.want {
+				t.Errorf("priority %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRunAt(t *testing.T) {
+	now := time.Now().UTC()
+	past, soon, far := now.Add(-time.Minute), now.Add(time.Hour), now.Add(48*time.Hour)
+	tests := []struct {
+		name        string
+		runAt       *time.Time
+		delay       time.Duration
+		wantRunAt   bool
+		wantMessage string
+	}{
+		{name: "right away"},
+		{name: "run time passed", runAt: &past},
+		{name: "run time", runAt: &soon, wantRunAt: true},
+		{name: "delay", delay: time.Hour, wantRunAt: true},
+		{name: "run time wins over delay", runAt: &past, delay: time.Hour},
+		{name: "too far ahead", runAt: &far, wantMessage: service_errors.ScheduleTooFar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewProcessingUseCase(&config.Config{Processing: config.ProcessingConfig{MaxScheduleAhead: 24 * time.Hour}}, nil, nil, nil, nil, nil)
+			runAt, err := uc.resolveRunAt(tt.runAt, tt.delay)
+			if got := endUserMessage(err); got != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if runAt.Valid != tt.wantRunAt {
+				t.Errorf("run at %v, want set %v", runAt, tt.wantRunAt)
+			}
+		})
+	}
+}
+
+func TestCancelProcessingJob(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      models.ImageStatus
+		wantMessage string
+	}{
+		{name: "pending", status: models.ImageStatusPending},
+		{name: "processing", status: models.ImageStatusProcessing},
+		{name: "completed", status: models.ImageStatusCompleted, wantMessage: service_errors.JobAlreadyFinished},
+		{name: "cancelled", status: models.ImageStatusCancelled, wantMessage: service_errors.JobAlreadyFinished},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := models.ProcessingJob{Id: 1, Image: models.Image{UserId: 1}, Status: tt.status}
+			uc := NewProcessingUseCase(&config.Config{}, &memoryProcessingRepository{job: &job}, nil, events.NewHub[dto.ProcessingJobEvent](), nil, nil)
+			response, err := uc.CancelProcessingJob(userContext(1), job.Id)
+			if got := endUserMessage(err); got != tt.wantMessage {
+				t.Fatalf("error %v, want %q", err, tt.wantMessage)
+			}
+			if tt.wantMessage == "" && response.Status != models.ImageStatusCancelled {
+				t.Errorf("status %s, want cancelled", response.Status)
+			}
+		})
+	}
+}
+
+// stuck reports whether the job is still processing past before, the
+// condition the Postgres repository takes stuck jobs over with
+func (r *memoryProcessingRepository) stuck(id int, before time.Time) bool {
+	return r.job != nil && r.job.Id == id && r.job.Status == models.ImageStatusProcessing &&
+		r.job.DeadlineAt.Valid && r.job.DeadlineAt.Time.Before(before)
+}
+
+func (r *memoryProcessingRepository) GetStuckProcessingJobs(ctx context.Context, before time.Time, limit int) ([]models.ProcessingJob, error) {
+	if r.job == nil || !r.stuck(r.job.Id, before) {
+		return nil, nil
+	}
+	return []models.ProcessingJob{*r.job}, nil
+}
+
+func (r *memoryProcessingRepository) RequeueStuckProcessingJob(ctx context.Context, job models.ProcessingJob, before time.Time, reason string, newMessage func(models.ProcessingJob) (models.OutboxMessage, error)) (bool, error) {
+	if !r.stuck(job.Id, before) {
+		return false, nil
+	}
+	job.Status = models.ImageStatusPending
+	job.RetryCount++
+	message, err := newMessage(job)
+	if err != nil {
+		return false, err
+	}
+	r.job.Status, r.job.RetryCount = job.Status, job.RetryCount
+	r.messages = append(r.messages, message)
+	return true, nil
+}
+
+func (r *memoryProcessingRepository) FailStuckProcessingJob(ctx context.Context, id int, before time.Time, reason string, delivery *models.WebhookDelivery) (bool, error) {
+	if !r.stuck(id, before) {
+		return false, nil
+	}
+	r.job.Status = models.ImageStatusFailed
+	if delivery != nil {
+		r.deliveries = append(r.deliveries, *delivery)
+	}
+	return true, nil
+}
+
+func TestReapStuckJobs(t *testing.T) {
+	overdue := sql.NullTime{Time: time.Now().UTC().Add(-time.Hour), Valid: true}
+	tests := []struct {
+		name           string
+		status         models.ImageStatus
+		deadline       sql.NullTime
+		retryCount     int
+		wantStatus     models.ImageStatus
+		wantMessages   int
+		wantDeliveries int
+	}{
+		{name: "requeued", status: models.ImageStatusProcessing, deadline: overdue, wantStatus: models.ImageStatusPending, wantMessages: 1},
+		{name: "retries exhausted", status: models.ImageStatusProcessing, deadline: overdue, retryCount: 2, wantStatus: models.ImageStatusFailed, wantDeliveries: 1},
+		{name: "within its deadline", status: models.ImageStatusProcessing, deadline: sql.NullTime{Time: time.Now().UTC().Add(time.Hour), Valid: true}, wantStatus: models.ImageStatusProcessing},
+		{name: "finished", status: models.ImageStatusCompleted, deadline: overdue, wantStatus: models.ImageStatusCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{RabbitMQ: config.RabbitMQConfig{MaxRetries: 2}}
+			job := &models.ProcessingJob{
+				Id:          1,
+				Image:       models.Image{Id: 1, UserId: 1},
+				Status:      tt.status,
+				DeadlineAt:  tt.deadline,
+				RetryCount:  tt.retryCount,
+				CallbackUrl: sql.NullString{String: "https://example.com/hook", Valid: true},
+			}
+			repo := &memoryProcessingRepository{job: job}
+			uc := NewProcessingUseCase(cfg, repo, nil, events.NewHub[dto.ProcessingJobEvent](), NewWebhookUsecase(cfg, &memoryWebhookRepository{}, nil), nil)
+
+			if err := uc.ReapStuckJobs(context.Background()); err != nil {
+				t.Fatalf("ReapStuckJobs: %v", err)
+			}
+			if job.Status != tt.wantStatus {
+				t.Errorf("status %s, want %s", job.Status, tt.wantStatus)
+			}
+			if len(repo.messages) != tt.wantMessages {
+				t.Errorf("%d outbox messages, want %d", len(repo.messages), tt.wantMessages)
+			}
+			if len(repo.deliveries) != tt.wantDeliveries {
+				t.Errorf("%d webhook deliveries, want %d", len(repo.deliveries), tt.wantDeliveries)
+			}
+		})
+	}
+}
+
+// An attempt that fails after its deadline is retried by the broker, the
+// reaper must not queue the job a second time while the retry is delayed
+func TestReapStuckJobsSkipsRetriedAttempt(t *testing.T) {
+	cfg := &config.Config{RabbitMQ: config.RabbitMQConfig{MaxRetries: 2}}
+	job := &models.ProcessingJob{
+		Id:         1,
+		Image:      models.Image{Id: 1, UserId: 1},
+		Status:     models.ImageStatusProcessing,
+		DeadlineAt: sql.NullTime{Time: time.Now().UTC().Add(-time.Hour), Valid: true},
+	}
+	repo := &memoryProcessingRepository{job: job}
+	uc := NewProcessingUseCase(cfg, repo, nil, events.NewHub[dto.ProcessingJobEvent](), NewWebhookUsecase(cfg, &memoryWebhookRepository{}, nil), nil)
+	handle := func(status models.ImageStatus, retryCount int) {
+		t.Helper()
+		result := &entity.ProcessingResult{JobId: job.Id, UserId: 1, Status: status, RetryCount: retryCount, ProcessedAt: time.Now().UTC()}
+		if err := uc.HandleProcessingResult(context.Background(), result); err != nil {
+			t.Fatalf("HandleProcessingResult: %v", err)
+		}
+	}
+	reap := func() {
+		t.Helper()
+		if err := uc.ReapStuckJobs(context.Background()); err != nil {
+			t.Fatalf("ReapStuckJobs: %v", err)
+		}
+	}
+
+	// The first attempt times out and is sent back for a retry
+	handle(models.ImageStatusPending, 0)
+	reap()
+	if job.Status != models.ImageStatusPending || len(repo.messages) != 0 {
+		t.Fatalf("job %s with %d outbox messages after the retry was scheduled, want it left pending to the retry", job.Status, len(repo.messages))
+	}
+
+	// A start of the first attempt delivered late does not make it stuck again
+	handle(models.ImageStatusProcessing, 0)
+	reap()
+	if job.Status != models.ImageStatusPending || len(repo.messages) != 0 {
+		t.Fatalf("job %s with %d outbox messages after a late start, want it left pending to the retry", job.Status, len(repo.messages))
+	}
+
+	handle(models.ImageStatusProcessing, 1)
+	reap()
+	if job.Status != models.ImageStatusProcessing || job.RetryCount != 1 || len(repo.messages) != 0 {
+		t.Errorf("job %s, retry %d with %d outbox messages once the retry started, want processing, 1 and none", job.Status, job.RetryCount, len(repo.messages))
+	}
+}
@@ -0,0 +1,303 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/webhook"
+	"github.com/alielmi98/image-processing-service/internal/image/usecase/dto"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	webhookDeliveriesLimit = 100
+	webhookSecretSize      = 32
+)
+
+type WebhookUsecase struct {
+	cfg    *config.Config
+	repo   repository.WebhookRepository
+	sender *webhook.Sender
+}
+
+func NewWebhookUsecase(cfg *config.Config, repo repository.WebhookRepository, sender *webhook.Sender) *WebhookUsecase {
+	return &WebhookUsecase{
+		cfg:    cfg,
+		repo:   repo,
+		sender: sender,
+	}
+}
+
+// GetWebhookSetting returns the webhook setting of the current user, creating
+// one with a fresh secret on first use
+func (uc *WebhookUsecase) GetWebhookSetting(ctx context.Context) (dto.WebhookSettingResponse, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	setting, err := uc.ensureSetting(ctx, userId)
+	if err != nil {
+		return dto.WebhookSettingResponse{}, err
+	}
+	return toWebhookSettingResponse(setting), nil
+}
+
+// SaveWebhookSetting stores the default callback URL of the current user and
+// optionally replaces the signing secret
+func (uc *WebhookUsecase) SaveWebhookSetting(ctx context.Context, req dto.SaveWebhookSetting) (dto.WebhookSettingResponse, error) {
+	if err := uc.checkCallbackUrl(req.CallbackUrl); err != nil {
+		return dto.WebhookSettingResponse{}, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	setting, err := uc.ensureSetting(ctx, userId)
+	if err != nil {
+		return dto.WebhookSettingResponse{}, err
+	}
+	setting.CallbackUrl = sql.NullString{String: req.CallbackUrl, Valid: req.CallbackUrl != ""}
+	if req.RotateSecret {
+		if setting.Secret, err = newWebhookSecret(); err != nil {
+			return dto.WebhookSettingResponse{}, err
+		}
+	}
+	setting, err = uc.repo.SaveWebhookSetting(ctx, setting)
+	if err != nil {
+		return dto.WebhookSettingResponse{}, err
+	}
+	return toWebhookSettingResponse(setting), nil
+}
+
+// ResolveCallbackUrl returns the callback URL of a new job, falling back to
+// the default of the current user. A secret is created up front so the user
+// can verify the first delivery.
+func (uc *WebhookUsecase) ResolveCallbackUrl(ctx context.Context, callbackUrl string) (string, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if callbackUrl != "" {
+		if err := uc.checkCallbackUrl(callbackUrl); err != nil {
+			return "", err
+		}
+		_, err := uc.ensureSetting(ctx, userId)
+		return callbackUrl, err
+	}
+	setting, err := uc.repo.GetWebhookSetting(ctx, userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return setting.CallbackUrl.String, nil
+}
+
+// checkCallbackUrl refuses callback URLs the sender would not deliver to
+func (uc *WebhookUsecase) checkCallbackUrl(callbackUrl string) error {
+	if callbackUrl == "" {
+		return nil
+	}
+	if err := uc.sender.CheckUrl(callbackUrl); err != nil {
+		var errs entity.ValidationErrors
+		errs.Add("callback_url", "%v", err)
+		return errs
+	}
+	return nil
+}
+
+// NewDelivery builds the delivery of a job result to the callback URL of the
+// job, or nil when the job has none. It is stored along with the result, so a
+// recorded result is always delivered.
+func (uc *WebhookUsecase) NewDelivery(job models.ProcessingJob, result *entity.ProcessingResult) (*models.WebhookDelivery, error) {
+	if !job.CallbackUrl.Valid || job.CallbackUrl.String == "" {
+		return nil, nil
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WebhookDelivery{
+		DeliveryId:      uuid.NewString(),
+		UserId:          job.Image.UserId,
+		ProcessingJobId: job.Id,
+		Event:           result.Status,
+		Url:             job.CallbackUrl.String,
+		Payload:         string(payload),
+		Status:          models.WebhookDeliveryPending,
+		NextAttemptAt:   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		CreatedBy:       job.Image.UserId,
+	}, nil
+}
+
+// GetWebhookDeliveries lists the latest deliveries of the current user,
+// optionally only those of one job
+func (uc *WebhookUsecase) GetWebhookDeliveries(ctx context.Context, jobId int) ([]dto.WebhookDeliveryResponse, error) {
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	deliveries, err := uc.repo.GetWebhookDeliveries(ctx, userId, jobId, webhookDeliveriesLimit)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]dto.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, toWebhookDeliveryResponse(delivery))
+	}
+	return response, nil
+}
+
+// RedeliverWebhook schedules a past delivery to be sent again right away. The
+// delivery id is kept, so receivers can still recognise it.
+func (uc *WebhookUsecase) RedeliverWebhook(ctx context.Context, id int) (dto.WebhookDeliveryResponse, error) {
+	delivery, err := uc.repo.GetWebhookDeliveryByID(ctx, id)
+	if err != nil {
+		return dto.WebhookDeliveryResponse{}, err
+	}
+	userId := int(ctx.Value(constants.UserIdKey).(float64))
+	if delivery.UserId != userId {
+		return dto.WebhookDeliveryResponse{}, &service_errors.ServiceError{EndUserMessage: service_errors.PermissionDenied}
+	}
+	if delivery.Status != models.WebhookDeliveryPending {
+		_, err = uc.repo.UpdateWebhookDelivery(ctx, id, map[string]interface{}{
+			"Status":        models.WebhookDeliveryPending,
+			"AttemptCount":  0,
+			"NextAttemptAt": sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		})
+		if err != nil {
+			return dto.WebhookDeliveryResponse{}, err
+		}
+	}
+	delivery, err = uc.repo.GetWebhookDeliveryByID(ctx, id)
+	if err != nil {
+		return dto.WebhookDeliveryResponse{}, err
+	}
+	return toWebhookDeliveryResponse(delivery), nil
+}
+
+// RunDispatcher sends the due deliveries every PollInterval until ctx is done
+func (uc *WebhookUsecase) RunDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(uc.cfg.Webhook.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := uc.DeliverDue(ctx); err != nil {
+				log.Printf("Caller:%s Level:%s Msg:%s", constants.Internal, constants.ExternalService, err.Error())
+			}
+		}
+	}
+}
+
+// DeliverDue claims the deliveries whose next attempt is due and sends them.
+// Claimed deliveries are leased for longer than a request can take, so a
+// delivery whose dispatcher dies is picked up again once the lease expires.
+// The errors of single deliveries do not hold up the others, they are joined
+// into the returned error.
+func (uc *WebhookUsecase) DeliverDue(ctx context.Context) error {
+	deliveries, err := uc.repo.ClaimDueWebhookDeliveries(ctx, 2*uc.cfg.Webhook.Timeout, uc.cfg.Webhook.BatchSize)
+	if err != nil {
+		return err
+	}
+	secrets := map[int]string{}
+	var errs []error
+	for _, delivery := range deliveries {
+		// A failing delivery is skipped, it is picked up again once its lease expires
+		secret, ok := secrets[delivery.UserId]
+		if !ok {
+			setting, err := uc.repo.GetWebhookSetting(ctx, delivery.UserId)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("webhook delivery %s: %w", delivery.DeliveryId, err))
+				continue
+			}
+			secret = setting.Secret
+			secrets[delivery.UserId] = secret
+		}
+		if err := uc.deliver(ctx, delivery, secret); err != nil {
+			errs = append(errs, fmt.Errorf("webhook delivery %s: %w", delivery.DeliveryId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver makes a single attempt and records its outcome. Failed attempts are
+// retried with exponential backoff until MaxAttempts is reached.
+func (uc *WebhookUsecase) deliver(ctx context.Context, delivery models.WebhookDelivery, secret string) error {
+	start := time.Now()
+	statusCode, sendErr := uc.sender.Send(ctx, webhook.Request{
+		Url:        delivery.Url,
+		Secret:     secret,
+		DeliveryId: delivery.DeliveryId,
+		Event:      string(delivery.Event),
+		Payload:    []byte(delivery.Payload),
+	})
+	attempt := models.WebhookDeliveryAttempt{
+		WebhookDeliveryId: delivery.Id,
+		StatusCode:        sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0},
+		Duration:          time.Since(start).Milliseconds(),
+	}
+
+	attempts := delivery.AttemptCount + 1
+	update := map[string]interface{}{
+		"AttemptCount": attempts,
+	}
+	switch {
+	case sendErr == nil:
+		update["Status"] = models.WebhookDeliverySucceeded
+		update["DeliveredAt"] = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		update["NextAttemptAt"] = sql.NullTime{}
+	case attempts >= uc.cfg.Webhook.MaxAttempts:
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+		update["Status"] = models.WebhookDeliveryFailed
+		update["NextAttemptAt"] = sql.NullTime{}
+		log.Printf("Caller:%s Level:%s Msg:webhook delivery %s failed after %d attempts: %v",
+			constants.Internal, constants.ExternalService, delivery.DeliveryId, attempts, sendErr)
+	default:
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+		update["NextAttemptAt"] = sql.NullTime{Time: time.Now().UTC().Add(uc.retryDelay(attempts)), Valid: true}
+	}
+	return uc.repo.RecordWebhookAttempt(ctx, attempt, update)
+}
+
+// retryDelay returns the delay after the given failed attempt, starting at
+// RetryDelay and doubling up to MaxRetryDelay
+func (uc *WebhookUsecase) retryDelay(attempt int) time.Duration {
+	delay := uc.cfg.Webhook.RetryDelay
+	for i := 1; i < attempt && delay < uc.cfg.Webhook.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, uc.cfg.Webhook.MaxRetryDelay)
+}
+
+func (uc *WebhookUsecase) ensureSetting(ctx context.Context, userId int) (models.WebhookSetting, error) {
+	setting, err := uc.repo.GetWebhookSetting(ctx, userId)
+	if err == nil {
+		return setting, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return setting, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return setting, err
+	}
+	return uc.repo.SaveWebhookSetting(ctx, models.WebhookSetting{
+		UserId:    userId,
+		Secret:    secret,
+		CreatedBy: userId,
+	})
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/webhook"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"gorm.io/gorm"
+)
+
+// memoryWebhookRepository records the attempts it is given
+type memoryWebhookRepository struct {
+	repository.WebhookRepository
+	attempts []models.WebhookDeliveryAttempt
+	updates  []map[string]interface{}
+}
+
+func (r *memoryWebhookRepository) GetWebhookSetting(ctx context.Context, userId int) (models.WebhookSetting, error) {
+	return models.WebhookSetting{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryWebhookRepository) SaveWebhookSetting(ctx context.Context, setting models.WebhookSetting) (models.WebhookSetting, error) {
+	return setting, nil
+}
+
+func (r *memoryWebhookRepository) RecordWebhookAttempt(ctx context.Context, attempt models.WebhookDeliveryAttempt, delivery map[string]interface{}) error {
+	r.attempts = append(r.attempts, attempt)
+	r.updates = append(r.updates, delivery)
+	return nil
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryDelay    time.Duration
+		maxRetryDelay time.Duration
+		attempt       int
+		want          time.Duration
+	}{
+		{name: "first attempt", retryDelay: time.Second, maxRetryDelay: time.Hour, attempt: 1, want: time.Second},
+		{name: "second attempt", retryDelay: time.Second, maxRetryDelay: time.Hour, attempt: 2, want: 2 * time.Second},
+		{name: "fifth attempt", retryDelay: time.Second, maxRetryDelay: time.Hour, attempt: 5, want: 16 * time.Second},
+		{name: "capped", retryDelay: time.Second, maxRetryDelay: 10 * time.Second, attempt: 5, want: 10 * time.Second},
+		{name: "capped far beyond", retryDelay: time.Second, maxRetryDelay: 10 * time.Second, attempt: 1000, want: 10 * time.Second},
+		{name: "delay above the cap", retryDelay: time.Minute, maxRetryDelay: time.Second, attempt: 1, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Webhook: config.WebhookConfig{RetryDelay: tt.retryDelay, MaxRetryDelay: tt.maxRetryDelay}}
+			uc := NewWebhookUsecase(cfg, &memoryWebhookRepository{}, nil)
+			if got := uc.retryDelay(tt.attempt); got != tt.want {
+				t.Errorf("retryDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int // Answered by the receiver
+		attemptCount  int // Attempts made before
+		wantStatus    models.WebhookDeliveryStatus
+		wantDelivered bool
+		wantRetryIn   time.Duration // Zero when no further attempt is scheduled
+	}{
+		{name: "delivered", status: http.StatusOK, wantStatus: models.WebhookDeliverySucceeded, wantDelivered: true},
+		{name: "delivered on a retry", status: http.StatusNoContent, attemptCount: 3, wantStatus: models.WebhookDeliverySucceeded, wantDelivered: true},
+		{name: "first failure", status: http.StatusInternalServerError, wantRetryIn: time.Second},
+		{name: "third failure", status: http.StatusInternalServerError, attemptCount: 2, wantRetryIn: 4 * time.Second},
+		{name: "last attempt", status: http.StatusInternalServerError, attemptCount: 4, wantStatus: models.WebhookDeliveryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{Webhook: config.WebhookConfig{
+				Timeout:              5 * time.Second,
+				MaxAttempts:          5,
+				RetryDelay:           time.Second,
+				MaxRetryDelay:        time.Minute,
+				AllowPrivateNetworks: true,
+			}}
+			repo := &memoryWebhookRepository{}
+			uc := NewWebhookUsecase(cfg, repo, webhook.NewSender(cfg))
+			delivery := models.WebhookDelivery{Id: 1, DeliveryId: "d1", Url: server.URL, Payload: `{}`, AttemptCount: tt.attemptCount}
+
+			start := time.Now().UTC()
+			if err := uc.deliver(context.Background(), delivery, "secret"); err != nil {
+				t.Fatalf("deliver: %v", err)
+			}
+			if len(repo.attempts) != 1 {
+				t.Fatalf("%d attempts recorded, want 1", len(repo.attempts))
+			}
+			attempt, update := repo.attempts[0], repo.updates[0]
+			if attempt.StatusCode.Int64 != int64(tt.status) {
+				t.Errorf("attempt status code %d, want %d", attempt.StatusCode.Int64, tt.status)
+			}
+			if attempt.Error.Valid == tt.wantDelivered {
+				t.Errorf("attempt error %q, want error %v", attempt.Error.String, !tt.wantDelivered)
+			}
+			if update["AttemptCount"] != tt.attemptCount+1 {
+				t.Errorf("attempt count %v, want %d", update["AttemptCount"], tt.attemptCount+1)
+			}
+			if status, _ := update["Status"].(models.WebhookDeliveryStatus); status != tt.wantStatus {
+				t.Errorf("status %q, want %q", status, tt.wantStatus)
+			}
+			if delivered, _ := update["DeliveredAt"].(sql.NullTime); delivered.Valid != tt.wantDelivered {
+				t.Errorf("delivered at %v, want set %v", delivered, tt.wantDelivered)
+			}
+			next, _ := update["NextAttemptAt"].(sql.NullTime)
+			if next.Valid != (tt.wantRetryIn != 0) {
+				t.Fatalf("next attempt %v, want retry in %s", next, tt.wantRetryIn)
+			}
+			if next.Valid {
+				if delay := next.Time.Sub(start); delay < tt.wantRetryIn || delay > tt.wantRetryIn+time.Second {
+					t.Errorf("next attempt in %s, want %s", delay, tt.wantRetryIn)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	namesMu sync.RWMutex
+	// filters maps the filters the worker provides to whether they are
+	// adjustments, whose intensity sets a direction rather than a strength,
+	// 0.5 leaving the image unchanged. There is no sensible default, so their
+	// intensity must be given.
+	filters = map[string]bool{
+		"blur":       false,
+		"sharpen":    false,
+		"grayscale":  false,
+		"sepia":      false,
+		"invert":     false,
+		"brightness": true,
+		"contrast":   true,
+		"saturation": true,
+	}
+	// formats are the output formats the worker can encode
+	formats = map[string]bool{
+		"jpg": true, "jpeg": true, "png": true, "gif": true,
+		"bmp": true, "tif": true, "tiff": true, "webp": true,
+	}
+)
+
+// RegisterFilter accepts another filter name. Registered filters apply by
+// strength, like blur.
+func RegisterFilter(name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	filters[strings.ToLower(name)] = false
+}
+
+// RegisterFormat accepts another output format name
+func RegisterFormat(format string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	formats[strings.ToLower(format)] = true
+}
+
+// CheckFilter reports a filter name the worker does not provide
+func CheckFilter(name string) error {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	if _, ok := filters[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("unknown filter type %q, supported filters: %s", name, sortedNames(filters))
+	}
+	return nil
+}
+
+// IsAdjustment reports whether the intensity of the named filter must be given
+func IsAdjustment(name string) bool {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	return filters[strings.ToLower(name)]
+}
+
+// CheckFormat reports an output format name or file extension the worker
+// cannot encode
+func CheckFormat(format string) error {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	if !formats[strings.ToLower(strings.TrimPrefix(format, "."))] {
+		return fmt.Errorf("unsupported output format %q, supported formats: %s", format, sortedNames(formats))
+	}
+	return nil
+}
+
+func sortedNames[V any](names map[string]V) string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"fmt"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// ParseColor parses "#rgb", "#rrggbb", "#rrggbbaa" or "transparent"; empty means transparent
+func ParseColor(value string) (color.NRGBA, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "" || value == "transparent" {
+		return color.NRGBA{}, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = fmt.Sprintf("%c%c%c%c%c%c", hex[0], hex[0], hex[1], hex[1], hex[2], hex[2])
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s", value)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s", value)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// ParseCompressionLevel maps the named PNG compression levels onto
+// png.CompressionLevel. An empty value is nil, so it is told apart from
+// "default", whose png.DefaultCompression is the zero value.
+func ParseCompressionLevel(value string) (*png.CompressionLevel, error) {
+	var level png.CompressionLevel
+	switch strings.ToLower(value) {
+	case "":
+		return nil, nil
+	case "default":
+		level = png.DefaultCompression
+	case "none":
+		level = png.NoCompression
+	case "best-speed":
+		level = png.BestSpeed
+	case "best-compression":
+		level = png.BestCompression
+	default:
+		return nil, fmt.Errorf("unknown compression level %q, expected default, none, best-speed or best-compression", value)
+	}
+	return &level, nil
+}
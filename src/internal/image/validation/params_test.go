@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{value: "", want: color.NRGBA{}},
+		{value: "transparent", want: color.NRGBA{}},
+		{value: "#fff", want: color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+		{value: "#FF8000", want: color.NRGBA{R: 255, G: 128, A: 255}},
+		{value: "#ff800080", want: color.NRGBA{R: 255, G: 128, A: 128}},
+		{value: "#ff80", wantErr: true},
+		{value: "#gggggg", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseColor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
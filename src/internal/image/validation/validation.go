@@ -0,0 +1,352 @@
+// Package validation checks processing parameters. The API validates jobs
+// with it before they are queued and the worker again against the decoded
+// image, so both sides agree on what a valid job is.
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+)
+
+// validator checks the parameters of an operation applied to an image of the
+// given size and returns the size of the image the operation produces
+type validator func(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point
+
+// validators of the single operations, pipelines are validated step by step
+var validators = map[models.ProcessingType]validator{
+	models.ProcessingTypeResize:    validateResize,
+	models.ProcessingTypeCrop:      validateCrop,
+	models.ProcessingTypeRotate:    validateRotate,
+	models.ProcessingTypeFilter:    validateFilter,
+	models.ProcessingTypeWatermark: validateWatermark,
+	models.ProcessingTypeCompress:  validateCompress,
+	models.ProcessingTypeFormat:    validateFormat,
+}
+
+// Limits bounds the size of the images an operation may produce, as the
+// worker holds them in memory. Zero disables a bound.
+type Limits struct {
+	MaxDimension int // Largest width or height
+	MaxPixels    int // Largest width times height
+}
+
+func NewLimits(cfg *config.Config) Limits {
+	return Limits{
+		MaxDimension: cfg.Processing.MaxDimension,
+		MaxPixels:    cfg.Processing.MaxPixels,
+	}
+}
+
+// check reports an image of the given size that exceeds the limits. A side
+// of an unknown size is not checked.
+func (l Limits) check(errs *entity.ValidationErrors, field string, size image.Point) {
+	if l.MaxDimension > 0 && (size.X > l.MaxDimension || size.Y > l.MaxDimension) {
+		errs.Add(field, "produces a %dx%d image, larger than %d pixels on a side", size.X, size.Y, l.MaxDimension)
+		return
+	}
+	if l.MaxPixels > 0 && size.X > 0 && size.Y > 0 && size.X*size.Y > l.MaxPixels {
+		errs.Add(field, "produces a %dx%d image, more than %d pixels", size.X, size.Y, l.MaxPixels)
+	}
+}
+
+// ValidateParameters checks a processing request against the source image
+// before the job is queued and reports every invalid field at once
+func ValidateParameters(processingType models.ProcessingType, params map[string]interface{}, width, height int, limits Limits) error {
+	var errs entity.ValidationErrors
+	size := image.Pt(width, height)
+	if processingType == models.ProcessingTypePipeline {
+		validatePipeline(&errs, "parameters", params, size, limits)
+	} else if validate, ok := validators[processingType]; ok {
+		limits.check(&errs, "parameters", validate(&errs, "parameters", params, size))
+	} else {
+		errs.Add("processing_type", "unknown processing type %q", processingType)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateResize(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.ResizeParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateQuality(errs, field, params, p.Quality)
+	validateOutputFormat(errs, field+".format", p.Format)
+	if p.Width < 0 {
+		errs.Add(field+".width", "must not be negative")
+	}
+	if p.Height < 0 {
+		errs.Add(field+".height", "must not be negative")
+	}
+	if p.Width <= 0 && p.Height <= 0 {
+		if p.Width == 0 && p.Height == 0 {
+			errs.Add(field, "width or height is required")
+		}
+		return size
+	}
+	return resizedSize(size, p)
+}
+
+func validateCrop(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.CropParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateOutputFormat(errs, field+".format", p.Format)
+	valid := true
+	if p.X < 0 {
+		errs.Add(field+".x", "must not be negative")
+		valid = false
+	}
+	if p.Y < 0 {
+		errs.Add(field+".y", "must not be negative")
+		valid = false
+	}
+	if p.Width <= 0 {
+		errs.Add(field+".width", "must be positive")
+		valid = false
+	}
+	if p.Height <= 0 {
+		errs.Add(field+".height", "must be positive")
+		valid = false
+	}
+	if !valid {
+		return size
+	}
+	// The size is unknown for images stored without dimensions. Offsets are
+	// subtracted rather than added, so huge values cannot overflow.
+	if size.X > 0 && size.Y > 0 && (p.Width > size.X-p.X || p.Height > size.Y-p.Y) {
+		errs.Add(field, "crop rectangle %dx%d+%d+%d exceeds image bounds %dx%d",
+			p.Width, p.Height, p.X, p.Y, size.X, size.Y)
+	}
+	return image.Pt(p.Width, p.Height)
+}
+
+func validateRotate(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.RotateParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateOutputFormat(errs, field+".format", p.Format)
+	validateColor(errs, field+".background", p.Background)
+	return rotatedSize(size, p.Angle)
+}
+
+func validateFilter(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.FilterParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateOutputFormat(errs, field+".format", p.Format)
+	if p.FilterType == "" {
+		errs.Add(field+".filter_type", "is required")
+	} else if err := CheckFilter(p.FilterType); err != nil {
+		errs.Add(field+".filter_type", err.Error())
+	}
+	if _, ok := params["intensity"]; !ok && IsAdjustment(p.FilterType) {
+		errs.Add(field+".intensity", "is required for the %s filter, 0.5 leaves the image unchanged", p.FilterType)
+	}
+	if p.Intensity < 0 || p.Intensity > 1 {
+		errs.Add(field+".intensity", "must be between 0.0 and 1.0, got %v", p.Intensity)
+	}
+	return size
+}
+
+func validateWatermark(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.WatermarkParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateOutputFormat(errs, field+".format", p.Format)
+	// The file itself is resolved by the worker, which owns the watermark directory
+	if p.WatermarkPath == "" {
+		errs.Add(field+".watermark_path", "is required")
+	}
+	switch p.Position {
+	case "", entity.PositionTopLeft, entity.PositionTopRight, entity.PositionBottomLeft,
+		entity.PositionBottomRight, entity.PositionCenter:
+	default:
+		errs.Add(field+".position", "unknown position %q, expected %s, %s, %s, %s or %s", p.Position,
+			entity.PositionTopLeft, entity.PositionTopRight, entity.PositionBottomLeft,
+			entity.PositionBottomRight, entity.PositionCenter)
+	}
+	if p.Opacity < 0 || p.Opacity > 1 {
+		errs.Add(field+".opacity", "must be between 0.0 and 1.0, got %v", p.Opacity)
+	}
+	if _, ok := params["scale"]; ok && (p.Scale <= 0 || p.Scale > 1) {
+		errs.Add(field+".scale", "must be greater than 0.0 and at most 1.0, got %v", p.Scale)
+	}
+	if p.Margin < 0 {
+		errs.Add(field+".margin", "must not be negative")
+	}
+	return size
+}
+
+func validateCompress(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.CompressParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateQuality(errs, field, params, p.Quality)
+	validateOutputFormat(errs, field+".format", p.Format)
+	validateCompressionLevel(errs, field+".compression_level", p.CompressionLevel)
+	validateColor(errs, field+".background", p.Background)
+	return size
+}
+
+func validateFormat(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point) image.Point {
+	p, ok := decodeStrict[entity.FormatParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	validateQuality(errs, field, params, p.Quality)
+	if p.TargetFormat == "" {
+		errs.Add(field+".target_format", "is required")
+	} else {
+		validateOutputFormat(errs, field+".target_format", p.TargetFormat)
+	}
+	validateCompressionLevel(errs, field+".compression_level", p.CompressionLevel)
+	validateColor(errs, field+".background", p.Background)
+	return size
+}
+
+// validatePipeline validates every step against the size produced by the
+// previous ones, so a crop after a resize is checked against the resized image.
+// Every intermediate image is held in memory, so each one must be within limits.
+func validatePipeline(errs *entity.ValidationErrors, field string, params map[string]interface{}, size image.Point, limits Limits) image.Point {
+	p, ok := decodeStrict[entity.PipelineParameters](errs, field, params)
+	if !ok {
+		return size
+	}
+	if len(p.Steps) == 0 {
+		errs.Add(field+".steps", "must contain at least one step")
+		return size
+	}
+	for i, step := range p.Steps {
+		stepField := fmt.Sprintf("%s.steps[%d]", field, i)
+		if step.ProcessingType == models.ProcessingTypePipeline {
+			errs.Add(stepField+".processing_type", "pipelines cannot be nested")
+			continue
+		}
+		validate, ok := validators[step.ProcessingType]
+		if !ok {
+			errs.Add(stepField+".processing_type", "unknown processing type %q", step.ProcessingType)
+			continue
+		}
+		size = validate(errs, stepField+".parameters", step.Parameters, size)
+		limits.check(errs, stepField+".parameters", size)
+	}
+	return size
+}
+
+// decodeStrict decodes params into T and rejects fields T does not declare
+func decodeStrict[T any](errs *entity.ValidationErrors, field string, params map[string]interface{}) (T, bool) {
+	var result T
+	data, err := json.Marshal(params)
+	if err != nil {
+		errs.Add(field, "invalid parameters: %s", err.Error())
+		return result, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			errs.Add(field+"."+typeErr.Field, "must be of type %s, got %s", typeErr.Type, typeErr.Value)
+		} else if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			errs.Add(field+"."+strings.Trim(name, `"`), "unknown field")
+		} else {
+			errs.Add(field, strings.TrimPrefix(err.Error(), "json: "))
+		}
+		return result, false
+	}
+	return result, true
+}
+
+// validateQuality only checks quality when it is set, since omitting it selects the default
+func validateQuality(errs *entity.ValidationErrors, field string, params map[string]interface{}, quality int) {
+	if _, ok := params["quality"]; ok && (quality < 1 || quality > 100) {
+		errs.Add(field+".quality", "must be between 1 and 100, got %d", quality)
+	}
+}
+
+func validateOutputFormat(errs *entity.ValidationErrors, field string, format string) {
+	if format == "" {
+		return
+	}
+	if err := CheckFormat(format); err != nil {
+		errs.Add(field, err.Error())
+	}
+}
+
+func validateColor(errs *entity.ValidationErrors, field string, value string) {
+	if _, err := ParseColor(value); err != nil {
+		errs.Add(field, err.Error())
+	}
+}
+
+func validateCompressionLevel(errs *entity.ValidationErrors, field string, value string) {
+	if _, err := ParseCompressionLevel(value); err != nil {
+		errs.Add(field, err.Error())
+	}
+}
+
+// resizedSize mirrors resize, including imaging.Fit never enlarging the image
+func resizedSize(size image.Point, p entity.ResizeParameters) image.Point {
+	if size.X <= 0 || size.Y <= 0 {
+		return image.Pt(p.Width, p.Height)
+	}
+	if p.MaintainRatio && p.Width > 0 && p.Height > 0 {
+		if size.X <= p.Width && size.Y <= p.Height {
+			return size
+		}
+		ratio := float64(size.X) / float64(size.Y)
+		if ratio > float64(p.Width)/float64(p.Height) {
+			return image.Pt(p.Width, max(1, int(float64(p.Width)/ratio)))
+		}
+		return image.Pt(max(1, int(float64(p.Height)*ratio)), p.Height)
+	}
+	switch {
+	case p.Width == 0:
+		return image.Pt(max(1, int(math.Round(float64(size.X)*float64(p.Height)/float64(size.Y)))), p.Height)
+	case p.Height == 0:
+		return image.Pt(p.Width, max(1, int(math.Round(float64(size.Y)*float64(p.Width)/float64(size.X)))))
+	}
+	return image.Pt(p.Width, p.Height)
+}
+
+// rotatedSize mirrors the bounding box imaging.Rotate computes for the rotated image
+func rotatedSize(size image.Point, angle float64) image.Point {
+	if size.X <= 0 || size.Y <= 0 {
+		return size
+	}
+	sin, cos := math.Sincos(math.Pi * angle / 180)
+	rotatePoint := func(x, y float64) (float64, float64) {
+		return x*cos - y*sin, x*sin + y*cos
+	}
+	x1, y1 := rotatePoint(float64(size.X-1), 0)
+	x2, y2 := rotatePoint(float64(size.X-1), float64(size.Y-1))
+	x3, y3 := rotatePoint(0, float64(size.Y-1))
+
+	width := math.Max(x1, math.Max(x2, math.Max(x3, 0))) - math.Min(x1, math.Min(x2, math.Min(x3, 0))) + 1
+	height := math.Max(y1, math.Max(y2, math.Max(y3, 0))) - math.Min(y1, math.Min(y2, math.Min(y3, 0))) + 1
+	if width-math.Floor(width) > 0.1 {
+		width++
+	}
+	if height-math.Floor(height) > 0.1 {
+		height++
+	}
+	return image.Pt(int(width), int(height))
+}
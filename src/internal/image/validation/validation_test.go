@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+)
+
+type params = map[string]interface{}
+
+func TestValidateParameters(t *testing.T) {
+	limits := Limits{MaxDimension: 1000, MaxPixels: 500000}
+	tests := []struct {
+		name           string
+		processingType models.ProcessingType
+		params         params
+		width, height  int
+		wantFields     []string // Fields reported invalid, none for valid parameters
+	}{
+		{name: "resize", processingType: models.ProcessingTypeResize, params: params{"width": 100, "height": 100}, width: 400, height: 300},
+		{name: "resize without a size", processingType: models.ProcessingTypeResize, params: params{}, width: 400, height: 300, wantFields: []string{"parameters"}},
+		{name: "resize to a negative width", processingType: models.ProcessingTypeResize, params: params{"width": -1, "height": 100}, width: 400, height: 300, wantFields: []string{"parameters.width"}},
+		{name: "resize at the largest side", processingType: models.ProcessingTypeResize, params: params{"width": 1000, "height": 10}, width: 400, height: 300},
+		{name: "resize beyond the largest side", processingType: models.ProcessingTypeResize, params: params{"width": 1001, "height": 10}, width: 400, height: 300, wantFields: []string{"parameters"}},
+		{name: "resize beyond the pixel count", processingType: models.ProcessingTypeResize, params: params{"width": 1000, "height": 501}, width: 400, height: 300, wantFields: []string{"parameters"}},
+		{name: "resize keeping the ratio", processingType: models.ProcessingTypeResize, params: params{"width": 100000}, width: 10, height: 10, wantFields: []string{"parameters"}},
+		{name: "resize within the ratio box", processingType: models.ProcessingTypeResize, params: params{"width": 5000, "height": 5000, "maintain_ratio": true}, width: 400, height: 300},
+		{name: "resize quality out of range", processingType: models.ProcessingTypeResize, params: params{"width": 10, "quality": 101}, width: 400, height: 300, wantFields: []string{"parameters.quality"}},
+		{name: "unknown field", processingType: models.ProcessingTypeResize, params: params{"width": 10, "depth": 3}, width: 400, height: 300, wantFields: []string{"parameters.depth"}},
+		{name: "field of the wrong type", processingType: models.ProcessingTypeResize, params: params{"width": "wide"}, width: 400, height: 300, wantFields: []string{"parameters.width"}},
+		{name: "crop", processingType: models.ProcessingTypeCrop, params: params{"x": 10, "y": 10, "width": 100, "height": 100}, width: 400, height: 300},
+		{name: "crop at the edge", processingType: models.ProcessingTypeCrop, params: params{"x": 300, "y": 200, "width": 100, "height": 100}, width: 400, height: 300},
+		{name: "crop beyond the edge", processingType: models.ProcessingTypeCrop, params: params{"x": 301, "y": 200, "width": 100, "height": 100}, width: 400, height: 300, wantFields: []string{"parameters"}},
+		{name: "crop overflowing the offset", processingType: models.ProcessingTypeCrop, params: params{"x": 10, "y": 10, "width": math.MaxInt, "height": 100}, width: 400, height: 300, wantFields: []string{"parameters", "parameters"}},
+		{name: "crop of an unknown size", processingType: models.ProcessingTypeCrop, params: params{"x": 301, "y": 200, "width": 100, "height": 100}},
+		{name: "crop without a size", processingType: models.ProcessingTypeCrop, params: params{"x": -1}, width: 400, height: 300, wantFields: []string{"parameters.x", "parameters.width", "parameters.height"}},
+		{name: "rotate beyond the largest side", processingType: models.ProcessingTypeRotate, params: params{"angle": 45}, width: 900, height: 900, wantFields: []string{"parameters"}},
+		{name: "rotate", processingType: models.ProcessingTypeRotate, params: params{"angle": 90}, width: 900, height: 100},
+		{name: "filter", processingType: models.ProcessingTypeFilter, params: params{"filter_type": "blur"}, width: 400, height: 300},
+		{name: "filter intensity out of range", processingType: models.ProcessingTypeFilter, params: params{"filter_type": "blur", "intensity": 1.5}, width: 400, height: 300, wantFields: []string{"parameters.intensity"}},
+		{name: "adjustment without intensity", processingType: models.ProcessingTypeFilter, params: params{"filter_type": "brightness"}, width: 400, height: 300, wantFields: []string{"parameters.intensity"}},
+		{name: "adjustment", processingType: models.ProcessingTypeFilter, params: params{"filter_type": "brightness", "intensity": 0.7}, width: 400, height: 300},
+		{name: "unknown filter", processingType: models.ProcessingTypeFilter, params: params{"filter_type": "glow"}, width: 400, height: 300, wantFields: []string{"parameters.filter_type"}},
+		{name: "watermark opacity out of range", processingType: models.ProcessingTypeWatermark, params: params{"watermark_path": "logo.png", "opacity": 2}, width: 400, height: 300, wantFields: []string{"parameters.opacity"}},
+		{name: "compress level", processingType: models.ProcessingTypeCompress, params: params{"compression_level": "fastest"}, width: 400, height: 300, wantFields: []string{"parameters.compression_level"}},
+		{name: "format without a target", processingType: models.ProcessingTypeFormat, params: params{}, width: 400, height: 300, wantFields: []string{"parameters.target_format"}},
+		{name: "unknown processing type", processingType: "emboss", params: params{}, width: 400, height: 300, wantFields: []string{"processing_type"}},
+		{
+			name:           "pipeline crop checked against the resized image",
+			processingType: models.ProcessingTypePipeline,
+			params: params{"steps": []interface{}{
+				params{"processing_type": "resize", "parameters": params{"width": 200, "height": 150}},
+				params{"processing_type": "crop", "parameters": params{"x": 150, "y": 0, "width": 100, "height": 100}},
+			}},
+			width: 400, height: 300,
+			wantFields: []string{"parameters.steps[1].parameters"},
+		},
+		{
+			name:           "pipeline with an intermediate image beyond the limits",
+			processingType: models.ProcessingTypePipeline,
+			params: params{"steps": []interface{}{
+				params{"processing_type": "resize", "parameters": params{"width": 2000, "height": 2000}},
+				params{"processing_type": "resize", "parameters": params{"width": 100, "height": 100}},
+			}},
+			width: 400, height: 300,
+			wantFields: []string{"parameters.steps[0].parameters"},
+		},
+		{
+			name:           "nested pipeline",
+			processingType: models.ProcessingTypePipeline,
+			params: params{"steps": []interface{}{
+				params{"processing_type": "pipeline", "parameters": params{}},
+			}},
+			width: 400, height: 300,
+			wantFields: []string{"parameters.steps[0].processing_type"},
+		},
+		{name: "empty pipeline", processingType: models.ProcessingTypePipeline, params: params{"steps": []interface{}{}}, width: 400, height: 300, wantFields: []string{"parameters.steps"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateParameters(tt.processingType, tt.params, tt.width, tt.height, limits)
+			var fields []string
+			if err != nil {
+				var errs entity.ValidationErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("got %T %v, want ValidationErrors", err, err)
+				}
+				for _, e := range errs {
+					fields = append(fields, e.Field)
+				}
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("invalid fields %v, want %v (%v)", fields, tt.wantFields, err)
+			}
+		})
+	}
+}
+
+func TestLimitsDisabled(t *testing.T) {
+	params := params{"width": 100000, "height": 100000}
+	if err := ValidateParameters(models.ProcessingTypeResize, params, 10, 10, Limits{}); err != nil {
+		t.Errorf("zero limits rejected the resize: %v", err)
+	}
+}
@@ -14,11 +14,23 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-func Authentication(cfg *config.Config, tokenProvider auth.TokenProvider) gin.HandlerFunc {
+// Authentication requires a valid access token in the Authorization header.
+// Browsers cannot set headers on EventSource and WebSocket requests, so the
+// stream requests of queryTokenRoutes may pass it in the access_token query
+// parameter instead.
+func Authentication(cfg *config.Config, tokenProvider auth.TokenProvider, queryTokenRoutes ...string) gin.HandlerFunc {
+	allowQueryToken := make(map[string]bool, len(queryTokenRoutes))
+	for _, route := range queryTokenRoutes {
+		allowQueryToken[route] = true
+	}
 	return func(c *gin.Context) {
 		var err error
 		claimMap := map[string]interface{}{}
 		auth := c.GetHeader(constants.AuthorizationHeaderKey)
+		queryToken := takeQueryToken(c)
+		if auth == "" && queryToken != "" && allowQueryToken[c.FullPath()] && isStreamRequest(c) {
+			auth = "Bearer " + queryToken
+		}
 		token := strings.Split(auth, " ")
 		if auth == "" || len(token) < 2 {
 			err = &service_errors.ServiceError{EndUserMessage: service_errors.TokenRequired}
@@ -52,6 +64,25 @@ func Authentication(cfg *config.Config, tokenProvider auth.TokenProvider) gin.Ha
 		c.Next()
 	}
 }
+
+// takeQueryToken removes the access_token query parameter from the request and
+// returns it, so the token does not end up in the logs of the request URL
+func takeQueryToken(c *gin.Context) string {
+	query := c.Request.URL.Query()
+	token := query.Get(constants.AccessTokenQueryKey)
+	if !query.Has(constants.AccessTokenQueryKey) {
+		return token
+	}
+	query.Del(constants.AccessTokenQueryKey)
+	c.Request.URL.RawQuery = query.Encode()
+	c.Request.RequestURI = c.Request.URL.RequestURI()
+	return token
+}
+
+func isStreamRequest(c *gin.Context) bool {
+	return c.IsWebsocket() || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
 func Authorization(validRoles []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if len(c.Keys) == 0 {
@@ -0,0 +1,170 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/idempotency/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/idempotency/domain/repository"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/helper"
+	"github.com/alielmi98/image-processing-service/pkg/service_errors"
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotency answers a request retried with the same Idempotency-Key header
+// with the response of the first one instead of running it again. Keys are
+// scoped to the user, so it must run after Authentication.
+func Idempotency(cfg *config.Config, repo repository.IdempotencyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(constants.IdempotencyKeyHeader)
+		userId, ok := c.Value(constants.UserIdKey).(float64)
+		if key == "" || !ok {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError,
+				fmt.Errorf("%s must not be longer than %d characters", constants.IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, cfg.Idempotency.MaxBodySize))
+		if err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.AbortWithStatusJSON(status, helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash, err := hashRequest(c.Request, body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helper.GenerateBaseResponseWithError(nil, false, helper.ValidationError, err))
+			return
+		}
+
+		// The key is leased while the request runs, so the key of a request
+		// that never finished can be used again once the lease is over
+		stored, reserved, err := repo.ReserveIdempotencyKey(c, models.IdempotencyKey{
+			UserId:      int(userId),
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().UTC().Add(cfg.Idempotency.LeaseTimeout),
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helper.GenerateBaseResponseWithError(nil, false, helper.DatabaseError, err))
+			return
+		}
+		if !reserved {
+			replayResponse(c, stored, requestHash)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The response is stored even if the client has gone away in the meantime
+		ctx := context.WithoutCancel(c.Request.Context())
+		// Server errors are not stored, so the request can be retried with the same key
+		if recorder.Status() >= http.StatusInternalServerError {
+			repo.DeleteIdempotencyKey(ctx, stored.Id)
+			return
+		}
+		expiresAt := time.Now().UTC().Add(cfg.Idempotency.Window)
+		err = repo.CompleteIdempotencyKey(ctx, stored.Id, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes(), expiresAt)
+		if err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Update, err.Error())
+		}
+	}
+}
+
+// replayResponse answers a retry with the stored response, or rejects it if
+// the key was used for another request or the first one is still running
+func replayResponse(c *gin.Context, stored models.IdempotencyKey, requestHash string) {
+	var err error
+	switch {
+	case stored.RequestHash != requestHash:
+		err = &service_errors.ServiceError{EndUserMessage: service_errors.IdempotencyKeyReused}
+	case !stored.StatusCode.Valid:
+		err = &service_errors.ServiceError{EndUserMessage: service_errors.IdempotencyKeyInProgress}
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(helper.TranslateErrorToStatusCode(err), helper.GenerateBaseResponseWithError(nil, false, helper.ConflictError, err))
+		return
+	}
+
+	c.Header(constants.IdempotentReplayedHeader, "true")
+	c.Data(int(stored.StatusCode.Int64), stored.ContentType, stored.ResponseBody)
+	c.Abort()
+}
+
+// hashRequest identifies a request by its method, path and body, so reusing
+// a key for another endpoint is detected as well. A multipart body is hashed
+// by its parts, as its boundary differs from one attempt to the next.
+func hashRequest(r *http.Request, body []byte) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		hash.Write(body)
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid multipart body: %w", err)
+		}
+		content := sha256.New()
+		if _, err := io.Copy(content, part); err != nil {
+			return "", fmt.Errorf("invalid multipart body: %w", err)
+		}
+		parts = append(parts, fmt.Sprintf("%q %q %x", part.FormName(), part.FileName(), content.Sum(nil)))
+	}
+	// Clients do not have to send the fields in the same order
+	sort.Strings(parts)
+	for _, part := range parts {
+		fmt.Fprintln(hash, part)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// responseRecorder keeps a copy of the response body written through it
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,321 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/idempotency/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotencyRepository keeps the keys the way the Postgres repository does
+type memoryIdempotencyRepository struct {
+	mu     sync.Mutex
+	keys   map[string]*models.IdempotencyKey
+	nextId int
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{keys: make(map[string]*models.IdempotencyKey)}
+}
+
+func (r *memoryIdempotencyRepository) ReserveIdempotencyKey(ctx context.Context, key models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := fmt.Sprintf("%d/%s", key.UserId, key.Key)
+	if stored, ok := r.keys[name]; ok && stored.ExpiresAt.After(time.Now()) {
+		return *stored, false, nil
+	}
+	r.nextId++
+	key.Id = r.nextId
+	r.keys[name] = &key
+	return key, true, nil
+}
+
+func (r *memoryIdempotencyRepository) CompleteIdempotencyKey(ctx context.Context, id int, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.Id == id {
+			key.StatusCode = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+			key.ContentType = contentType
+			key.ResponseBody = body
+			key.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteIdempotencyKey(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, key := range r.keys {
+		if key.Id == id {
+			delete(r.keys, name)
+		}
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+type idempotentRequest struct {
+	key         string
+	contentType string
+	body        string
+	path        string
+}
+
+func jsonRequest(key, body string) idempotentRequest {
+	return idempotentRequest{key: key, contentType: "application/json", body: body, path: "/jobs"}
+}
+
+func multipartRequest(t *testing.T, key string, fields [][2]string) idempotentRequest {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	return idempotentRequest{key: key, contentType: writer.FormDataContentType(), body: body.String(), path: "/jobs"}
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type attempt struct {
+		request      idempotentRequest
+		status       int  // Answered by the handler
+		wantStatus   int  // Answered to the client
+		wantHandled  bool // Whether the handler ran
+		wantReplayed bool
+	}
+	tests := []struct {
+		name     string
+		attempts func(t *testing.T) []attempt
+	}{
+		{
+			name: "retry replays the response",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantReplayed: true},
+				}
+			},
+		},
+		{
+			name: "key reused for another body",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: jsonRequest("a", `{"id":2}`), status: http.StatusCreated, wantStatus: http.StatusConflict},
+				}
+			},
+		},
+		{
+			name: "key reused for another endpoint",
+			attempts: func(t *testing.T) []attempt {
+				other := jsonRequest("a", `{"id":1}`)
+				other.path = "/batch"
+				return []attempt{
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: other, status: http.StatusCreated, wantStatus: http.StatusConflict},
+				}
+			},
+		},
+		{
+			name: "different keys run twice",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: jsonRequest("b", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+				}
+			},
+		},
+		{
+			name: "client errors are replayed",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("a", `{}`), status: http.StatusBadRequest, wantStatus: http.StatusBadRequest, wantHandled: true},
+					{request: jsonRequest("a", `{}`), status: http.StatusCreated, wantStatus: http.StatusBadRequest, wantReplayed: true},
+				}
+			},
+		},
+		{
+			name: "server errors free the key",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError, wantHandled: true},
+					{request: jsonRequest("a", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+				}
+			},
+		},
+		{
+			name: "multipart retry with another boundary and field order",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: multipartRequest(t, "a", [][2]string{{"name", "cat"}, {"size", "1"}}), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: multipartRequest(t, "a", [][2]string{{"size", "1"}, {"name", "cat"}}), status: http.StatusCreated, wantStatus: http.StatusCreated, wantReplayed: true},
+				}
+			},
+		},
+		{
+			name: "multipart retry with other content",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: multipartRequest(t, "a", [][2]string{{"name", "cat"}}), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: multipartRequest(t, "a", [][2]string{{"name", "dog"}}), status: http.StatusCreated, wantStatus: http.StatusConflict},
+				}
+			},
+		},
+		{
+			name: "body too large",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("a", strings.Repeat("x", 1025)), status: http.StatusCreated, wantStatus: http.StatusRequestEntityTooLarge},
+				}
+			},
+		},
+		{
+			name: "without a key",
+			attempts: func(t *testing.T) []attempt {
+				return []attempt{
+					{request: jsonRequest("", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+					{request: jsonRequest("", `{"id":1}`), status: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Idempotency: config.IdempotencyConfig{
+				Window:       time.Hour,
+				LeaseTimeout: time.Minute,
+				MaxBodySize:  1024,
+			}}
+			repo := newMemoryIdempotencyRepository()
+
+			for i, a := range tt.attempts(t) {
+				handled := false
+				router := gin.New()
+				router.Use(func(c *gin.Context) {
+					c.Set(constants.UserIdKey, float64(1))
+				}, Idempotency(cfg, repo))
+				handler := func(c *gin.Context) {
+					handled = true
+					c.JSON(a.status, gin.H{"attempt": i})
+				}
+				router.POST("/jobs", handler)
+				router.POST("/batch", handler)
+
+				req := httptest.NewRequest(http.MethodPost, a.request.path, strings.NewReader(a.request.body))
+				req.Header.Set("Content-Type", a.request.contentType)
+				if a.request.key != "" {
+					req.Header.Set(constants.IdempotencyKeyHeader, a.request.key)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != a.wantStatus {
+					t.Errorf("attempt %d: status %d, want %d", i, rec.Code, a.wantStatus)
+				}
+				if handled != a.wantHandled {
+					t.Errorf("attempt %d: handled %v, want %v", i, handled, a.wantHandled)
+				}
+				replayed := rec.Header().Get(constants.IdempotentReplayedHeader) == "true"
+				if replayed != a.wantReplayed {
+					t.Errorf("attempt %d: replayed %v, want %v", i, replayed, a.wantReplayed)
+				}
+				if replayed && rec.Body.String() != `{"attempt":0}` {
+					t.Errorf("attempt %d: replayed %s, want the first response", i, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Idempotency: config.IdempotencyConfig{
+		Window:       time.Hour,
+		LeaseTimeout: time.Minute,
+		MaxBodySize:  1024,
+	}}
+	repo := newMemoryIdempotencyRepository()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(constants.UserIdKey, float64(1))
+	}, Idempotency(cfg, repo))
+	var retry *httptest.ResponseRecorder
+	router.POST("/jobs", func(c *gin.Context) {
+		// Retried while the first request is still running
+		retry = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{}`))
+		req.Header.Set(constants.IdempotencyKeyHeader, "a")
+		router.ServeHTTP(retry, req)
+		c.Status(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{}`))
+	req.Header.Set(constants.IdempotencyKeyHeader, "a")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("first request status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if retry == nil || retry.Code != http.StatusConflict {
+		t.Fatalf("retry in progress was not rejected as a conflict")
+	}
+}
+
+// An in-progress key is only leased for LeaseTimeout, so a request that died
+// without completing it does not block retries for the whole window
+func TestIdempotencyLease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Idempotency: config.IdempotencyConfig{
+		Window:       time.Hour,
+		LeaseTimeout: time.Minute,
+		MaxBodySize:  1024,
+	}}
+	repo := newMemoryIdempotencyRepository()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(constants.UserIdKey, float64(1))
+	}, Idempotency(cfg, repo))
+	var leased time.Time
+	router.POST("/jobs", func(c *gin.Context) {
+		leased = repo.keys["1/a"].ExpiresAt
+		c.Status(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{}`))
+	req.Header.Set(constants.IdempotencyKeyHeader, "a")
+	start := time.Now()
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if leased.Before(start) || leased.After(start.Add(2*time.Minute)) {
+		t.Errorf("in-progress key expires at %v, want within the lease of %v", leased, cfg.Idempotency.LeaseTimeout)
+	}
+	if expires := repo.keys["1/a"].ExpiresAt; expires.Before(start.Add(cfg.Idempotency.Window - time.Minute)) {
+		t.Errorf("completed key expires at %v, want after the window of %v", expires, cfg.Idempotency.Window)
+	}
+}
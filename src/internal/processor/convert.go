@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+)
+
+const defaultCompressQuality = 75
+
+func compress(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.CompressParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if p.Quality == 0 {
+		p.Quality = defaultCompressQuality
+	}
+	if p.CompressionLevel == "" {
+		p.CompressionLevel = "best-compression"
+	}
+	encoding, err := validateEncoding(p.Format, p.Quality)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if err := applyEncodingOptions(&encoding, p.CompressionLevel, p.Background); err != nil {
+		return nil, Encoding{}, err
+	}
+	return img, encoding, nil
+}
+
+func convert(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.FormatParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if p.TargetFormat == "" {
+		return nil, Encoding{}, fmt.Errorf("target_format is required")
+	}
+	encoding, err := validateEncoding(p.TargetFormat, p.Quality)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if err := applyEncodingOptions(&encoding, p.CompressionLevel, p.Background); err != nil {
+		return nil, Encoding{}, err
+	}
+	return img, encoding, nil
+}
+
+func applyEncodingOptions(encoding *Encoding, compressionLevel string, background string) error {
+	level, err := validation.ParseCompressionLevel(compressionLevel)
+	if err != nil {
+		return err
+	}
+	encoding.CompressionLevel = level
+
+	if background != "" {
+		fill, err := validation.ParseColor(background)
+		if err != nil {
+			return err
+		}
+		encoding.Background = fill
+	}
+	return nil
+}
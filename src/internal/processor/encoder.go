@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+const defaultJPEGQuality = 90
+
+// Encoder writes an image in a single output format
+type Encoder struct {
+	Extension string
+	MimeType  string
+	Encode    func(w io.Writer, img image.Image, encoding Encoding) error
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{
+		"jpg":  {Extension: ".jpg", MimeType: "image/jpeg", Encode: encodeJPEG},
+		"jpeg": {Extension: ".jpg", MimeType: "image/jpeg", Encode: encodeJPEG},
+		"png":  {Extension: ".png", MimeType: "image/png", Encode: encodePNG},
+		"gif":  {Extension: ".gif", MimeType: "image/gif", Encode: encodeGIF},
+		"bmp":  {Extension: ".bmp", MimeType: "image/bmp", Encode: encodeBMP},
+		"tif":  {Extension: ".tiff", MimeType: "image/tiff", Encode: encodeTIFF},
+		"tiff": {Extension: ".tiff", MimeType: "image/tiff", Encode: encodeTIFF},
+		"webp": {Extension: ".webp", MimeType: "image/webp", Encode: encodeWebP},
+	}
+)
+
+// RegisterEncoder adds or replaces the encoder for a format name and lets
+// jobs validated in this process use it
+func RegisterEncoder(format string, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[strings.ToLower(format)] = encoder
+	validation.RegisterFormat(format)
+}
+
+// LookupEncoder returns the encoder registered for a format name or file extension
+func LookupEncoder(format string) (Encoder, error) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	encoder, ok := encoders[strings.ToLower(strings.TrimPrefix(format, "."))]
+	if !ok {
+		names := make([]string, 0, len(encoders))
+		for n := range encoders {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Encoder{}, fmt.Errorf("unsupported output format %q, supported formats: %s", format, strings.Join(names, ", "))
+	}
+	return encoder, nil
+}
+
+func encodeJPEG(w io.Writer, img image.Image, encoding Encoding) error {
+	quality := encoding.Quality
+	if quality == 0 {
+		quality = defaultJPEGQuality
+	}
+	return jpeg.Encode(w, flatten(img, encoding.Background), &jpeg.Options{Quality: quality})
+}
+
+func encodePNG(w io.Writer, img image.Image, encoding Encoding) error {
+	var encoder png.Encoder
+	if encoding.CompressionLevel != nil {
+		encoder.CompressionLevel = *encoding.CompressionLevel
+	}
+	return encoder.Encode(w, img)
+}
+
+func encodeGIF(w io.Writer, img image.Image, encoding Encoding) error {
+	return gif.Encode(w, flatten(img, encoding.Background), &gif.Options{NumColors: 256})
+}
+
+func encodeBMP(w io.Writer, img image.Image, encoding Encoding) error {
+	return bmp.Encode(w, flatten(img, encoding.Background))
+}
+
+func encodeTIFF(w io.Writer, img image.Image, encoding Encoding) error {
+	return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+}
+
+// encodeWebP writes lossless WebP, so quality is ignored
+func encodeWebP(w io.Writer, img image.Image, encoding Encoding) error {
+	return nativewebp.Encode(w, img, nil)
+}
+
+// flatten draws the image over an opaque background so transparent pixels
+// do not turn black in formats without an alpha channel
+func flatten(img image.Image, background color.Color) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	fill := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	if background != nil {
+		if c := color.NRGBAModel.Convert(background).(color.NRGBA); c.A > 0 {
+			fill = color.NRGBA{R: c.R, G: c.G, B: c.B, A: 255}
+		}
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(fill), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestEncoders(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	tests := []struct {
+		format     string
+		wantFormat string      // Reported by image.Decode
+		wantPixel  color.NRGBA // Of a transparent pixel over a red background
+	}{
+		{format: "jpg", wantFormat: "jpeg", wantPixel: red},
+		{format: "JPEG", wantFormat: "jpeg", wantPixel: red},
+		{format: ".png", wantFormat: "png"},
+		{format: "gif", wantFormat: "gif", wantPixel: red},
+		{format: "bmp", wantFormat: "bmp", wantPixel: red},
+		{format: "tif", wantFormat: "tiff"},
+		{format: "webp", wantFormat: "webp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			encoder, err := LookupEncoder(tt.format)
+			if err != nil {
+				t.Fatalf("LookupEncoder: %v", err)
+			}
+			var buf bytes.Buffer
+			img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+			if err := encoder.Encode(&buf, img, Encoding{Background: red}); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			decoded, format, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("format %s, want %s", format, tt.wantFormat)
+			}
+			// Lossy formats only come close to the background
+			got := imaging.Clone(decoded).NRGBAAt(0, 0)
+			if diff(got.R, tt.wantPixel.R) > 2 || diff(got.G, tt.wantPixel.G) > 2 || got.A != tt.wantPixel.A {
+				t.Errorf("pixel %v, want %v", got, tt.wantPixel)
+			}
+		})
+	}
+}
+
+func diff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestLookupEncoderUnknown(t *testing.T) {
+	if _, err := LookupEncoder("psd"); err == nil {
+		t.Error("unknown format found an encoder")
+	}
+}
+
+func TestEncodingParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      Operation
+		params  map[string]interface{}
+		want    Encoding
+		wantErr bool
+	}{
+		{name: "compress defaults", op: compress, params: map[string]interface{}{}, want: Encoding{Quality: 75, CompressionLevel: levelOf(png.BestCompression)}},
+		{name: "compress to webp", op: compress, params: map[string]interface{}{"format": "webp", "quality": 60}, want: Encoding{Format: "webp", Quality: 60, CompressionLevel: levelOf(png.BestCompression)}},
+		{name: "compress at a named level", op: compress, params: map[string]interface{}{"compression_level": "best-speed"}, want: Encoding{Quality: 75, CompressionLevel: levelOf(png.BestSpeed)}},
+		{name: "compress at an unknown level", op: compress, params: map[string]interface{}{"compression_level": "max"}, wantErr: true},
+		{name: "convert", op: convert, params: map[string]interface{}{"target_format": "png"}, want: Encoding{Format: "png"}},
+		{name: "convert with a background", op: convert, params: map[string]interface{}{"target_format": "jpg", "background": "#000"}, want: Encoding{Format: "jpg", Background: color.NRGBA{A: 255}}},
+		{name: "convert without a target", op: convert, params: map[string]interface{}{}, wantErr: true},
+		{name: "convert to an unknown format", op: convert, params: map[string]interface{}{"target_format": "psd"}, wantErr: true},
+		{name: "convert quality out of range", op: convert, params: map[string]interface{}{"target_format": "jpg", "quality": 101}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := tt.op(context.Background(), image.NewNRGBA(image.Rect(0, 0, 1, 1)), tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encoding %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
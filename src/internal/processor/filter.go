@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"github.com/disintegration/imaging"
+)
+
+// FilterFunc applies a named filter. Intensity is always within 0.0-1.0 and
+// each filter maps it onto its own parameters.
+type FilterFunc func(img image.Image, intensity float64) (image.Image, error)
+
+var (
+	filtersMu sync.RWMutex
+	filters   = map[string]FilterFunc{
+		"blur":       blurFilter,
+		"sharpen":    sharpenFilter,
+		"grayscale":  blendFilter(func(img image.Image) image.Image { return imaging.Grayscale(img) }),
+		"sepia":      blendFilter(sepia),
+		"invert":     blendFilter(func(img image.Image) image.Image { return imaging.Invert(img) }),
+		"brightness": percentageFilter(imaging.AdjustBrightness),
+		"contrast":   percentageFilter(imaging.AdjustContrast),
+		"saturation": percentageFilter(imaging.AdjustSaturation),
+	}
+)
+
+// RegisterFilter adds or replaces a named filter and lets jobs validated in
+// this process use it
+func RegisterFilter(name string, fn FilterFunc) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	filters[strings.ToLower(name)] = fn
+	validation.RegisterFilter(name)
+}
+
+// LookupFilter returns the filter registered under name
+func LookupFilter(name string) (FilterFunc, error) {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+	fn, ok := filters[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(filters))
+		for n := range filters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown filter type %q, supported filters: %s", name, strings.Join(names, ", "))
+	}
+	return fn, nil
+}
+
+func filter(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.FilterParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	// An omitted intensity means the filter is applied at full strength
+	if _, ok := params["intensity"]; !ok {
+		if validation.IsAdjustment(p.FilterType) {
+			return nil, Encoding{}, fmt.Errorf("intensity is required for the %s filter", p.FilterType)
+		}
+		p.Intensity = 1
+	}
+	if p.Intensity < 0 || p.Intensity > 1 {
+		return nil, Encoding{}, fmt.Errorf("intensity must be between 0.0 and 1.0, got %v", p.Intensity)
+	}
+	encoding, err := validateEncoding(p.Format, 0)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	fn, err := LookupFilter(p.FilterType)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+
+	out, err := fn(img, p.Intensity)
+	if err != nil {
+		return nil, Encoding{}, fmt.Errorf("filter %s failed: %w", p.FilterType, err)
+	}
+	return out, encoding, nil
+}
+
+// blurFilter maps intensity onto a gaussian sigma of up to 10
+func blurFilter(img image.Image, intensity float64) (image.Image, error) {
+	return imaging.Blur(img, intensity*10), nil
+}
+
+// sharpenFilter maps intensity onto an unsharp mask sigma of up to 5
+func sharpenFilter(img image.Image, intensity float64) (image.Image, error) {
+	return imaging.Sharpen(img, intensity*5), nil
+}
+
+// blendFilter mixes the fully filtered image with the original by intensity
+func blendFilter(apply func(image.Image) image.Image) FilterFunc {
+	return func(img image.Image, intensity float64) (image.Image, error) {
+		base := imaging.Clone(img)
+		return imaging.Overlay(base, apply(base), image.Pt(0, 0), intensity), nil
+	}
+}
+
+// percentageFilter maps intensity onto -100%..+100%, where 0.5 leaves the image unchanged
+func percentageFilter(adjust func(image.Image, float64) *image.NRGBA) FilterFunc {
+	return func(img image.Image, intensity float64) (image.Image, error) {
+		return adjust(img, (intensity-0.5)*200), nil
+	}
+}
+
+func sepia(img image.Image) image.Image {
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		return color.NRGBA{
+			R: clampChannel(0.393*r + 0.769*g + 0.189*b),
+			G: clampChannel(0.349*r + 0.686*g + 0.168*b),
+			B: clampChannel(0.272*r + 0.534*g + 0.131*b),
+			A: c.A,
+		}
+	})
+}
+
+func clampChannel(v float64) uint8 {
+	if v > 255 {
+		return 255
+	}
+	if v < 0 {
+		return 0
+	}
+	return uint8(v + 0.5)
+}
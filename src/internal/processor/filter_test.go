@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"github.com/disintegration/imaging"
+)
+
+func TestFilter(t *testing.T) {
+	gray := color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		want    color.NRGBA // Of the top-left pixel
+		wantErr bool
+	}{
+		{name: "invert at full strength by default", params: map[string]interface{}{"filter_type": "invert"}, want: color.NRGBA{R: 155, G: 155, B: 155, A: 255}},
+		{name: "invert at zero intensity", params: map[string]interface{}{"filter_type": "invert", "intensity": 0}, want: gray},
+		{name: "filter names ignore case", params: map[string]interface{}{"filter_type": "Invert"}, want: color.NRGBA{R: 155, G: 155, B: 155, A: 255}},
+		{name: "brightness at the midpoint", params: map[string]interface{}{"filter_type": "brightness", "intensity": 0.5}, want: gray},
+		{name: "brightness at full strength", params: map[string]interface{}{"filter_type": "brightness", "intensity": 1}, want: color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+		{name: "blur of a plain image", params: map[string]interface{}{"filter_type": "blur", "intensity": 0.3}, want: gray},
+		{name: "unknown filter", params: map[string]interface{}{"filter_type": "glow"}, wantErr: true},
+		{name: "intensity above the range", params: map[string]interface{}{"filter_type": "blur", "intensity": 1.5}, wantErr: true},
+		{name: "intensity below the range", params: map[string]interface{}{"filter_type": "blur", "intensity": -0.1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := imaging.New(8, 8, gray)
+			got, _, err := filter(context.Background(), img, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if pixel := imaging.Clone(got).NRGBAAt(0, 0); pixel != tt.want {
+				t.Errorf("pixel %v, want %v", pixel, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterFilter(t *testing.T) {
+	var gotIntensity float64
+	RegisterFilter("Test-Noop", func(img image.Image, intensity float64) (image.Image, error) {
+		gotIntensity = intensity
+		return img, nil
+	})
+	params := map[string]interface{}{"filter_type": "test-noop", "intensity": 0.25}
+	if _, _, err := filter(context.Background(), imaging.New(1, 1, color.NRGBA{}), params); err != nil {
+		t.Fatalf("registered filter: %v", err)
+	}
+	if gotIntensity != 0.25 {
+		t.Errorf("intensity %v, want 0.25", gotIntensity)
+	}
+	if err := validation.CheckFilter("test-noop"); err != nil {
+		t.Errorf("registered filter rejected by validation: %v", err)
+	}
+}
+
+// The API validates jobs without the registries of the worker, so every
+// built-in filter and encoder must be known to the validation package
+func TestBuiltinsValidated(t *testing.T) {
+	for name := range filters {
+		if err := validation.CheckFilter(name); err != nil {
+			t.Errorf("filter %s: %v", name, err)
+		}
+	}
+	for format := range encoders {
+		if err := validation.CheckFormat(format); err != nil {
+			t.Errorf("format %s: %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+// EXIF tag and JPEG markers read to find the orientation of a photo
+const (
+	markerSOI        = 0xffd8
+	markerAPP1       = 0xffe1
+	markerSOS        = 0xffda
+	exifHeader       = "Exif\x00\x00"
+	orientationTag   = 0x0112
+	exifTagSize      = 12
+	maxExifTagsCount = 1 << 10
+)
+
+// ImageSize returns the size of an encoded image as it is processed, that is
+// after the rotation its EXIF orientation asks for. Photos taken in portrait
+// are often stored in landscape with an orientation that turns them upright.
+func ImageSize(r io.ReadSeeker) (width, height int, err error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	// Orientations 5 to 8 rotate the image by a quarter turn
+	if orientation := readOrientation(r); orientation >= 5 && orientation <= 8 {
+		return config.Height, config.Width, nil
+	}
+	return config.Width, config.Height, nil
+}
+
+// readOrientation reads the EXIF orientation of a JPEG image, 0 when the
+// image has none or is no JPEG
+func readOrientation(r io.Reader) int {
+	var marker uint16
+	if binary.Read(r, binary.BigEndian, &marker) != nil || marker != markerSOI {
+		return 0
+	}
+	for {
+		var size uint16
+		if binary.Read(r, binary.BigEndian, &marker) != nil || marker == markerSOS {
+			return 0
+		}
+		if binary.Read(r, binary.BigEndian, &size) != nil || size < 2 {
+			return 0
+		}
+		if marker != markerAPP1 {
+			if _, err := io.CopyN(io.Discard, r, int64(size)-2); err != nil {
+				return 0
+			}
+			continue
+		}
+		segment := make([]byte, size-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return 0
+		}
+		if orientation := exifOrientation(segment); orientation != 0 {
+			return orientation
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag of an APP1 segment
+func exifOrientation(segment []byte) int {
+	if len(segment) < len(exifHeader)+8 || string(segment[:len(exifHeader)]) != exifHeader {
+		return 0
+	}
+	tiff := segment[len(exifHeader):]
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	if count > maxExifTagsCount {
+		return 0
+	}
+	for i := 0; i < count; i++ {
+		tag := offset + 2 + i*exifTagSize
+		if tag+exifTagSize > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[tag:]) == orientationTag {
+			return int(order.Uint16(tiff[tag+8:]))
+		}
+	}
+	return 0
+}
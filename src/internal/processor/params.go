@@ -0,0 +1,29 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/alielmi98/image-processing-service/common"
+)
+
+// decodeParameters maps the free-form job parameters onto a typed parameter struct
+func decodeParameters[T any](params map[string]interface{}) (T, error) {
+	result, err := common.TypeConverter[T](params)
+	if err != nil {
+		return result, fmt.Errorf("invalid parameters: %w", err)
+	}
+	return result, nil
+}
+
+// validateEncoding checks the optional output format and quality shared by most operations
+func validateEncoding(format string, quality int) (Encoding, error) {
+	if quality < 0 || quality > 100 {
+		return Encoding{}, fmt.Errorf("quality must be between 1 and 100, got %d", quality)
+	}
+	if format != "" {
+		if _, err := LookupEncoder(format); err != nil {
+			return Encoding{}, err
+		}
+	}
+	return Encoding{Format: format, Quality: quality}, nil
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+)
+
+// pipeline runs every step on the same decoded image, so the result is encoded only once
+func (p *Processor) pipeline(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	pipeline, err := decodeParameters[entity.PipelineParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if len(pipeline.Steps) == 0 {
+		return nil, Encoding{}, fmt.Errorf("pipeline has no steps")
+	}
+
+	var encoding Encoding
+	for i, step := range pipeline.Steps {
+		if err := ctx.Err(); err != nil {
+			return nil, Encoding{}, err
+		}
+
+		op, ok := p.operations[step.ProcessingType]
+		if !ok || step.ProcessingType == models.ProcessingTypePipeline {
+			return nil, Encoding{}, fmt.Errorf("pipeline step %d: unsupported processing type: %s", i, step.ProcessingType)
+		}
+		out, stepEncoding, err := op(ctx, img, step.Parameters)
+		if err != nil {
+			return nil, Encoding{}, fmt.Errorf("pipeline step %d (%s) failed: %w", i, step.ProcessingType, err)
+		}
+		img = out
+		encoding = mergeEncoding(encoding, stepEncoding)
+		// Encoding the result counts as one more step
+		reportProgress(ctx, (i+1)*100/(len(pipeline.Steps)+1))
+	}
+	return img, encoding, nil
+}
+
+// mergeEncoding lets later steps override the output settings of earlier ones
+func mergeEncoding(base, next Encoding) Encoding {
+	if next.Format != "" {
+		base.Format = next.Format
+	}
+	if next.Quality != 0 {
+		base.Quality = next.Quality
+	}
+	if next.CompressionLevel != nil {
+		base.CompressionLevel = next.CompressionLevel
+	}
+	if next.Background != nil {
+		base.Background = next.Background
+	}
+	return base
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context through which long running operations report
+// how far they got, in percent
+func WithProgress(ctx context.Context, report func(percent int)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+func reportProgress(ctx context.Context, percent int) {
+	if report, ok := ctx.Value(progressKey{}).(func(percent int)); ok {
+		report(percent)
+	}
+}
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/pkg/config"
+)
+
+type steps = []interface{}
+
+func step(processingType string, params map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"processing_type": processingType, "parameters": params}
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      steps
+		wantWidth  int
+		wantHeight int
+		wantFormat string
+		wantErr    bool
+	}{
+		{
+			name: "steps see the output of the previous step",
+			steps: steps{
+				step("resize", map[string]interface{}{"width": 20, "height": 10}),
+				step("crop", map[string]interface{}{"x": 0, "y": 0, "width": 20, "height": 10}),
+				step("rotate", map[string]interface{}{"angle": 90}),
+			},
+			wantWidth: 10, wantHeight: 20,
+		},
+		{
+			name: "later steps override the output format",
+			steps: steps{
+				step("compress", map[string]interface{}{"format": "jpg"}),
+				step("format", map[string]interface{}{"target_format": "png"}),
+			},
+			wantWidth: 40, wantHeight: 20, wantFormat: "png",
+		},
+		{
+			name: "crop beyond the resized image",
+			steps: steps{
+				step("resize", map[string]interface{}{"width": 20, "height": 10}),
+				step("crop", map[string]interface{}{"x": 0, "y": 0, "width": 30, "height": 10}),
+			},
+			wantErr: true,
+		},
+		{name: "nested pipeline", steps: steps{step("pipeline", map[string]interface{}{"steps": steps{}})}, wantErr: true},
+		{name: "unknown step", steps: steps{step("emboss", nil)}, wantErr: true},
+		{name: "no steps", steps: steps{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(&config.Config{}, nil)
+			img, encoding, err := p.pipeline(context.Background(), image.NewNRGBA(image.Rect(0, 0, 40, 20)), map[string]interface{}{"steps": tt.steps})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if img.Bounds().Dx() != tt.wantWidth || img.Bounds().Dy() != tt.wantHeight {
+				t.Errorf("size %dx%d, want %dx%d", img.Bounds().Dx(), img.Bounds().Dy(), tt.wantWidth, tt.wantHeight)
+			}
+			if encoding.Format != tt.wantFormat {
+				t.Errorf("format %q, want %q", encoding.Format, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestPipelineCompressionLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []map[string]interface{}
+		want  *png.CompressionLevel
+	}{
+		{
+			name:  "unset by convert",
+			steps: []map[string]interface{}{{"target_format": "png"}},
+			want:  nil,
+		},
+		{
+			name:  "best by default for compress",
+			steps: []map[string]interface{}{{"format": "png"}},
+			want:  levelOf(png.BestCompression),
+		},
+		{
+			name: "kept by a later step that does not set it",
+			steps: []map[string]interface{}{
+				{"format": "png", "compression_level": "best-speed"},
+				{"target_format": "png"},
+			},
+			want: levelOf(png.BestSpeed),
+		},
+		{
+			name: "default overrides an earlier level",
+			steps: []map[string]interface{}{
+				{"format": "png"},
+				{"target_format": "png", "compression_level": "default"},
+			},
+			want: levelOf(png.DefaultCompression),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			var encoding Encoding
+			for _, params := range tt.steps {
+				op := convert
+				if _, ok := params["target_format"]; !ok {
+					op = compress
+				}
+				_, stepEncoding, err := op(context.Background(), img, params)
+				if err != nil {
+					t.Fatalf("step %v: %v", params, err)
+				}
+				encoding = mergeEncoding(encoding, stepEncoding)
+			}
+
+			got := encoding.CompressionLevel
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("compression level %d, want unset", *got)
+			case tt.want != nil && got == nil:
+				t.Errorf("compression level unset, want %d", *tt.want)
+			case tt.want != nil && *got != *tt.want:
+				t.Errorf("compression level %d, want %d", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func levelOf(level png.CompressionLevel) *png.CompressionLevel {
+	return &level
+}
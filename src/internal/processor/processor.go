@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+	"github.com/disintegration/imaging"
+)
+
+// Operation applies a single processing type to a decoded image
+type Operation func(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error)
+
+// Encoding describes how the processed image should be written
+type Encoding struct {
+	Format           string                // output format, empty keeps the source format
+	Quality          int                   // 1-100, only used by lossy formats
+	CompressionLevel *png.CompressionLevel // only used by PNG, nil when not set
+	Background       color.Color           // fill for transparent pixels in formats without alpha
+}
+
+// Result describes the file produced by a processing job
+type Result struct {
+	Path     string
+	FileSize int64
+	Width    int
+	Height   int
+	MimeType string
+}
+
+type Processor struct {
+	operations map[models.ProcessingType]Operation
+	limits     validation.Limits
+}
+
+// NewProcessor creates a processor with every built-in operation registered
+func NewProcessor(cfg *config.Config, images repository.ImageRepository) *Processor {
+	p := &Processor{
+		operations: make(map[models.ProcessingType]Operation),
+		limits:     validation.NewLimits(cfg),
+	}
+	watermarker := &watermarker{dir: cfg.Processing.WatermarkDir, images: images}
+	p.Register(models.ProcessingTypeResize, resize)
+	p.Register(models.ProcessingTypeCrop, crop)
+	p.Register(models.ProcessingTypeRotate, rotate)
+	p.Register(models.ProcessingTypeFilter, filter)
+	p.Register(models.ProcessingTypeWatermark, watermarker.apply)
+	p.Register(models.ProcessingTypeCompress, compress)
+	p.Register(models.ProcessingTypeFormat, convert)
+	p.Register(models.ProcessingTypePipeline, p.pipeline)
+	return p
+}
+
+// Register adds or replaces the operation used for a processing type
+func (p *Processor) Register(processingType models.ProcessingType, op Operation) {
+	p.operations[processingType] = op
+}
+
+// Process loads the source image, applies the requested operation and
+// writes the output into the destination directory. Errors another attempt
+// cannot fix, like invalid parameters or an undecodable image, are marked
+// with rabbitmq.Permanent.
+func (p *Processor) Process(ctx context.Context, message *entity.ProcessingMessage) (*Result, error) {
+	op, ok := p.operations[message.ProcessingType]
+	if !ok {
+		return nil, rabbitmq.Permanent(fmt.Errorf("unsupported processing type: %s", message.ProcessingType))
+	}
+
+	file, err := os.Open(message.SourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source image: %w", err)
+	}
+	src, err := imaging.Decode(file, imaging.AutoOrientation(true))
+	file.Close()
+	if err != nil {
+		return nil, rabbitmq.Permanent(fmt.Errorf("failed to decode source image: %w", err))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Checked again against the decoded image, whose size may differ from the
+	// one stored with it, e.g. for images uploaded before orientation was applied
+	bounds := src.Bounds()
+	if err := validation.ValidateParameters(message.ProcessingType, message.Parameters, bounds.Dx(), bounds.Dy(), p.limits); err != nil {
+		return nil, rabbitmq.Permanent(err)
+	}
+
+	dst, encoding, err := op(ctx, src, message.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return p.save(ctx, dst, encoding, message)
+}
+
+func (p *Processor) save(ctx context.Context, img image.Image, encoding Encoding, message *entity.ProcessingMessage) (*Result, error) {
+	if err := os.MkdirAll(message.DestinationDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	format := encoding.Format
+	if format == "" {
+		format = filepath.Ext(message.SourcePath)
+	}
+	encoder, err := LookupEncoder(format)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(message.DestinationDir, fmt.Sprintf("job_%d%s", message.JobId, encoder.Extension))
+	if err := writeFile(ctx, path, img, encoder, encoding); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to save processed image: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	return &Result{
+		Path:     path,
+		FileSize: info.Size(),
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		MimeType: encoder.MimeType,
+	}, nil
+}
+
+func writeFile(ctx context.Context, path string, img image.Image, encoder Encoder, encoding Encoding) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encoder.Encode(contextWriter{ctx: ctx, w: file}, img, encoding); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// contextWriter makes an encoder stop as soon as the job is cancelled
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/validation"
+	"github.com/disintegration/imaging"
+)
+
+func resize(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.ResizeParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	encoding, err := validateEncoding(p.Format, p.Quality)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if p.Width < 0 || p.Height < 0 {
+		return nil, Encoding{}, fmt.Errorf("width and height must not be negative")
+	}
+	if p.Width == 0 && p.Height == 0 {
+		return nil, Encoding{}, fmt.Errorf("width or height is required")
+	}
+
+	// A zero dimension is derived from the other one, which always keeps the ratio
+	if p.MaintainRatio && p.Width > 0 && p.Height > 0 {
+		return imaging.Fit(img, p.Width, p.Height, imaging.Lanczos), encoding, nil
+	}
+	return imaging.Resize(img, p.Width, p.Height, imaging.Lanczos), encoding, nil
+}
+
+func crop(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.CropParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	encoding, err := validateEncoding(p.Format, 0)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	if p.Width <= 0 || p.Height <= 0 {
+		return nil, Encoding{}, fmt.Errorf("crop width and height must be positive")
+	}
+
+	bounds := img.Bounds()
+	if p.X < 0 || p.Y < 0 || p.Width > bounds.Dx()-p.X || p.Height > bounds.Dy()-p.Y {
+		return nil, Encoding{}, fmt.Errorf("crop rectangle %dx%d+%d+%d exceeds image bounds %dx%d",
+			p.Width, p.Height, p.X, p.Y, bounds.Dx(), bounds.Dy())
+	}
+	rect := image.Rect(p.X, p.Y, p.X+p.Width, p.Y+p.Height).Add(bounds.Min)
+	return imaging.Crop(img, rect), encoding, nil
+}
+
+func rotate(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.RotateParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	encoding, err := validateEncoding(p.Format, 0)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	background, err := validation.ParseColor(p.Background)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	return imaging.Rotate(img, p.Angle, background), encoding, nil
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         Operation
+		params     map[string]interface{}
+		wantWidth  int
+		wantHeight int
+		wantErr    bool
+	}{
+		{name: "resize", op: resize, params: map[string]interface{}{"width": 20, "height": 10}, wantWidth: 20, wantHeight: 10},
+		{name: "resize by width keeps the ratio", op: resize, params: map[string]interface{}{"width": 20}, wantWidth: 20, wantHeight: 10},
+		{name: "resize into a box keeps the ratio", op: resize, params: map[string]interface{}{"width": 20, "height": 20, "maintain_ratio": true}, wantWidth: 20, wantHeight: 10},
+		{name: "resize without a size", op: resize, params: map[string]interface{}{}, wantErr: true},
+		{name: "resize to a negative size", op: resize, params: map[string]interface{}{"width": -1, "height": 10}, wantErr: true},
+		{name: "resize quality out of range", op: resize, params: map[string]interface{}{"width": 10, "quality": 101}, wantErr: true},
+		{name: "resize to an unknown format", op: resize, params: map[string]interface{}{"width": 10, "format": "psd"}, wantErr: true},
+		{name: "crop", op: crop, params: map[string]interface{}{"x": 10, "y": 5, "width": 30, "height": 15}, wantWidth: 30, wantHeight: 15},
+		{name: "crop to the edge", op: crop, params: map[string]interface{}{"x": 20, "y": 10, "width": 20, "height": 10}, wantWidth: 20, wantHeight: 10},
+		{name: "crop beyond the edge", op: crop, params: map[string]interface{}{"x": 21, "y": 10, "width": 20, "height": 10}, wantErr: true},
+		{name: "crop overflowing the offset", op: crop, params: map[string]interface{}{"x": 10, "y": 5, "width": math.MaxInt, "height": 15}, wantErr: true},
+		{name: "crop from a negative offset", op: crop, params: map[string]interface{}{"x": -1, "width": 10, "height": 10}, wantErr: true},
+		{name: "crop without a size", op: crop, params: map[string]interface{}{"x": 1}, wantErr: true},
+		{name: "rotate a quarter", op: rotate, params: map[string]interface{}{"angle": 90}, wantWidth: 20, wantHeight: 40},
+		{name: "rotate a half", op: rotate, params: map[string]interface{}{"angle": 180, "background": "#fff"}, wantWidth: 40, wantHeight: 20},
+		{name: "rotate with an invalid background", op: rotate, params: map[string]interface{}{"angle": 45, "background": "white"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+			got, _, err := tt.op(context.Background(), img, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Bounds().Dx() != tt.wantWidth || got.Bounds().Dy() != tt.wantHeight {
+				t.Errorf("size %dx%d, want %dx%d", got.Bounds().Dx(), got.Bounds().Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	defaultWatermarkScale = 0.2
+	// defaultWatermarkMargin is relative to the shorter side of the base image
+	defaultWatermarkMargin = 0.02
+)
+
+type watermarker struct {
+	dir    string
+	images repository.ImageRepository
+}
+
+func (w *watermarker) apply(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	p, err := decodeParameters[entity.WatermarkParameters](params)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	encoding, err := validateEncoding(p.Format, 0)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+
+	bounds := img.Bounds()
+	if _, ok := params["opacity"]; !ok {
+		p.Opacity = 1
+	}
+	if _, ok := params["scale"]; !ok {
+		p.Scale = defaultWatermarkScale
+	}
+	if _, ok := params["margin"]; !ok {
+		p.Margin = int(math.Round(float64(min(bounds.Dx(), bounds.Dy())) * defaultWatermarkMargin))
+	}
+	if p.Position == "" {
+		p.Position = entity.PositionBottomRight
+	}
+	if p.Opacity < 0 || p.Opacity > 1 {
+		return nil, Encoding{}, fmt.Errorf("opacity must be between 0.0 and 1.0, got %v", p.Opacity)
+	}
+	if p.Scale <= 0 || p.Scale > 1 {
+		return nil, Encoding{}, fmt.Errorf("scale must be greater than 0.0 and at most 1.0, got %v", p.Scale)
+	}
+	if p.Margin < 0 {
+		return nil, Encoding{}, fmt.Errorf("margin must not be negative")
+	}
+
+	path, err := w.resolvePath(ctx, p.WatermarkPath)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	mark, err := imaging.Open(path)
+	if err != nil {
+		return nil, Encoding{}, fmt.Errorf("failed to open watermark: %w", err)
+	}
+
+	// Scale the watermark by width and make sure it still fits vertically
+	mark = imaging.Resize(mark, max(1, int(float64(bounds.Dx())*p.Scale)), 0, imaging.Lanczos)
+	if mark.Bounds().Dy() > bounds.Dy() {
+		mark = imaging.Resize(mark, 0, bounds.Dy(), imaging.Lanczos)
+	}
+
+	pos, err := watermarkPosition(p.Position, bounds, mark.Bounds(), p.Margin)
+	if err != nil {
+		return nil, Encoding{}, err
+	}
+	return imaging.Overlay(img, mark, pos, p.Opacity), encoding, nil
+}
+
+// resolvePath only allows files inside the watermark directory or images uploaded by the job owner
+func (w *watermarker) resolvePath(ctx context.Context, path string) (string, error) {
+	notAllowed := fmt.Errorf("watermark %s is not in the watermark directory or owned by the user", path)
+	if path == "" {
+		return "", fmt.Errorf("watermark_path is required")
+	}
+
+	resolved, err := resolveFile(path)
+	if err != nil {
+		return "", notAllowed
+	}
+
+	if w.dir != "" {
+		if dir, err := resolveFile(w.dir); err == nil && isWithin(dir, resolved) {
+			return resolved, nil
+		}
+	}
+
+	userId, ok := ctx.Value(constants.UserIdKey).(float64)
+	if !ok || w.images == nil {
+		return "", notAllowed
+	}
+	owned, err := w.images.GetImageByFileName(ctx, filepath.Base(resolved))
+	if err != nil || owned.UserId != int(userId) {
+		return "", notAllowed
+	}
+	ownedPath, err := resolveFile(filepath.Join(owned.FilePath, owned.FileName))
+	if err != nil || ownedPath != resolved {
+		return "", notAllowed
+	}
+	return resolved, nil
+}
+
+func watermarkPosition(position string, base, mark image.Rectangle, margin int) (image.Point, error) {
+	left := base.Min.X + margin
+	top := base.Min.Y + margin
+	right := base.Max.X - mark.Dx() - margin
+	bottom := base.Max.Y - mark.Dy() - margin
+
+	switch position {
+	case entity.PositionTopLeft:
+		return image.Pt(left, top), nil
+	case entity.PositionTopRight:
+		return image.Pt(right, top), nil
+	case entity.PositionBottomLeft:
+		return image.Pt(left, bottom), nil
+	case entity.PositionBottomRight:
+		return image.Pt(right, bottom), nil
+	case entity.PositionCenter:
+		return image.Pt(base.Min.X+(base.Dx()-mark.Dx())/2, base.Min.Y+(base.Dy()-mark.Dy())/2), nil
+	}
+	return image.Point{}, fmt.Errorf("unknown watermark position: %s", position)
+}
+
+// resolveFile returns the absolute path with every symlink evaluated
+func resolveFile(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/disintegration/imaging"
+	"gorm.io/gorm"
+)
+
+// memoryImageRepository finds the uploads of a test by file name
+type memoryImageRepository struct {
+	repository.ImageRepository
+	images []models.Image
+}
+
+func (r *memoryImageRepository) GetImageByFileName(ctx context.Context, fileName string) (models.Image, error) {
+	for _, image := range r.images {
+		if image.FileName == fileName {
+			return image, nil
+		}
+	}
+	return models.Image{}, gorm.ErrRecordNotFound
+}
+
+func TestWatermarkResolvePath(t *testing.T) {
+	watermarks := t.TempDir()
+	uploads := t.TempDir()
+	mark := filepath.Join(watermarks, "logo.png")
+	own := filepath.Join(uploads, "own.png")
+	foreign := filepath.Join(uploads, "foreign.png")
+	for _, path := range []string{mark, own, foreign} {
+		if err := imaging.Save(imaging.New(2, 2, color.NRGBA{A: 255}), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	escape := filepath.Join(watermarks, "escape.png")
+	if err := os.Symlink(foreign, escape); err != nil {
+		t.Fatal(err)
+	}
+	images := &memoryImageRepository{images: []models.Image{
+		{UserId: 1, FilePath: uploads, FileName: "own.png"},
+		{UserId: 2, FilePath: uploads, FileName: "foreign.png"},
+	}}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "watermark directory", path: mark},
+		{name: "own upload", path: own},
+		{name: "upload of another user", path: foreign, wantErr: true},
+		{name: "symlink out of the watermark directory", path: escape, wantErr: true},
+		{name: "traversal out of the watermark directory", path: filepath.Join(watermarks, "..", filepath.Base(uploads), "foreign.png"), wantErr: true},
+		{name: "missing file", path: filepath.Join(watermarks, "missing.png"), wantErr: true},
+		{name: "empty", path: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &watermarker{dir: watermarks, images: images}
+			ctx := context.WithValue(context.Background(), constants.UserIdKey, float64(1))
+			_, err := w.resolvePath(ctx, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolvePath(%s) = %v, want error %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatermarkPosition(t *testing.T) {
+	base := image.Rect(0, 0, 100, 50)
+	mark := image.Rect(0, 0, 20, 10)
+	tests := []struct {
+		position string
+		want     image.Point
+		wantErr  bool
+	}{
+		{position: entity.PositionTopLeft, want: image.Pt(5, 5)},
+		{position: entity.PositionTopRight, want: image.Pt(75, 5)},
+		{position: entity.PositionBottomLeft, want: image.Pt(5, 35)},
+		{position: entity.PositionBottomRight, want: image.Pt(75, 35)},
+		{position: entity.PositionCenter, want: image.Pt(40, 20)},
+		{position: "middle", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			got, err := watermarkPosition(tt.position, base, mark, 5)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("position %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatermarkApply(t *testing.T) {
+	dir := t.TempDir()
+	mark := filepath.Join(dir, "logo.png")
+	if err := imaging.Save(imaging.New(10, 10, color.NRGBA{R: 255, A: 255}), mark); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		want    color.NRGBA // Of the bottom-right pixel
+		wantErr bool
+	}{
+		{name: "defaults", params: map[string]interface{}{"watermark_path": mark, "margin": 0}, want: color.NRGBA{R: 255, A: 255}},
+		{name: "transparent", params: map[string]interface{}{"watermark_path": mark, "margin": 0, "opacity": 0}, want: color.NRGBA{A: 255}},
+		{name: "opacity out of range", params: map[string]interface{}{"watermark_path": mark, "opacity": 1.5}, wantErr: true},
+		{name: "scale out of range", params: map[string]interface{}{"watermark_path": mark, "scale": 0}, wantErr: true},
+		{name: "negative margin", params: map[string]interface{}{"watermark_path": mark, "margin": -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &watermarker{dir: dir}
+			got, _, err := w.apply(context.Background(), imaging.New(100, 100, color.NRGBA{A: 255}), tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if pixel := imaging.Clone(got).NRGBAAt(99, 99); pixel != tt.want {
+				t.Errorf("pixel %v, want %v", pixel, tt.want)
+			}
+		})
+	}
+}
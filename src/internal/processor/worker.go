@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/common"
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/messaging"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+	"gorm.io/gorm"
+)
+
+const defaultCancelPollInterval = 2 * time.Second
+
+type Worker struct {
+	cfg       *config.Config
+	processor *Processor
+	jobs      repository.ProcessingRepository
+	messaging *messaging.MessageSender
+}
+
+func NewWorker(cfg *config.Config, processor *Processor, jobs repository.ProcessingRepository, messaging *messaging.MessageSender) *Worker {
+	return &Worker{
+		cfg:       cfg,
+		processor: processor,
+		jobs:      jobs,
+		messaging: messaging,
+	}
+}
+
+// HandleMessage consumes a single processing message and publishes every
+// state transition of the job as a processing result. A failed attempt is
+// returned to the broker to be retried, and the job is only marked failed
+// once its last attempt fails or the error is permanent.
+func (w *Worker) HandleMessage(ctx context.Context, msg *rabbitmq.Message) error {
+	var message entity.ProcessingMessage
+	if err := json.Unmarshal(msg.Body, &message); err != nil {
+		// A malformed message can never succeed, so it is dead-lettered right away
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Processor, constants.Consume, err.Error())
+		return rabbitmq.Permanent(err)
+	}
+	// The broker tracks the attempts in the headers, the body keeps the original values
+	message.RetryCount = msg.RetryCount
+	message.MaxRetries = msg.MaxRetries
+
+	// Operations that look up user owned data read the user id from the context
+	ctx = context.WithValue(ctx, constants.UserIdKey, float64(message.UserId))
+
+	job, err := w.jobs.GetProcessingJobByID(ctx, message.JobId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Caller:%s Level:%s Msg:job %d no longer exists, skipped", constants.Processor, constants.Consume, message.JobId)
+			return nil
+		}
+		return err
+	}
+	// Cancelled jobs, and jobs a previous delivery already finished, are skipped
+	if job.Status.IsFinal() {
+		log.Printf("Caller:%s Level:%s Msg:job %d is %s, skipped", constants.Processor, constants.Consume, message.JobId, job.Status)
+		return nil
+	}
+
+	startedAt := time.Now().UTC()
+	err = w.messaging.SendResult(ctx, &entity.ProcessingResult{
+		JobId:       message.JobId,
+		ImageId:     message.ImageId,
+		UserId:      message.UserId,
+		Status:      models.ImageStatusProcessing,
+		RetryCount:  message.RetryCount,
+		ProcessedAt: startedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The job context ends when the job times out or is cancelled
+	timeout := w.cfg.Processing.JobTimeout(string(message.ProcessingType))
+	jobCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	go w.watchCancellation(jobCtx, cancel, message.JobId)
+
+	output, err := w.processor.Process(WithProgress(jobCtx, func(percent int) {
+		err := w.messaging.SendResult(ctx, &entity.ProcessingResult{
+			JobId:       message.JobId,
+			ImageId:     message.ImageId,
+			UserId:      message.UserId,
+			Status:      models.ImageStatusProcessing,
+			RetryCount:  message.RetryCount,
+			Progress:    percent,
+			ProcessedAt: time.Now().UTC(),
+		})
+		// Progress is informational, so a lost update does not fail the job
+		if err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Processor, constants.Publish, err.Error())
+		}
+	}), &message)
+	completedAt := time.Now().UTC()
+	result := &entity.ProcessingResult{
+		JobId:       message.JobId,
+		ImageId:     message.ImageId,
+		UserId:      message.UserId,
+		Duration:    completedAt.Sub(startedAt).Milliseconds(),
+		RetryCount:  message.RetryCount,
+		ProcessedAt: completedAt,
+	}
+	// Interrupted by shutdown, the broker requeues the message for another worker
+	if ctx.Err() != nil {
+		if output != nil {
+			os.Remove(output.Path)
+		}
+		log.Printf("Caller:%s Level:%s Msg:job %d interrupted by shutdown, requeued", constants.Processor, constants.Process, message.JobId)
+		return ctx.Err()
+	}
+	if err != nil && errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("job did not finish within %s", timeout)
+	}
+	// Only the watcher cancels the job context while the worker itself keeps
+	// running. The API recorded the cancellation already, so there is nothing
+	// to report.
+	if errors.Is(jobCtx.Err(), context.Canceled) {
+		if output != nil {
+			os.Remove(output.Path)
+		}
+		log.Printf("Caller:%s Level:%s Msg:job %d cancelled", constants.Processor, constants.Process, message.JobId)
+		return nil
+	}
+	if err != nil {
+		if message.RetryCount < message.MaxRetries && !rabbitmq.IsPermanent(err) {
+			log.Printf("Caller:%s Level:%s Msg:job %d attempt %d failed, retrying: %s",
+				constants.Processor, constants.Process, message.JobId, message.RetryCount+1, err.Error())
+			// The job waits for the retry, so the reaper does not take it over as well
+			result.Status = models.ImageStatusPending
+			result.ErrorMessage = err.Error()
+			if sendErr := w.messaging.SendResult(ctx, result); sendErr != nil {
+				return sendErr
+			}
+			return err
+		}
+		log.Printf("Caller:%s Level:%s Msg:job %d failed: %s", constants.Processor, constants.Process, message.JobId, err.Error())
+		result.Status = models.ImageStatusFailed
+		result.ErrorMessage = err.Error()
+		if sendErr := w.messaging.SendResult(ctx, result); sendErr != nil {
+			return sendErr
+		}
+		// Returned so the broker moves the message to the dead-letter queue
+		return err
+	}
+
+	log.Printf("Caller:%s Level:%s Msg:job %d completed", constants.Processor, constants.Process, message.JobId)
+	result.Status = models.ImageStatusCompleted
+	result.ResultPath = output.Path
+	result.Metadata, _ = common.TypeConverter[map[string]interface{}](entity.ResultMetadata{
+		FileSize: output.FileSize,
+		Width:    output.Width,
+		Height:   output.Height,
+		MimeType: output.MimeType,
+	})
+
+	return w.messaging.SendResult(ctx, result)
+}
+
+// watchCancellation polls the job while it runs and cancels its context once
+// the job has been cancelled or deleted
+func (w *Worker) watchCancellation(ctx context.Context, cancel context.CancelFunc, jobId int) {
+	interval := w.cfg.Processing.CancelPollInterval
+	if interval <= 0 {
+		interval = defaultCancelPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job, err := w.jobs.GetProcessingJobByID(ctx, jobId)
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && job.Status == models.ImageStatusCancelled) {
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/internal/image/domain/repository"
+	"github.com/alielmi98/image-processing-service/internal/image/entity"
+	"github.com/alielmi98/image-processing-service/internal/image/infra/messaging"
+	"github.com/alielmi98/image-processing-service/pkg/config"
+	"github.com/alielmi98/image-processing-service/pkg/rabbitmq"
+	"github.com/disintegration/imaging"
+)
+
+// memoryProcessingRepository holds the job the worker looks up
+type memoryProcessingRepository struct {
+	repository.ProcessingRepository
+	mu  sync.Mutex
+	job models.ProcessingJob
+}
+
+func (r *memoryProcessingRepository) GetProcessingJobByID(ctx context.Context, id int) (models.ProcessingJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.job, nil
+}
+
+func (r *memoryProcessingRepository) setStatus(status models.ImageStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Status = status
+}
+
+// writeImage saves a blank image of the given size and returns its path
+func writeImage(t *testing.T, width, height int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "source.png")
+	if err := imaging.Save(image.NewNRGBA(image.Rect(0, 0, width, height)), path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func failing(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+	return nil, Encoding{}, errors.New("broken")
+}
+
+// newTestWorker returns a worker publishing its results on a memory broker
+// and a channel receiving those results
+func newTestWorker(t *testing.T, jobs *memoryProcessingRepository, op Operation) (*Worker, <-chan *entity.ProcessingResult) {
+	t.Helper()
+	cfg := &config.Config{Processing: config.ProcessingConfig{CancelPollInterval: 5 * time.Millisecond}}
+	broker := rabbitmq.NewMemoryBroker(&rabbitmq.Config{})
+	sender, err := messaging.NewMessageSender(cfg, broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan *entity.ProcessingResult, 10)
+	broker.Subscribe(messaging.ResultTopic, messaging.NewResultHandler(func(ctx context.Context, result *entity.ProcessingResult) error {
+		results <- result
+		return nil
+	}))
+	if err := broker.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	processor := NewProcessor(cfg, nil)
+	if op != nil {
+		processor.Register(models.ProcessingTypeResize, op)
+	}
+	return NewWorker(cfg, processor, jobs, sender), results
+}
+
+// receiveResults waits for the results of one message, which ends with a
+// final status
+func receiveResults(t *testing.T, results <-chan *entity.ProcessingResult, last models.ImageStatus) []models.ImageStatus {
+	t.Helper()
+	var statuses []models.ImageStatus
+	for {
+		select {
+		case result := <-results:
+			statuses = append(statuses, result.Status)
+			if result.Status == last {
+				return statuses
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after results %v", statuses)
+		}
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	source := writeImage(t, 40, 20)
+	corrupt := filepath.Join(t.TempDir(), "corrupt.png")
+	if err := os.WriteFile(corrupt, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		op            Operation
+		source        string
+		params        map[string]interface{}
+		retryCount    int
+		maxRetries    int
+		wantErr       bool
+		wantPermanent bool
+		wantStatuses  []models.ImageStatus
+	}{
+		{
+			name:         "completed",
+			wantStatuses: []models.ImageStatus{models.ImageStatusProcessing, models.ImageStatusCompleted},
+		},
+		{
+			name:         "failed with retries left",
+			op:           failing,
+			maxRetries:   2,
+			wantErr:      true,
+			wantStatuses: []models.ImageStatus{models.ImageStatusProcessing, models.ImageStatusPending},
+		},
+		{
+			name:         "failed on the last attempt",
+			op:           failing,
+			retryCount:   2,
+			maxRetries:   2,
+			wantErr:      true,
+			wantStatuses: []models.ImageStatus{models.ImageStatusProcessing, models.ImageStatusFailed},
+		},
+		{
+			name:          "invalid parameters fail at once",
+			params:        map[string]interface{}{"width": -1},
+			maxRetries:    2,
+			wantErr:       true,
+			wantPermanent: true,
+			wantStatuses:  []models.ImageStatus{models.ImageStatusProcessing, models.ImageStatusFailed},
+		},
+		{
+			name:          "undecodable image fails at once",
+			source:        corrupt,
+			maxRetries:    2,
+			wantErr:       true,
+			wantPermanent: true,
+			wantStatuses:  []models.ImageStatus{models.ImageStatusProcessing, models.ImageStatusFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := models.ProcessingJob{Id: 1, Status: models.ImageStatusPending}
+			worker, results := newTestWorker(t, &memoryProcessingRepository{job: job}, tt.op)
+			message := entity.ProcessingMessage{
+				JobId:          job.Id,
+				ProcessingType: models.ProcessingTypeResize,
+				Parameters:     map[string]interface{}{"width": 10},
+				SourcePath:     source,
+				DestinationDir: t.TempDir(),
+			}
+			if tt.params != nil {
+				message.Parameters = tt.params
+			}
+			if tt.source != "" {
+				message.SourcePath = tt.source
+			}
+			body, _ := json.Marshal(message)
+
+			err := worker.HandleMessage(context.Background(), &rabbitmq.Message{Body: body, RetryCount: tt.retryCount, MaxRetries: tt.maxRetries})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleMessage = %v, want error %v", err, tt.wantErr)
+			}
+			if rabbitmq.IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("HandleMessage = %v, want permanent %v", err, tt.wantPermanent)
+			}
+			got := receiveResults(t, results, tt.wantStatuses[len(tt.wantStatuses)-1])
+			if len(got) != len(tt.wantStatuses) {
+				t.Fatalf("results %v, want %v", got, tt.wantStatuses)
+			}
+			for i := range got {
+				if got[i] != tt.wantStatuses[i] {
+					t.Errorf("results %v, want %v", got, tt.wantStatuses)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleMessageSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  models.ImageStatus
+		body    []byte
+		wantErr bool
+	}{
+		{name: "cancelled job", status: models.ImageStatusCancelled, body: []byte(`{"job_id":1}`)},
+		{name: "finished job", status: models.ImageStatusCompleted, body: []byte(`{"job_id":1}`)},
+		{name: "malformed message", status: models.ImageStatusPending, body: []byte("{"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker, results := newTestWorker(t, &memoryProcessingRepository{job: models.ProcessingJob{Id: 1, Status: tt.status}}, nil)
+			err := worker.HandleMessage(context.Background(), &rabbitmq.Message{Body: tt.body})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleMessage = %v, want error %v", err, tt.wantErr)
+			}
+			select {
+			case result := <-results:
+				t.Errorf("published result %+v", result)
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestHandleMessageCancelled(t *testing.T) {
+	jobs := &memoryProcessingRepository{job: models.ProcessingJob{Id: 1, Status: models.ImageStatusPending}}
+	worker, results := newTestWorker(t, jobs, func(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, Encoding, error) {
+		jobs.setStatus(models.ImageStatusCancelled)
+		<-ctx.Done()
+		return nil, Encoding{}, ctx.Err()
+	})
+	body, _ := json.Marshal(entity.ProcessingMessage{
+		JobId:          1,
+		ProcessingType: models.ProcessingTypeResize,
+		Parameters:     map[string]interface{}{"width": 10},
+		SourcePath:     writeImage(t, 40, 20),
+		DestinationDir: t.TempDir(),
+	})
+
+	if err := worker.HandleMessage(context.Background(), &rabbitmq.Message{Body: body, MaxRetries: 2}); err != nil {
+		t.Fatalf("HandleMessage = %v, want the cancelled job acknowledged", err)
+	}
+	receiveResults(t, results, models.ImageStatusProcessing)
+	// The API recorded the cancellation, the worker only stops
+	select {
+	case result := <-results:
+		t.Errorf("published result %+v after the cancellation", result)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
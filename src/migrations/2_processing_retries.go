@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+	"gorm.io/gorm"
+)
+
+func Up2() {
+	database := db.GetDb()
+
+	// Tables created by Up1 before the column existed
+	addColumnIfNotExists(database, &imageModels.ProcessingJob{}, "RetryCount")
+}
+
+func addColumnIfNotExists(database *gorm.DB, model interface{}, field string) {
+	if database.Migrator().HasColumn(model, field) {
+		return
+	}
+	err := database.Migrator().AddColumn(model, field)
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+		return
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, fmt.Sprintf("column %s added", field))
+}
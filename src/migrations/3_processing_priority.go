@@ -0,0 +1,12 @@
+package migrations
+
+import (
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func Up3() {
+	database := db.GetDb()
+
+	addColumnIfNotExists(database, &imageModels.ProcessingJob{}, "Priority")
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func Up4() {
+	database := db.GetDb()
+
+	addColumnIfNotExists(database, &imageModels.ProcessingJob{}, "CallbackUrl")
+
+	tables := []interface{}{}
+	tables = addNewTable(database, imageModels.WebhookSetting{}, tables)
+	tables = addNewTable(database, imageModels.WebhookDelivery{}, tables)
+	tables = addNewTable(database, imageModels.WebhookDeliveryAttempt{}, tables)
+	if len(tables) == 0 {
+		return
+	}
+	if err := database.Migrator().CreateTable(tables...); err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+		return
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, "webhook tables created")
+}
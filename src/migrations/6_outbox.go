@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func Up6() {
+	database := db.GetDb()
+
+	tables := addNewTable(database, imageModels.OutboxMessage{}, []interface{}{})
+	if len(tables) == 0 {
+		return
+	}
+	if err := database.Migrator().CreateTable(tables...); err != nil {
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+		return
+	}
+	log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, "outbox table created")
+}
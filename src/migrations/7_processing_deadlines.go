@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func Up7() {
+	database := db.GetDb()
+
+	addColumnIfNotExists(database, &imageModels.ProcessingJob{}, "DeadlineAt")
+	if !database.Migrator().HasIndex(&imageModels.ProcessingJob{}, "DeadlineAt") {
+		if err := database.Migrator().CreateIndex(&imageModels.ProcessingJob{}, "DeadlineAt"); err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+		}
+	}
+	// Requeued jobs keep counting their attempts through the outbox
+	addColumnIfNotExists(database, &imageModels.OutboxMessage{}, "RetryCount")
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func Up8() {
+	database := db.GetDb()
+
+	addColumnIfNotExists(database, &imageModels.ProcessingJob{}, "RunAt")
+	if !database.Migrator().HasIndex(&imageModels.ProcessingJob{}, "RunAt") {
+		if err := database.Migrator().CreateIndex(&imageModels.ProcessingJob{}, "RunAt"); err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+		}
+	}
+}
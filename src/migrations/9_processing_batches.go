@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	imageModels "github.com/alielmi98/image-processing-service/internal/image/domain/models"
+	"github.com/alielmi98/image-processing-service/pkg/db"
+)
+
+func Up9() {
+	database := db.GetDb()
+
+	tables := addNewTable(database, imageModels.ProcessingBatch{}, []interface{}{})
+	if len(tables) > 0 {
+		if err := database.Migrator().CreateTable(tables...); err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+			return
+		}
+		log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, "processing batches table created")
+	}
+
+	addColumnIfNotExists(database, &imageModels.ProcessingJob{}, "BatchId")
+	if !database.Migrator().HasIndex(&imageModels.ProcessingJob{}, "BatchId") {
+		if err := database.Migrator().CreateIndex(&imageModels.ProcessingJob{}, "BatchId"); err != nil {
+			log.Printf("Caller:%s Level:%s Msg:%s", constants.Postgres, constants.Migration, err.Error())
+		}
+	}
+}
@@ -10,19 +10,24 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Postgres PostgresConfig
-	Password PasswordConfig
-	Cors     CorsConfig
-	JWT      JWTConfig
-	RabbitMQ RabbitMQConfig
+	Server      ServerConfig
+	Postgres    PostgresConfig
+	Password    PasswordConfig
+	Cors        CorsConfig
+	JWT         JWTConfig
+	RabbitMQ    RabbitMQConfig
+	Processing  ProcessingConfig
+	Webhook     WebhookConfig
+	Idempotency IdempotencyConfig
+	Outbox      OutboxConfig
 }
 
 type ServerConfig struct {
-	InternalPort string
-	ExternalPort string
-	RunMode      string
-	Domain       string
+	InternalPort    string
+	ExternalPort    string
+	RunMode         string
+	Domain          string
+	ShutdownTimeout time.Duration // How long requests and message handlers may take to finish on shutdown
 }
 
 type PostgresConfig struct {
@@ -58,6 +63,7 @@ type JWTConfig struct {
 }
 
 type RabbitMQConfig struct {
+	Driver               string // rabbitmq, or memory to run the worker inside the API without a broker
 	Host                 string
 	Port                 string
 	User                 string
@@ -72,6 +78,77 @@ type RabbitMQConfig struct {
 	PrefetchCount        int
 	ReconnectDelay       time.Duration
 	MaxReconnectAttempts int
+	MaxRetries           int
+	RetryDelay           time.Duration
+	MaxRetryDelay        time.Duration
+	PublishTimeout       time.Duration // Wait for the broker to confirm a publish
+	PublisherChannels    int           // Channels publishes are spread over
+	ProcessingWorkers    int           // Processing jobs a worker process runs in parallel, at most PrefetchCount
+	ResultWorkers        int           // Job results the API handles in parallel, at most PrefetchCount
+}
+
+type WebhookConfig struct {
+	Timeout       time.Duration // Timeout of a single delivery request
+	MaxAttempts   int           // Attempts before a delivery is given up
+	RetryDelay    time.Duration // Delay before the second attempt, doubled for every further one
+	MaxRetryDelay time.Duration
+	PollInterval  time.Duration // How often due deliveries are picked up
+	BatchSize     int           // Deliveries picked up at once
+	// Allows callback URLs in private networks, e.g. receivers on localhost
+	// during development. Otherwise they are refused to prevent SSRF.
+	AllowPrivateNetworks bool
+}
+
+type OutboxConfig struct {
+	PollInterval  time.Duration // How often pending messages are published
+	BatchSize     int           // Messages published per poll
+	RetryDelay    time.Duration // Delay after a failed publish, doubled for every further one
+	MaxRetryDelay time.Duration
+	Retention     time.Duration // How long sent messages are kept
+	PurgeInterval time.Duration // How often sent messages past Retention are deleted
+}
+
+type IdempotencyConfig struct {
+	Window        time.Duration // How long the response to an Idempotency-Key is kept
+	PurgeInterval time.Duration // How often expired keys are deleted
+	LeaseTimeout  time.Duration // How long a key stays reserved by a request that has not answered yet
+	MaxBodySize   int64         // Largest request body read to identify a request, in bytes
+}
+
+type ProcessingConfig struct {
+	WatermarkDir    string
+	DefaultPriority int // Used when a request sets no priority
+	MaxUserPriority int // Highest priority users without the admin role may request
+
+	CancelPollInterval time.Duration // How often workers check whether their running job was cancelled
+
+	Timeout         time.Duration            // How long a job may run before the worker aborts it
+	Timeouts        map[string]time.Duration // Per processing type, takes precedence over Timeout
+	ReapInterval    time.Duration            // How often jobs stuck in processing are looked for
+	ReapGracePeriod time.Duration            // How long past its timeout a job may go unreported before it is reaped
+	ReapBatchSize   int                      // Stuck jobs handled at once
+
+	MaxScheduleAhead  time.Duration // How far in the future jobs may be scheduled
+	ScheduleInterval  time.Duration // How often due scheduled jobs are looked for
+	ScheduleBatchSize int           // Scheduled jobs queued at once
+
+	MaxBatchSize int // Most images a batch request may process
+
+	MaxDimension int // Largest width or height an operation may produce
+	MaxPixels    int // Largest number of pixels an operation may produce
+}
+
+const defaultJobTimeout = 5 * time.Minute
+
+// JobTimeout returns how long a job of the given processing type may run
+func (c *ProcessingConfig) JobTimeout(processingType string) time.Duration {
+	if timeout := c.Timeouts[processingType]; timeout > 0 {
+		return timeout
+	}
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultJobTimeout
 }
 
 func GetConfig() *Config {
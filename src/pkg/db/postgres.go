@@ -15,11 +15,7 @@ var dbClient *gorm.DB
 
 func InitDb(cfg *config.Config) error {
 	var err error
-	cnn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=Asia/Tehran",
-		cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.User, cfg.Postgres.Password,
-		cfg.Postgres.DbName, cfg.Postgres.SSLMode)
-
-	dbClient, err = gorm.Open(postgres.Open(cnn), &gorm.Config{})
+	dbClient, err = gorm.Open(postgres.Open(ConnectionString(cfg)), &gorm.Config{})
 	if err != nil {
 		return err
 	}
@@ -38,6 +34,13 @@ func InitDb(cfg *config.Config) error {
 	return nil
 }
 
+// ConnectionString returns the DSN of the database
+func ConnectionString(cfg *config.Config) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=Asia/Tehran",
+		cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.User, cfg.Postgres.Password,
+		cfg.Postgres.DbName, cfg.Postgres.SSLMode)
+}
+
 func GetDb() *gorm.DB {
 	return dbClient
 }
@@ -0,0 +1,95 @@
+package events
+
+import "sync"
+
+const subscriberBuffer = 16
+
+// Bus delivers the events published for a key to the subscribers of that key
+type Bus[T any] interface {
+	// Subscribe returns a channel receiving the events published for key and a
+	// function that ends the subscription and closes the channel
+	Subscribe(key int) (<-chan T, func())
+	Publish(key int, event T)
+}
+
+// Hub fans out events published for a key to every subscriber of that key
+// within the process
+type Hub[T any] struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan T]struct{}
+	closed      bool
+}
+
+func NewHub[T any]() *Hub[T] {
+	return &Hub[T]{
+		subscribers: make(map[int]map[chan T]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the events published for key and a
+// function that ends the subscription and closes the channel
+func (h *Hub[T]) Subscribe(key int) (<-chan T, func()) {
+	ch := make(chan T, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subscribers[key] == nil {
+		h.subscribers[key] = make(map[chan T]struct{})
+	}
+	h.subscribers[key][ch] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// Already gone when unsubscribed before or closed by Close
+		if _, ok := h.subscribers[key][ch]; !ok {
+			return
+		}
+		delete(h.subscribers[key], ch)
+		if len(h.subscribers[key]) == 0 {
+			delete(h.subscribers, key)
+		}
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// Close ends every subscription by closing its channel, later subscriptions
+// are closed right away. Streams reading the channels end with them.
+func (h *Hub[T]) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for key, subscribers := range h.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(h.subscribers, key)
+	}
+}
+
+// Publish delivers event to the subscribers of key without blocking. A
+// subscriber that falls behind loses its oldest event, so the latest state
+// always gets through.
+func (h *Hub[T]) Publish(key int, event T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[key] {
+		select {
+		case ch <- event:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- event
+		}
+	}
+}
+
+var _ Bus[int] = (*Hub[int])(nil)
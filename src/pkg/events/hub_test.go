@@ -0,0 +1,62 @@
+package events
+
+import "testing"
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub[int]()
+	events, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+	other, unsubscribeOther := hub.Subscribe(2)
+	defer unsubscribeOther()
+
+	// A subscriber that falls behind keeps the latest events
+	for i := 0; i < subscriberBuffer+3; i++ {
+		hub.Publish(1, i)
+	}
+	if event := <-events; event != 3 {
+		t.Errorf("oldest kept event %d, want 3", event)
+	}
+	select {
+	case event := <-other:
+		t.Errorf("subscriber of another key got %d", event)
+	default:
+	}
+}
+
+func TestHubUnsubscribe(t *testing.T) {
+	hub := NewHub[int]()
+	events, unsubscribe := hub.Subscribe(1)
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Fatal("subscription still open after unsubscribing")
+	}
+	// Must neither close the channel twice nor publish to it
+	unsubscribe()
+	hub.Publish(1, 42)
+	if len(hub.subscribers) != 0 {
+		t.Errorf("%d keys left after the last subscriber left", len(hub.subscribers))
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub[int]()
+	events, unsubscribe := hub.Subscribe(1)
+	hub.Publish(1, 42)
+
+	hub.Close()
+	if event, ok := <-events; !ok || event != 42 {
+		t.Fatalf("got %d, %v, want the event published before closing", event, ok)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("subscription still open after Close")
+	}
+	// Must not close the channel a second time
+	unsubscribe()
+
+	late, unsubscribeLate := hub.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Fatal("subscription after Close is open")
+	}
+	unsubscribeLate()
+	hub.Publish(1, 43)
+}
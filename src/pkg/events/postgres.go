@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alielmi98/image-processing-service/constants"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+const listenRetryDelay = 5 * time.Second
+
+// PostgresBus delivers events to the subscribers of every process sharing the
+// database, e.g. every replica of the API. Events are sent with NOTIFY on
+// channel and each process listens on a connection of its own, publishing
+// what it receives to its local hub.
+type PostgresBus[T any] struct {
+	hub     *Hub[T]
+	db      *gorm.DB
+	dsn     string
+	channel string
+}
+
+type notification[T any] struct {
+	Key   int `json:"key"`
+	Event T   `json:"event"`
+}
+
+func NewPostgresBus[T any](db *gorm.DB, dsn, channel string) *PostgresBus[T] {
+	return &PostgresBus[T]{
+		hub:     NewHub[T](),
+		db:      db,
+		dsn:     dsn,
+		channel: channel,
+	}
+}
+
+// Subscribe subscribes to the events of key published by any process
+func (b *PostgresBus[T]) Subscribe(key int) (<-chan T, func()) {
+	return b.hub.Subscribe(key)
+}
+
+// Close ends the subscriptions of this process, see Hub.Close
+func (b *PostgresBus[T]) Close() {
+	b.hub.Close()
+}
+
+// Publish notifies every listening process of the event. When the
+// notification cannot be sent, e.g. because its payload exceeds the 8000 bytes
+// Postgres allows, only the subscribers of this process get the event.
+func (b *PostgresBus[T]) Publish(key int, event T) {
+	payload, err := json.Marshal(notification[T]{Key: key, Event: event})
+	if err == nil {
+		err = b.db.Exec("SELECT pg_notify(?, ?)", b.channel, string(payload)).Error
+	}
+	if err != nil {
+		log.Printf("Caller:%s Level:%s Msg:failed to notify event of %d: %s", constants.Postgres, constants.Notify, key, err.Error())
+		b.hub.Publish(key, event)
+	}
+}
+
+// Listen publishes the events notified by every process to the local
+// subscribers until ctx is done. A lost connection is reopened after a delay,
+// events notified in the meantime are missed.
+func (b *PostgresBus[T]) Listen(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Caller:%s Level:%s Msg:listening for events stopped, retrying in %s: %s", constants.Postgres, constants.Notify, listenRetryDelay, err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (b *PostgresBus[T]) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", b.channel, err)
+	}
+
+	for {
+		received, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var n notification[T]
+		if err := json.Unmarshal([]byte(received.Payload), &n); err != nil {
+			log.Printf("Caller:%s Level:%s Msg:invalid event on %s: %s", constants.Postgres, constants.Notify, b.channel, err.Error())
+			continue
+		}
+		b.hub.Publish(n.Key, n.Event)
+	}
+}
+
+var _ Bus[int] = (*PostgresBus[int])(nil)
@@ -8,6 +8,7 @@ const (
 	AuthError         ResultCode = 40101
 	ForbiddenError    ResultCode = 40301
 	NotFoundError     ResultCode = 40401
+	ConflictError     ResultCode = 40901
 	LimiterError      ResultCode = 42901
 	OtpLimiterError   ResultCode = 42902
 	CustomRecovery    ResultCode = 50001
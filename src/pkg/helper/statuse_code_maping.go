@@ -15,6 +15,17 @@ var StatusCodeMapping = map[string]int{
 	service_errors.UsernameOrPasswordInvalid: 401,
 	// Token
 	service_errors.InvalidRefreshToken: 401,
+	// Processing
+	service_errors.ResultNotReady:       409,
+	service_errors.PriorityNotAllowed:   403,
+	service_errors.JobAlreadyFinished:   409,
+	service_errors.ScheduleTooFar:       400,
+	service_errors.BatchTooLarge:        400,
+	service_errors.BatchAlreadyFinished: 409,
+	service_errors.PresetExists:         409,
+	// Idempotency
+	service_errors.IdempotencyKeyReused:     409,
+	service_errors.IdempotencyKeyInProgress: 409,
 }
 
 func TranslateErrorToStatusCode(err error) int {
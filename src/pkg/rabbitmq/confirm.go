@@ -0,0 +1,249 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultPublishTimeout    = 10 * time.Second
+	defaultPublisherChannels = 4
+	confirmBufferSize        = 256
+)
+
+// Reasons a publish fails after the message was handed to the broker
+var (
+	// ErrNacked means the broker could not take responsibility for the message
+	ErrNacked = errors.New("message was nacked by the broker")
+	// ErrUnroutable means no queue is bound to receive the message
+	ErrUnroutable = errors.New("message is unroutable")
+	// ErrChannelClosed means the channel closed before the message was confirmed,
+	// the message may or may not have reached the broker
+	ErrChannelClosed = errors.New("channel closed before the message was confirmed")
+)
+
+// PublishError reports a message the broker did not confirm. Err is one of
+// ErrNacked, ErrUnroutable or ErrChannelClosed, the context error when the
+// caller stopped waiting for the confirm, or the error of the publish itself.
+type PublishError struct {
+	MessageID string
+	Topic     string
+	Index     int // Position of the message in the messages of PublishBatch
+	Err       error
+	ReplyCode uint16 // Set when the message was returned
+	ReplyText string
+}
+
+func (e *PublishError) Error() string {
+	if e.ReplyText != "" {
+		return fmt.Sprintf("failed to publish message %s to %s: %v (%d %s)", e.MessageID, e.Topic, e.Err, e.ReplyCode, e.ReplyText)
+	}
+	return fmt.Sprintf("failed to publish message %s to %s: %v", e.MessageID, e.Topic, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// confirmPublisher publishes mandatory messages on a channel in confirm mode
+// and matches the acks and returns of the broker to the pending publishes
+type confirmPublisher struct {
+	channel *amqp.Channel
+	publish sync.Mutex // Delivery tags follow the order of the publishes
+	mu      sync.Mutex
+	nextTag uint64
+	pending map[uint64]*pendingPublish
+	closed  bool
+}
+
+type pendingPublish struct {
+	messageID string
+	topic     string
+	returned  *amqp.Return
+	done      chan error
+}
+
+// newConfirmPublisher opens a channel on conn and puts it in confirm mode
+func newConfirmPublisher(conn *amqp.Connection) (*confirmPublisher, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open publishing channel: %w", err)
+	}
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	p := &confirmPublisher{
+		channel: channel,
+		nextTag: 1,
+		pending: make(map[uint64]*pendingPublish),
+	}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, confirmBufferSize))
+	returns := channel.NotifyReturn(make(chan amqp.Return, confirmBufferSize))
+	go p.dispatch(confirms, returns)
+	return p, nil
+}
+
+// send publishes a message and returns the channel its outcome is delivered
+// on once the broker confirms it
+func (p *confirmPublisher) send(exchange, key string, msg amqp.Publishing) (<-chan error, error) {
+	p.publish.Lock()
+	defer p.publish.Unlock()
+
+	pending := &pendingPublish{messageID: msg.MessageId, topic: exchange, done: make(chan error, 1)}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrChannelClosed
+	}
+	tag := p.nextTag
+	p.pending[tag] = pending
+	p.mu.Unlock()
+
+	if err := p.channel.Publish(exchange, key, true, false, msg); err != nil {
+		// The publish never reached the broker, so it did not take up a delivery tag
+		p.mu.Lock()
+		delete(p.pending, tag)
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.nextTag++
+	p.mu.Unlock()
+	return pending.done, nil
+}
+
+// declareExchange declares the exchange of topic. Replies to declarations carry
+// no correlation id, so they take turns with the publishes of other callers.
+func (p *confirmPublisher) declareExchange(topic string) error {
+	p.publish.Lock()
+	defer p.publish.Unlock()
+	return declareExchange(p.channel, topic)
+}
+
+// declareQueue declares a durable queue, taking turns with the publishes of
+// other callers like declareExchange
+func (p *confirmPublisher) declareQueue(name string, args amqp.Table) error {
+	p.publish.Lock()
+	defer p.publish.Unlock()
+	_, err := p.channel.QueueDeclare(name, true, false, false, false, args)
+	return err
+}
+
+// dispatch resolves the pending publishes until the channel closes. The broker
+// sends the return of an unroutable message before its ack, so returns are
+// drained before every confirm is resolved.
+func (p *confirmPublisher) dispatch(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			p.handleReturn(ret)
+		case confirm, ok := <-confirms:
+			if !ok {
+				p.fail()
+				return
+			}
+			p.drainReturns(returns)
+			p.handleConfirm(confirm)
+		}
+	}
+}
+
+func (p *confirmPublisher) drainReturns(returns <-chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			p.handleReturn(ret)
+		default:
+			return
+		}
+	}
+}
+
+// handleReturn marks the oldest pending publish of the returned message.
+// Returns carry no delivery tag, but arrive in publishing order.
+func (p *confirmPublisher) handleReturn(ret amqp.Return) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var match uint64
+	for tag, pending := range p.pending {
+		if pending.messageID == ret.MessageId && pending.returned == nil && (match == 0 || tag < match) {
+			match = tag
+		}
+	}
+	if match != 0 {
+		p.pending[match].returned = &ret
+	}
+}
+
+func (p *confirmPublisher) handleConfirm(confirm amqp.Confirmation) {
+	p.mu.Lock()
+	pending, ok := p.pending[confirm.DeliveryTag]
+	delete(p.pending, confirm.DeliveryTag)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	switch {
+	case !confirm.Ack:
+		pending.done <- &PublishError{MessageID: pending.messageID, Topic: pending.topic, Err: ErrNacked}
+	case pending.returned != nil:
+		pending.done <- &PublishError{
+			MessageID: pending.messageID,
+			Topic:     pending.topic,
+			Err:       ErrUnroutable,
+			ReplyCode: pending.returned.ReplyCode,
+			ReplyText: pending.returned.ReplyText,
+		}
+	default:
+		pending.done <- nil
+	}
+}
+
+// fail resolves every pending publish once the channel is closed
+func (p *confirmPublisher) fail() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for tag, pending := range p.pending {
+		pending.done <- &PublishError{MessageID: pending.messageID, Topic: pending.topic, Err: ErrChannelClosed}
+		delete(p.pending, tag)
+	}
+}
+
+func (p *confirmPublisher) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *confirmPublisher) close() error {
+	return p.channel.Close()
+}
+
+// waitConfirm waits for the outcome of a publish until ctx is done
+func waitConfirm(ctx context.Context, message *Message, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return &PublishError{MessageID: message.ID, Topic: message.Topic, Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,109 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// newTestConfirmPublisher returns a publisher without a channel whose
+// publishes with the given message ids are pending under tags 1, 2, ...
+func newTestConfirmPublisher(messageIDs ...string) (*confirmPublisher, []chan error) {
+	p := &confirmPublisher{pending: make(map[uint64]*pendingPublish)}
+	done := make([]chan error, len(messageIDs))
+	for i, id := range messageIDs {
+		done[i] = make(chan error, 1)
+		p.pending[uint64(i+1)] = &pendingPublish{messageID: id, topic: "test", done: done[i]}
+	}
+	p.nextTag = uint64(len(messageIDs) + 1)
+	return p, done
+}
+
+func TestConfirmPublisherDispatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		messageIDs []string
+		returns    []amqp.Return
+		confirms   []amqp.Confirmation
+		want       []error
+	}{
+		{
+			name:       "acked",
+			messageIDs: []string{"a"},
+			confirms:   []amqp.Confirmation{{DeliveryTag: 1, Ack: true}},
+			want:       []error{nil},
+		},
+		{
+			name:       "nacked",
+			messageIDs: []string{"a"},
+			confirms:   []amqp.Confirmation{{DeliveryTag: 1, Ack: false}},
+			want:       []error{ErrNacked},
+		},
+		{
+			name:       "returned before its ack",
+			messageIDs: []string{"a", "b"},
+			returns:    []amqp.Return{{MessageId: "b", ReplyCode: 312, ReplyText: "NO_ROUTE"}},
+			confirms:   []amqp.Confirmation{{DeliveryTag: 1, Ack: true}, {DeliveryTag: 2, Ack: true}},
+			want:       []error{nil, ErrUnroutable},
+		},
+		{
+			name:       "return matched to the oldest publish of a message id",
+			messageIDs: []string{"a", "a"},
+			returns:    []amqp.Return{{MessageId: "a", ReplyCode: 312}},
+			confirms:   []amqp.Confirmation{{DeliveryTag: 1, Ack: true}, {DeliveryTag: 2, Ack: true}},
+			want:       []error{ErrUnroutable, nil},
+		},
+		{
+			name:       "channel closed before the confirms",
+			messageIDs: []string{"a", "b"},
+			confirms:   []amqp.Confirmation{{DeliveryTag: 1, Ack: true}},
+			want:       []error{nil, ErrChannelClosed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, done := newTestConfirmPublisher(tt.messageIDs...)
+			confirms := make(chan amqp.Confirmation, len(tt.confirms))
+			returns := make(chan amqp.Return, len(tt.returns))
+			// Returns are sent first, like the broker does for unroutable messages
+			for _, ret := range tt.returns {
+				returns <- ret
+			}
+			for _, confirm := range tt.confirms {
+				confirms <- confirm
+			}
+			close(returns)
+			close(confirms)
+			p.dispatch(confirms, returns)
+
+			for i, want := range tt.want {
+				err := <-done[i]
+				if !errors.Is(err, want) {
+					t.Errorf("publish %d: %v, want %v", i+1, err, want)
+				}
+				var publishErr *PublishError
+				if errors.As(err, &publishErr) && publishErr.MessageID != tt.messageIDs[i] {
+					t.Errorf("publish %d reported for message %s", i+1, publishErr.MessageID)
+				}
+			}
+			if !p.isClosed() {
+				t.Error("publisher still open after its channel closed")
+			}
+			if _, err := p.send("test", "", amqp.Publishing{}); !errors.Is(err, ErrChannelClosed) {
+				t.Errorf("send on a closed publisher returned %v", err)
+			}
+		})
+	}
+}
+
+func TestWaitConfirmTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := waitConfirm(ctx, &Message{ID: "a", Topic: "test"}, make(chan error))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waitConfirm = %v, want a deadline error", err)
+	}
+}
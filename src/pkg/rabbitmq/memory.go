@@ -0,0 +1,557 @@
+package rabbitmq
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process broker for development and tests. It mirrors
+// the topology RabbitMQBroker sets up: every topic routes all of its messages
+// to one priority queue, failed messages are retried with exponential backoff
+// and dead-lettered once their retries are exhausted. Messages live only as
+// long as the process. Parts of a process that would each open their own
+// RabbitMQ connection share a broker through sessions.
+type MemoryBroker struct {
+	config      *Config
+	queues      map[string]*memoryQueue
+	handlers    map[string]MessageHandler
+	consumers   map[string]*memoryConsumer
+	retries     map[*Message]*time.Timer // Failed messages waiting for their next attempt
+	deadLetters map[string][]*Message
+	mu          sync.Mutex
+	connected   bool
+	sessions    int // Open sessions, the broker disconnects when the last one closes
+	sequence    uint64
+}
+
+// memoryConsumer runs the workers of one topic
+type memoryConsumer struct {
+	stop   context.CancelFunc // Stops taking deliveries
+	cancel context.CancelFunc // Cancels the handlers in flight
+	wg     sync.WaitGroup
+}
+
+// NewMemoryBroker creates a new in-memory broker instance
+func NewMemoryBroker(config *Config) *MemoryBroker {
+	return &MemoryBroker{
+		config:      config,
+		queues:      make(map[string]*memoryQueue),
+		handlers:    make(map[string]MessageHandler),
+		consumers:   make(map[string]*memoryConsumer),
+		retries:     make(map[*Message]*time.Timer),
+		deadLetters: make(map[string][]*Message),
+	}
+}
+
+// Connect marks the broker usable, there is nothing to dial
+func (m *MemoryBroker) Connect() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = true
+	return nil
+}
+
+// Open connects, which cannot fail
+func (m *MemoryBroker) Open() {
+	m.Connect()
+}
+
+// IsConnected returns the connection status
+func (m *MemoryBroker) IsConnected() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connected
+}
+
+// Health checks the broker health
+func (m *MemoryBroker) Health() error {
+	if !m.IsConnected() {
+		return fmt.Errorf("memory broker is stopped")
+	}
+	return nil
+}
+
+// DeclareTopic creates the queue of a topic
+func (m *MemoryBroker) DeclareTopic(topic string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue(topic)
+	return nil
+}
+
+// Publish queues a copy of the message on the queue of its topic
+func (m *MemoryBroker) Publish(ctx context.Context, message *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.connected {
+		return fmt.Errorf("memory broker is not connected")
+	}
+
+	msg := copyMessage(message)
+	// Like RabbitMQ, priorities are capped by the queue and ignored without one
+	msg.Priority = min(msg.Priority, m.config.MaxPriority)
+	m.push(msg)
+	return nil
+}
+
+// PublishBatch publishes multiple messages
+func (m *MemoryBroker) PublishBatch(ctx context.Context, messages []*Message) error {
+	for _, msg := range messages {
+		if err := m.Publish(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe registers the handler of a topic
+func (m *MemoryBroker) Subscribe(topic string, handler MessageHandler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[topic] = handler
+	m.queue(topic)
+	return nil
+}
+
+// Unsubscribe removes a subscription and stops its consumer
+func (m *MemoryBroker) Unsubscribe(topic string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.handlers, topic)
+	if consumer, ok := m.consumers[topic]; ok {
+		consumer.stop()
+		delete(m.consumers, topic)
+	}
+	return nil
+}
+
+// Start starts consuming the subscribed topics that are not consumed yet
+func (m *MemoryBroker) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topics := make([]string, 0, len(m.handlers))
+	for topic := range m.handlers {
+		topics = append(topics, topic)
+	}
+	return m.start(ctx, topics)
+}
+
+// start starts consuming the given subscribed topics that are not consumed
+// yet, the caller must hold mu
+func (m *MemoryBroker) start(ctx context.Context, topics []string) error {
+	if !m.connected {
+		return fmt.Errorf("memory broker is not connected")
+	}
+
+	for _, topic := range topics {
+		handler, ok := m.handlers[topic]
+		if _, consumed := m.consumers[topic]; !ok || consumed {
+			continue
+		}
+		consumer := &memoryConsumer{}
+		consumerCtx, stop := context.WithCancel(ctx)
+		// Handlers outlive ctx, so a message being handled when consuming stops is finished
+		handlerCtx, cancel := context.WithCancel(context.Background())
+		consumer.stop, consumer.cancel = stop, cancel
+		m.consumers[topic] = consumer
+		for i := 0; i < m.config.workers(topic); i++ {
+			consumer.wg.Add(1)
+			go m.consume(consumerCtx, handlerCtx, consumer, topic, m.queue(topic), handler)
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the consumers and waits for the messages they are handling.
+// Handlers still running once ctx is done are cancelled and their messages
+// requeued.
+func (m *MemoryBroker) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	stopped := m.stopConsumers(nil)
+	m.mu.Unlock()
+
+	return errors.Join(drain(ctx, stopped), m.Stop())
+}
+
+// stopConsumers stops consuming topics, or every topic when topics is nil,
+// and returns the consumers that were stopped. The caller must hold mu.
+func (m *MemoryBroker) stopConsumers(topics []string) []*memoryConsumer {
+	if topics == nil {
+		for topic := range m.consumers {
+			topics = append(topics, topic)
+		}
+	}
+	var stopped []*memoryConsumer
+	for _, topic := range topics {
+		if consumer, ok := m.consumers[topic]; ok {
+			consumer.stop()
+			delete(m.consumers, topic)
+			stopped = append(stopped, consumer)
+		}
+	}
+	return stopped
+}
+
+// drain waits for the messages the stopped consumers are handling,
+// cancelling the handlers once ctx is done
+func drain(ctx context.Context, stopped []*memoryConsumer) error {
+	drained := make(chan struct{})
+	go func() {
+		for _, consumer := range stopped {
+			consumer.wg.Wait()
+		}
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("handlers did not finish in time: %w", ctx.Err())
+		for _, consumer := range stopped {
+			consumer.cancel()
+		}
+		<-drained
+	}
+	for _, consumer := range stopped {
+		consumer.cancel()
+	}
+	return err
+}
+
+// Stop stops the consumers, cancels the messages they are handling and waits
+// for them. Messages waiting to be retried are queued right away, so they are
+// delivered once the broker is connected again.
+func (m *MemoryBroker) Stop() error {
+	m.mu.Lock()
+	m.connected = false
+	stopped := m.stopConsumers(nil)
+	m.mu.Unlock()
+	for _, consumer := range stopped {
+		consumer.cancel()
+	}
+	drain(context.Background(), stopped)
+
+	m.mu.Lock()
+	for msg, timer := range m.retries {
+		timer.Stop()
+		delete(m.retries, msg)
+		m.push(msg)
+	}
+	m.mu.Unlock()
+	log.Println("Memory broker stopped")
+	return nil
+}
+
+// Close closes the broker
+func (m *MemoryBroker) Close() error {
+	return m.Stop()
+}
+
+// Session returns a new session of the broker. A session behaves like a
+// broker of its own connection: it starts and shuts down only the topics
+// subscribed through it, and the broker is stopped once its last open
+// session is closed.
+func (m *MemoryBroker) Session() *MemorySession {
+	return &MemorySession{MemoryBroker: m, topics: make(map[string]bool)}
+}
+
+// MemorySession is a connection to a shared MemoryBroker
+type MemorySession struct {
+	*MemoryBroker
+	topics map[string]bool // Guarded by the mu of the broker
+	open   bool
+}
+
+// Connect opens the session
+func (s *MemorySession) Connect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.open {
+		s.open = true
+		s.sessions++
+	}
+	s.connected = true
+	return nil
+}
+
+// Open connects, which cannot fail
+func (s *MemorySession) Open() {
+	s.Connect()
+}
+
+// IsConnected returns whether the session is open
+func (s *MemorySession) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open && s.connected
+}
+
+// Health checks the session health
+func (s *MemorySession) Health() error {
+	if !s.IsConnected() {
+		return fmt.Errorf("memory broker session is closed")
+	}
+	return nil
+}
+
+// Publish queues a copy of the message on the queue of its topic
+func (s *MemorySession) Publish(ctx context.Context, message *Message) error {
+	if !s.IsConnected() {
+		return fmt.Errorf("memory broker session is closed")
+	}
+	return s.MemoryBroker.Publish(ctx, message)
+}
+
+// PublishBatch publishes multiple messages
+func (s *MemorySession) PublishBatch(ctx context.Context, messages []*Message) error {
+	for _, msg := range messages {
+		if err := s.Publish(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe registers the handler of a topic consumed by the session
+func (s *MemorySession) Subscribe(topic string, handler MessageHandler) error {
+	s.mu.Lock()
+	s.topics[topic] = true
+	s.mu.Unlock()
+	return s.MemoryBroker.Subscribe(topic, handler)
+}
+
+// Unsubscribe removes a subscription of the session and stops its consumer
+func (s *MemorySession) Unsubscribe(topic string) error {
+	s.mu.Lock()
+	delete(s.topics, topic)
+	s.mu.Unlock()
+	return s.MemoryBroker.Unsubscribe(topic)
+}
+
+// Start starts consuming the topics subscribed through the session
+func (s *MemorySession) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.open {
+		return fmt.Errorf("memory broker session is closed")
+	}
+	return s.start(ctx, s.subscriptions())
+}
+
+// Shutdown stops consuming the topics of the session and waits for the
+// messages being handled before closing the session. Handlers still running
+// once ctx is done are cancelled and their messages requeued.
+func (s *MemorySession) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	stopped := s.stopConsumers(s.subscriptions())
+	s.mu.Unlock()
+
+	return errors.Join(drain(ctx, stopped), s.Stop())
+}
+
+// Stop stops consuming the topics of the session, cancelling the messages
+// being handled, and closes the session
+func (s *MemorySession) Stop() error {
+	s.mu.Lock()
+	stopped := s.stopConsumers(s.subscriptions())
+	s.mu.Unlock()
+	for _, consumer := range stopped {
+		consumer.cancel()
+	}
+	drain(context.Background(), stopped)
+
+	s.mu.Lock()
+	last := s.open && s.sessions == 1
+	if s.open {
+		s.open = false
+		s.sessions--
+	}
+	s.mu.Unlock()
+	if last {
+		return s.MemoryBroker.Stop()
+	}
+	return nil
+}
+
+// Close closes the session
+func (s *MemorySession) Close() error {
+	return s.Stop()
+}
+
+// subscriptions returns the topics of the session, the caller must hold mu
+func (s *MemorySession) subscriptions() []string {
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// DeadLetters returns the messages of topic whose retries are exhausted
+func (m *MemoryBroker) DeadLetters(topic string) []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := make([]*Message, len(m.deadLetters[topic]))
+	copy(messages, m.deadLetters[topic])
+	return messages
+}
+
+// consume hands the messages of a queue to the handler one at a time, highest
+// priority first, until ctx is done. Every worker of a topic runs its own
+// consume loop. Handlers run on handlerCtx, so a message that is being handled
+// when consuming stops is still finished.
+func (m *MemoryBroker) consume(ctx, handlerCtx context.Context, consumer *memoryConsumer, topic string, queue *memoryQueue, handler MessageHandler) {
+	defer consumer.wg.Done()
+	for ctx.Err() == nil {
+		m.mu.Lock()
+		delivery, ok := queue.pop()
+		// Taken under the lock, so a push after the pop is not missed
+		ready := queue.ready
+		m.mu.Unlock()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
+			continue
+		}
+
+		msg := copyMessage(delivery.message)
+		if msg.MaxRetries == 0 {
+			msg.MaxRetries = m.config.MaxRetries
+		}
+		err := handler(handlerCtx, msg)
+		switch {
+		case err == nil:
+			// Acknowledged, the delivery is dropped
+		case handlerCtx.Err() != nil:
+			// Interrupted by shutdown, requeued in its original place like an unacknowledged delivery
+			m.mu.Lock()
+			queue.push(delivery)
+			m.mu.Unlock()
+			return
+		default:
+			log.Printf("Error handling message: %v", err)
+			m.handleFailure(topic, msg, err)
+		}
+	}
+}
+
+// handleFailure schedules a failed message for another attempt, or
+// dead-letters it once its retries are exhausted
+func (m *MemoryBroker) handleFailure(topic string, msg *Message, handlerErr error) {
+	if !shouldRetry(msg, handlerErr) {
+		msg.Headers[ErrorHeader] = handlerErr.Error()
+		m.mu.Lock()
+		m.deadLetters[topic] = append(m.deadLetters[topic], msg)
+		m.mu.Unlock()
+		log.Printf("Dead-lettered message %s after %d retries: %v", msg.ID, msg.RetryCount, handlerErr)
+		return
+	}
+
+	msg.RetryCount++
+	delay := retryDelay(m.config, msg.RetryCount)
+	log.Printf("Retrying message %s in %s (attempt %d of %d)", msg.ID, delay, msg.RetryCount, msg.MaxRetries)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.connected {
+		// Stopped while handling it, Stop no longer queues pending retries
+		m.push(msg)
+		return
+	}
+	m.retries[msg] = time.AfterFunc(delay, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// Stop queues it instead when it gets there first
+		if _, ok := m.retries[msg]; ok {
+			delete(m.retries, msg)
+			m.push(msg)
+		}
+	})
+}
+
+// push queues a message on its topic, the caller must hold mu
+func (m *MemoryBroker) push(msg *Message) {
+	m.sequence++
+	m.queue(msg.Topic).push(&memoryDelivery{message: msg, sequence: m.sequence})
+}
+
+// queue returns the queue of a topic, creating it if needed. The caller must hold mu.
+func (m *MemoryBroker) queue(topic string) *memoryQueue {
+	queue, ok := m.queues[topic]
+	if !ok {
+		queue = &memoryQueue{ready: make(chan struct{})}
+		m.queues[topic] = queue
+	}
+	return queue
+}
+
+func copyMessage(message *Message) *Message {
+	msg := *message
+	msg.Headers = make(map[string]interface{}, len(message.Headers)+1)
+	for k, v := range message.Headers {
+		msg.Headers[k] = v
+	}
+	return &msg
+}
+
+type memoryDelivery struct {
+	message  *Message
+	sequence uint64 // Keeps messages of the same priority in publishing order
+}
+
+// memoryQueue is a priority queue of deliveries. ready is closed and replaced
+// whenever a delivery is pushed, which wakes every idle consumer, so a burst
+// of messages is picked up by all workers rather than one.
+type memoryQueue struct {
+	deliveries memoryDeliveries
+	ready      chan struct{}
+}
+
+func (q *memoryQueue) push(delivery *memoryDelivery) {
+	heap.Push(&q.deliveries, delivery)
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+func (q *memoryQueue) pop() (*memoryDelivery, bool) {
+	if q.deliveries.Len() == 0 {
+		return nil, false
+	}
+	return heap.Pop(&q.deliveries).(*memoryDelivery), true
+}
+
+// memoryDeliveries implements heap.Interface
+type memoryDeliveries []*memoryDelivery
+
+func (d memoryDeliveries) Len() int { return len(d) }
+
+func (d memoryDeliveries) Less(i, j int) bool {
+	if d[i].message.Priority != d[j].message.Priority {
+		return d[i].message.Priority > d[j].message.Priority
+	}
+	return d[i].sequence < d[j].sequence
+}
+
+func (d memoryDeliveries) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+
+func (d *memoryDeliveries) Push(x any) { *d = append(*d, x.(*memoryDelivery)) }
+
+func (d *memoryDeliveries) Pop() any {
+	old := *d
+	delivery := old[len(old)-1]
+	old[len(old)-1] = nil
+	*d = old[:len(old)-1]
+	return delivery
+}
+
+var (
+	_ RabbitMQ = (*MemoryBroker)(nil)
+	_ RabbitMQ = (*MemorySession)(nil)
+)
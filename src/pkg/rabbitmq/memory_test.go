@@ -0,0 +1,373 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTopic = "test"
+
+func newTestMemoryBroker(t *testing.T, config *Config) *MemoryBroker {
+	t.Helper()
+	broker := NewMemoryBroker(config)
+	broker.Open()
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func waitFor(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestMemoryBrokerPriority(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxPriority uint8
+		priorities  []uint8
+		want        []string
+	}{
+		{
+			name:        "highest priority first",
+			maxPriority: 10,
+			priorities:  []uint8{1, 5, 3},
+			want:        []string{"1", "2", "0"},
+		},
+		{
+			name:        "publishing order within a priority",
+			maxPriority: 10,
+			priorities:  []uint8{2, 7, 2, 7},
+			want:        []string{"1", "3", "0", "2"},
+		},
+		{
+			name:        "priorities capped by the queue",
+			maxPriority: 3,
+			priorities:  []uint8{9, 3, 5},
+			want:        []string{"0", "1", "2"},
+		},
+		{
+			name:        "priorities ignored without a priority queue",
+			maxPriority: 0,
+			priorities:  []uint8{1, 9, 5},
+			want:        []string{"0", "1", "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newTestMemoryBroker(t, &Config{MaxPriority: tt.maxPriority})
+
+			// Published before consuming starts, so the order is decided by the queue alone
+			for i, priority := range tt.priorities {
+				msg := &Message{ID: string(rune('0' + i)), Topic: testTopic, Priority: priority}
+				if err := broker.Publish(context.Background(), msg); err != nil {
+					t.Fatalf("Publish: %v", err)
+				}
+			}
+
+			var mu sync.Mutex
+			var got []string
+			done := make(chan struct{})
+			broker.Subscribe(testTopic, func(ctx context.Context, msg *Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, msg.ID)
+				if len(got) == len(tt.want) {
+					close(done)
+				}
+				return nil
+			})
+			if err := broker.Start(context.Background()); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			waitFor(t, done, "the messages")
+
+			mu.Lock()
+			defer mu.Unlock()
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("handled %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerFailures(t *testing.T) {
+	failure := errors.New("failure")
+	tests := []struct {
+		name           string
+		maxRetries     int
+		messageRetries int
+		failures       int
+		err            error
+		wantAttempts   int
+		wantDeadLetter bool
+	}{
+		{
+			name:         "succeeds after retries",
+			maxRetries:   3,
+			failures:     2,
+			err:          failure,
+			wantAttempts: 3,
+		},
+		{
+			name:           "dead-lettered once retries are exhausted",
+			maxRetries:     2,
+			failures:       10,
+			err:            failure,
+			wantAttempts:   3,
+			wantDeadLetter: true,
+		},
+		{
+			name:           "retries of the message win over the config",
+			maxRetries:     5,
+			messageRetries: 1,
+			failures:       10,
+			err:            failure,
+			wantAttempts:   2,
+			wantDeadLetter: true,
+		},
+		{
+			name:           "permanent errors are not retried",
+			maxRetries:     3,
+			failures:       10,
+			err:            Permanent(failure),
+			wantAttempts:   1,
+			wantDeadLetter: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newTestMemoryBroker(t, &Config{
+				MaxRetries:    tt.maxRetries,
+				RetryDelay:    time.Millisecond,
+				MaxRetryDelay: 5 * time.Millisecond,
+			})
+
+			var mu sync.Mutex
+			attempts := 0
+			settled := make(chan struct{})
+			broker.Subscribe(testTopic, func(ctx context.Context, msg *Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts++
+				if msg.RetryCount != attempts-1 {
+					t.Errorf("attempt %d has retry count %d", attempts, msg.RetryCount)
+				}
+				if attempts > tt.failures {
+					close(settled)
+					return nil
+				}
+				if attempts == tt.wantAttempts && tt.wantDeadLetter {
+					defer close(settled)
+				}
+				return tt.err
+			})
+			if err := broker.Start(context.Background()); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			msg := &Message{ID: "1", Topic: testTopic, MaxRetries: tt.messageRetries}
+			if err := broker.Publish(context.Background(), msg); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+			waitFor(t, settled, "the message to settle")
+
+			var deadLetters []*Message
+			if tt.wantDeadLetter {
+				// Dead-lettered right after the handler returns
+				for deadline := time.Now().Add(5 * time.Second); len(deadLetters) == 0 && time.Now().Before(deadline); {
+					time.Sleep(time.Millisecond)
+					deadLetters = broker.DeadLetters(testTopic)
+				}
+			} else {
+				// Longer than any retry delay, so an extra attempt would show up
+				time.Sleep(20 * time.Millisecond)
+				deadLetters = broker.DeadLetters(testTopic)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if attempts != tt.wantAttempts {
+				t.Errorf("handled %d times, want %d", attempts, tt.wantAttempts)
+			}
+			if got := len(deadLetters) > 0; got != tt.wantDeadLetter {
+				t.Fatalf("dead-lettered %v, want %v", got, tt.wantDeadLetter)
+			}
+			if tt.wantDeadLetter && deadLetters[0].Headers[ErrorHeader] != failure.Error() {
+				t.Errorf("dead letter error header %v, want %q", deadLetters[0].Headers[ErrorHeader], failure.Error())
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerBurstWakesEveryWorker(t *testing.T) {
+	const workers = 4
+	broker := newTestMemoryBroker(t, &Config{Workers: map[string]int{testTopic: workers}})
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	release := make(chan struct{})
+	broker.Subscribe(testTopic, func(ctx context.Context, msg *Message) error {
+		wg.Done()
+		// Held until every message is being handled, which takes all the workers
+		<-release
+		return nil
+	})
+	if err := broker.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// Lets the workers go idle before the burst
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < workers; i++ {
+		if err := broker.Publish(context.Background(), &Message{Topic: testTopic}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	handling := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(handling)
+	}()
+	waitFor(t, handling, "every worker to pick up a message")
+	close(release)
+}
+
+func TestMemoryBrokerShutdownRequeuesInterruptedMessages(t *testing.T) {
+	broker := newTestMemoryBroker(t, &Config{})
+
+	started := make(chan struct{})
+	broker.Subscribe(testTopic, func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := broker.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := broker.Publish(context.Background(), &Message{ID: "1", Topic: testTopic}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitFor(t, started, "the handler")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := broker.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown returned %v, want a deadline error", err)
+	}
+	if got := len(broker.DeadLetters(testTopic)); got != 0 {
+		t.Errorf("%d dead letters, want none", got)
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if got := broker.queues[testTopic].deliveries.Len(); got != 1 {
+		t.Errorf("%d queued deliveries, want the interrupted one", got)
+	}
+}
+
+func TestMemoryBrokerStopQueuesPendingRetries(t *testing.T) {
+	broker := NewMemoryBroker(&Config{MaxRetries: 3, RetryDelay: time.Hour, MaxRetryDelay: time.Hour})
+	broker.Open()
+
+	handled := make(chan struct{}, 1)
+	broker.Subscribe(testTopic, func(ctx context.Context, msg *Message) error {
+		handled <- struct{}{}
+		return errors.New("failure")
+	})
+	if err := broker.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := broker.Publish(context.Background(), &Message{ID: "1", Topic: testTopic}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitFor(t, handled, "the handler")
+	// The retry is scheduled right after the handler returns
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		broker.mu.Lock()
+		pending := len(broker.retries)
+		broker.mu.Unlock()
+		if pending == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the retry to be scheduled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	broker.Stop()
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if got := len(broker.retries); got != 0 {
+		t.Errorf("%d retries still pending", got)
+	}
+	delivery, ok := broker.queues[testTopic].pop()
+	if !ok {
+		t.Fatal("the pending retry was dropped")
+	}
+	if delivery.message.RetryCount != 1 {
+		t.Errorf("queued retry has retry count %d, want 1", delivery.message.RetryCount)
+	}
+}
+
+func TestMemorySessionShutdown(t *testing.T) {
+	const otherTopic = "other"
+	broker := NewMemoryBroker(&Config{})
+	sender := broker.Session()
+	sender.Open()
+	results := broker.Session()
+	results.Open()
+	jobs := broker.Session()
+	jobs.Open()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	published := make(chan error, 1)
+	jobs.Subscribe(testTopic, func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-release
+		published <- sender.Publish(ctx, &Message{ID: "result", Topic: otherTopic})
+		return ctx.Err()
+	})
+	results.Subscribe(otherTopic, func(ctx context.Context, msg *Message) error { return nil })
+	for _, session := range []*MemorySession{results, jobs} {
+		if err := session.Start(context.Background()); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	}
+	if err := sender.Publish(context.Background(), &Message{ID: "job", Topic: testTopic}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitFor(t, started, "the handler")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := results.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown of the idle session: %v", err)
+	}
+	if results.IsConnected() || !jobs.IsConnected() {
+		t.Errorf("after shutting down one session connected %v and %v, want only the other", results.IsConnected(), jobs.IsConnected())
+	}
+
+	close(release)
+	if err := jobs.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown of the busy session: %v", err)
+	}
+	if err := <-published; err != nil {
+		t.Errorf("handler of the draining session could not publish: %v", err)
+	}
+	if !broker.IsConnected() {
+		t.Error("broker disconnected while the sender session is open")
+	}
+	sender.Close()
+	if broker.IsConnected() {
+		t.Error("broker still connected after its last session closed")
+	}
+}
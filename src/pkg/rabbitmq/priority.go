@@ -0,0 +1,99 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"log"
+)
+
+// queueName returns the queue the messages of topic are consumed from. The
+// arguments of a durable queue cannot change once it exists, so a priority
+// queue gets a name of its own for every maximum priority.
+func (c *Config) queueName(topic string) string {
+	if c.MaxPriority > 0 {
+		return fmt.Sprintf("%s_priority_%d_queue", topic, c.MaxPriority)
+	}
+	return legacyQueue(topic)
+}
+
+// legacyQueue returns the queue of topic used without priorities
+func legacyQueue(topic string) string {
+	return fmt.Sprintf("%s_queue", topic)
+}
+
+// retireLegacyQueue retires the queue topic used without priorities once per
+// process. Redeclaring the topic after a reconnect leaves it alone, unless
+// retiring it failed before.
+func (r *RabbitMQBroker) retireLegacyQueue(topic string) {
+	r.mu.Lock()
+	if r.retired[topic] {
+		r.mu.Unlock()
+		return
+	}
+	r.retired[topic] = true
+	r.mu.Unlock()
+
+	if err := r.retireQueue(topic, legacyQueue(topic)); err != nil {
+		log.Printf("Failed to retire queue %s: %v", legacyQueue(topic), err)
+		r.mu.Lock()
+		delete(r.retired, topic)
+		r.mu.Unlock()
+	}
+}
+
+// retireQueue moves the messages left in a queue of topic that is no longer
+// consumed over to the current one. The queue is unbound first, so it gets no
+// new messages, and deleted once it is empty and consumed by no one, e.g. once
+// every replica runs with the same priorities.
+func (r *RabbitMQBroker) retireQueue(topic, name string) error {
+	r.mu.RLock()
+	conn := r.conn
+	r.mu.RUnlock()
+	if conn == nil {
+		return fmt.Errorf("connection is not available")
+	}
+
+	// A missing queue fails the declaration and closes the channel
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer channel.Close()
+	if _, err := channel.QueueDeclarePassive(name, true, false, false, false, nil); err != nil {
+		return nil
+	}
+	if err := channel.QueueUnbind(name, "#", topic, nil); err != nil {
+		return fmt.Errorf("failed to unbind queue %s: %w", name, err)
+	}
+
+	publisher, err := r.getPublisher()
+	if err != nil {
+		return err
+	}
+	moved := 0
+	for {
+		delivery, ok, err := channel.Get(name, false)
+		if err != nil {
+			return fmt.Errorf("failed to get message from queue %s: %w", name, err)
+		}
+		if !ok {
+			break
+		}
+		message := &Message{ID: delivery.MessageId, Topic: topic}
+		if err := r.sendConfirmed(publisher, message, topic, delivery.RoutingKey, republish(delivery)); err != nil {
+			delivery.Nack(false, true)
+			return fmt.Errorf("failed to move message from queue %s: %w", name, err)
+		}
+		delivery.Ack(false)
+		moved++
+	}
+
+	queue, err := channel.QueueDeclarePassive(name, true, false, false, false, nil)
+	if err == nil && queue.Messages == 0 && queue.Consumers == 0 {
+		_, err = channel.QueueDelete(name, false, true, false)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete queue %s: %w", name, err)
+	}
+	log.Printf("Retired queue %s of topic %s, moved %d messages", name, topic, moved)
+	return nil
+}
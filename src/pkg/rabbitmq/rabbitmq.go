@@ -2,45 +2,94 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
-	"time"
 
 	"github.com/streadway/amqp"
 )
 
 type RabbitMQBroker struct {
-	config    *Config
-	conn      *amqp.Connection
-	channel   *amqp.Channel
-	handlers  map[string]MessageHandler
-	mu        sync.RWMutex
-	connected bool
-	ctx       context.Context
-	cancel    context.CancelFunc
+	config        *Config
+	conn          *amqp.Connection
+	channel       *amqp.Channel       // Declares the topology
+	publishers    []*confirmPublisher // Pool of publishing channels, used in turn
+	nextPublisher int
+	handlers      map[string]MessageHandler
+	topics        map[string]bool             // Declared topics, redeclared after reconnecting
+	retired       map[string]bool             // Topics whose legacy queue was retired
+	consumers     map[string]*amqp.Connection // Connection each topic is consumed on, with a channel of its own
+	consumeCtx    context.Context             // Context of Start, consumers are restarted with it after reconnecting
+	stopConsuming context.CancelFunc
+	wg            sync.WaitGroup // Running consumers
+	mu            sync.RWMutex
+	state         ConnectionState
+	attempt       int   // Current reconnection attempt
+	lastErr       error // Why the connection was lost or the last attempt failed
+	reconnecting  bool
+	ctx           context.Context
+	cancel        context.CancelFunc
 }
 
 // NewRabbitMQBroker creates a new RabbitMQ broker instance
 func NewRabbitMQBroker(config *Config) *RabbitMQBroker {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &RabbitMQBroker{
-		config:   config,
-		handlers: make(map[string]MessageHandler),
-		ctx:      ctx,
-		cancel:   cancel,
+		config:    config,
+		handlers:  make(map[string]MessageHandler),
+		topics:    make(map[string]bool),
+		retired:   make(map[string]bool),
+		consumers: make(map[string]*amqp.Connection),
+		ctx:       ctx,
+		cancel:    cancel,
 	}
 }
 
-// Connect establishes connection to RabbitMQ
+// Connect establishes connection to RabbitMQ. Once connected, a lost
+// connection is restored in the background.
 func (r *RabbitMQBroker) Connect() error {
+	if r.State() == StateConnected {
+		return nil
+	}
+	// Dialing may take until the network gives up, so it happens without
+	// holding mu and Health or IsConnected keep answering meanwhile
+	conn, channel, publishers, err := r.dial()
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
-
-	if r.connected {
+	if r.ctx.Err() != nil {
+		conn.Close()
+		return fmt.Errorf("broker stopped while connecting")
+	}
+	// Another caller connected in the meantime
+	if r.state == StateConnected {
+		conn.Close()
 		return nil
 	}
+	r.conn = conn
+	r.channel = channel
+	r.publishers = publishers
+	r.state = StateConnected
+	r.attempt = 0
+	r.lastErr = nil
+	if !r.reconnecting {
+		// Otherwise consumers are restarted once the topology is restored
+		r.startConsumers()
+	}
 
+	// Reconnect as soon as the connection or the topology channel fails
+	go r.watch(conn, conn.NotifyClose(make(chan *amqp.Error, 1)), channel.NotifyClose(make(chan *amqp.Error, 1)))
+
+	log.Println("Successfully connected to RabbitMQ")
+	return nil
+}
+
+// dial opens a connection along with its topology channel and publishers
+func (r *RabbitMQBroker) dial() (*amqp.Connection, *amqp.Channel, []*confirmPublisher, error) {
 	var connectionURL string
 	if r.config.URL != "" {
 		connectionURL = r.config.URL
@@ -56,118 +105,202 @@ func (r *RabbitMQBroker) Connect() error {
 
 	conn, err := amqp.Dial(connectionURL)
 	if err != nil {
-		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
 
 	channel, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return fmt.Errorf("failed to open channel: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	// Set QoS if prefetch count is configured
-	if r.config.PrefetchCount > 0 {
-		err = channel.Qos(r.config.PrefetchCount, 0, false)
-		if err != nil {
-			channel.Close()
+	// Closing the connection closes its channels as well
+	publishers := make([]*confirmPublisher, r.publisherChannels())
+	for i := range publishers {
+		if publishers[i], err = newConfirmPublisher(conn); err != nil {
 			conn.Close()
-			return fmt.Errorf("failed to set QoS: %w", err)
+			return nil, nil, nil, err
 		}
 	}
-
-	r.conn = conn
-	r.channel = channel
-	r.connected = true
-
-	// Start connection monitoring
-	go r.monitorConnection()
-
-	log.Println("Successfully connected to RabbitMQ")
-	return nil
+	return conn, channel, publishers, nil
 }
 
 // IsConnected returns the connection status
 func (r *RabbitMQBroker) IsConnected() bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.connected && r.conn != nil && !r.conn.IsClosed()
+	return r.state == StateConnected && r.conn != nil && !r.conn.IsClosed()
 }
 
-// Health checks the broker health
+// Health reports the connection state, an error while the broker is not
+// connected
 func (r *RabbitMQBroker) Health() error {
-	if !r.IsConnected() {
-		return fmt.Errorf("RabbitMQ connection is not healthy")
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch {
+	case r.state == StateConnected && r.conn != nil && !r.conn.IsClosed():
+		return nil
+	case r.state == StateReconnecting:
+		return fmt.Errorf("RabbitMQ is reconnecting (attempt %d): %v", r.attempt, r.lastErr)
+	case r.state == StateFailed:
+		return fmt.Errorf("RabbitMQ reconnection gave up after %d attempts: %v", r.attempt, r.lastErr)
+	default:
+		return fmt.Errorf("RabbitMQ is not connected")
 	}
-	return nil
 }
 
-// Publish publishes a message to RabbitMQ
+// Publish publishes a message to RabbitMQ and waits until the broker confirms
+// it. A message no queue is bound for is returned as unroutable. Unless ctx has
+// a deadline, the wait is bounded by PublishTimeout.
 func (r *RabbitMQBroker) Publish(ctx context.Context, message *Message) error {
+	publisher, err := r.getPublisher()
+	if err != nil {
+		return err
+	}
+	if err := publisher.declareExchange(message.Topic); err != nil {
+		return err
+	}
+	done, err := publisher.send(message.Topic, message.RoutingKey, toPublishing(message))
+	if err != nil {
+		return &PublishError{MessageID: message.ID, Topic: message.Topic, Err: err}
+	}
+
+	ctx, cancel := r.confirmContext(ctx)
+	defer cancel()
+	return waitConfirm(ctx, message, done)
+}
+
+// PublishBatch publishes all messages before waiting for any confirm, so the
+// broker confirms them in a pipeline. Every message that is not confirmed is
+// reported as a PublishError with its index, joined into the returned error.
+func (r *RabbitMQBroker) PublishBatch(ctx context.Context, messages []*Message) error {
+	publisher, err := r.getPublisher()
+	if err != nil {
+		return err
+	}
+	declared := make(map[string]bool)
+	for _, message := range messages {
+		if declared[message.Topic] {
+			continue
+		}
+		if err := publisher.declareExchange(message.Topic); err != nil {
+			return err
+		}
+		declared[message.Topic] = true
+	}
+
+	var errs []error
+	pending := make([]<-chan error, len(messages))
+	for i, message := range messages {
+		done, err := publisher.send(message.Topic, message.RoutingKey, toPublishing(message))
+		if err != nil {
+			errs = append(errs, &PublishError{MessageID: message.ID, Topic: message.Topic, Index: i, Err: err})
+			continue
+		}
+		pending[i] = done
+	}
+
+	ctx, cancel := r.confirmContext(ctx)
+	defer cancel()
+	for i, done := range pending {
+		if done == nil {
+			continue
+		}
+		if err := waitConfirm(ctx, messages[i], done); err != nil {
+			var publishErr *PublishError
+			if errors.As(err, &publishErr) {
+				publishErr.Index = i
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// getPublisher returns the next publisher of the pool, connecting first if
+// needed. A channel closed by a channel error is replaced while the connection
+// is up.
+func (r *RabbitMQBroker) getPublisher() (*confirmPublisher, error) {
 	if !r.IsConnected() {
 		if err := r.Connect(); err != nil {
-			return fmt.Errorf("failed to connect before publishing: %w", err)
+			return nil, fmt.Errorf("failed to connect before publishing: %w", err)
 		}
 	}
 
-	r.mu.RLock()
-	channel := r.channel
-	r.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil || len(r.publishers) == 0 {
+		return nil, fmt.Errorf("connection is not available")
+	}
+	i := r.nextPublisher % len(r.publishers)
+	r.nextPublisher++
+	if r.publishers[i].isClosed() {
+		publisher, err := newConfirmPublisher(r.conn)
+		if err != nil {
+			return nil, err
+		}
+		r.publishers[i] = publisher
+	}
+	return r.publishers[i], nil
+}
 
-	if channel == nil {
-		return fmt.Errorf("channel is not available")
+func (r *RabbitMQBroker) publisherChannels() int {
+	if r.config.PublisherChannels > 0 {
+		return r.config.PublisherChannels
+	}
+	return defaultPublisherChannels
+}
+
+// confirmContext bounds the wait for confirms by PublishTimeout, unless ctx
+// already has a deadline
+func (r *RabbitMQBroker) confirmContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	timeout := r.config.PublishTimeout
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
 	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	// Declare exchange if needed
+// declareExchange declares the topic exchange messages are published to
+func declareExchange(channel *amqp.Channel, topic string) error {
 	err := channel.ExchangeDeclare(
-		message.Topic, // exchange name
-		"topic",       // exchange type
-		true,          // durable
-		false,         // auto-deleted
-		false,         // internal
-		false,         // no-wait
-		nil,           // arguments
+		topic,   // exchange name
+		"topic", // exchange type
+		true,    // durable
+		false,   // auto-deleted
+		false,   // internal
+		false,   // no-wait
+		nil,     // arguments
 	)
 	if err != nil {
 		return fmt.Errorf("failed to declare exchange: %w", err)
 	}
+	return nil
+}
 
-	// Convert headers
+// toPublishing converts a message into an AMQP publishing
+func toPublishing(message *Message) amqp.Publishing {
 	headers := make(amqp.Table)
 	for k, v := range message.Headers {
 		headers[k] = v
 	}
-
-	// Publish message
-	err = channel.Publish(
-		message.Topic,      // exchange
-		message.RoutingKey, // routing key
-		false,              // mandatory
-		false,              // immediate
-		amqp.Publishing{
-			MessageId:   message.ID,
-			ContentType: "application/json",
-			Body:        message.Body,
-			Headers:     headers,
-			Priority:    message.Priority,
-			Timestamp:   message.Timestamp,
-		},
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to publish message: %w", err)
+	headers[RetryCountHeader] = message.RetryCount
+	if message.MaxRetries > 0 {
+		headers[MaxRetriesHeader] = message.MaxRetries
 	}
 
-	return nil
-}
-
-// PublishBatch publishes multiple messages
-func (r *RabbitMQBroker) PublishBatch(ctx context.Context, messages []*Message) error {
-	for _, msg := range messages {
-		if err := r.Publish(ctx, msg); err != nil {
-			return err
-		}
+	return amqp.Publishing{
+		MessageId:   message.ID,
+		ContentType: "application/json",
+		Body:        message.Body,
+		Headers:     headers,
+		Priority:    message.Priority,
+		Timestamp:   message.Timestamp,
 	}
-	return nil
 }
 
 // Subscribe subscribes to a topic with a handler
@@ -176,9 +309,23 @@ func (r *RabbitMQBroker) Subscribe(topic string, handler MessageHandler) error {
 	r.handlers[topic] = handler
 	r.mu.Unlock()
 
+	return r.DeclareTopic(topic)
+}
+
+// DeclareTopic declares the exchange of a topic along with its queue, so
+// messages published before anyone subscribes are kept. While reconnecting,
+// the topic is declared once the connection is back.
+func (r *RabbitMQBroker) DeclareTopic(topic string) error {
+	r.mu.Lock()
+	if r.reconnectPending() {
+		r.topics[topic] = true
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
 	if !r.IsConnected() {
 		if err := r.Connect(); err != nil {
-			return fmt.Errorf("failed to connect before subscribing: %w", err)
+			return fmt.Errorf("failed to connect before declaring topic: %w", err)
 		}
 	}
 
@@ -204,14 +351,18 @@ func (r *RabbitMQBroker) Subscribe(topic string, handler MessageHandler) error {
 		return fmt.Errorf("failed to declare exchange: %w", err)
 	}
 
-	// Declare queue
+	// Declare queue, a priority queue when priorities are configured
+	var args amqp.Table
+	if r.config.MaxPriority > 0 {
+		args = amqp.Table{"x-max-priority": r.config.MaxPriority}
+	}
 	queue, err := channel.QueueDeclare(
-		fmt.Sprintf("%s_queue", topic), // queue name
-		true,                           // durable
-		false,                          // delete when unused
-		false,                          // exclusive
-		false,                          // no-wait
-		nil,                            // arguments
+		r.config.queueName(topic), // queue name
+		true,                      // durable
+		false,                     // delete when unused
+		false,                     // exclusive
+		false,                     // no-wait
+		args,                      // arguments
 	)
 	if err != nil {
 		return fmt.Errorf("failed to declare queue: %w", err)
@@ -229,6 +380,19 @@ func (r *RabbitMQBroker) Subscribe(topic string, handler MessageHandler) error {
 		return fmt.Errorf("failed to bind queue: %w", err)
 	}
 
+	// Declare where messages go once their retries are exhausted
+	if err := declareDeadLetter(channel, topic); err != nil {
+		return err
+	}
+
+	// Messages still waiting in the queue used without priorities are moved over
+	if queue.Name != legacyQueue(topic) {
+		r.retireLegacyQueue(topic)
+	}
+
+	r.mu.Lock()
+	r.topics[topic] = true
+	r.mu.Unlock()
 	return nil
 }
 
@@ -240,46 +404,94 @@ func (r *RabbitMQBroker) Unsubscribe(topic string) error {
 	return nil
 }
 
-// Start starts consuming messages
+// Start starts consuming the subscribed topics. Consumers are restarted
+// whenever the broker reconnects, until ctx is done. While reconnecting, they
+// start once the connection is back.
 func (r *RabbitMQBroker) Start(ctx context.Context) error {
+	r.mu.Lock()
+	if r.reconnectPending() {
+		r.consumeCtx, r.stopConsuming = context.WithCancel(ctx)
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
 	if !r.IsConnected() {
 		if err := r.Connect(); err != nil {
 			return fmt.Errorf("failed to connect before starting: %w", err)
 		}
 	}
 
-	r.mu.RLock()
-	handlers := make(map[string]MessageHandler)
-	for k, v := range r.handlers {
-		handlers[k] = v
-	}
-	channel := r.channel
-	r.mu.RUnlock()
-
-	if channel == nil {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.channel == nil {
 		return fmt.Errorf("channel is not available")
 	}
+	r.consumeCtx, r.stopConsuming = context.WithCancel(ctx)
+	r.startConsumers()
+	return nil
+}
 
-	// Start consuming for each subscribed topic
-	for topic, handler := range handlers {
-		go r.consume(ctx, topic, handler)
+// startConsumers starts a consumer for every handler that is not consumed on
+// the current connection yet. The caller must hold mu.
+func (r *RabbitMQBroker) startConsumers() {
+	if r.consumeCtx == nil || r.consumeCtx.Err() != nil || r.conn == nil {
+		return
+	}
+	for topic, handler := range r.handlers {
+		if r.consumers[topic] == r.conn {
+			continue
+		}
+		channel, err := r.consumerChannel()
+		if err != nil {
+			log.Printf("Failed to open consumer channel for topic %s: %v", topic, err)
+			continue
+		}
+		r.consumers[topic] = r.conn
+		r.wg.Add(1)
+		go r.consume(r.consumeCtx, r.conn, channel, topic, handler)
 	}
-
-	return nil
 }
 
-// consume handles message consumption for a specific topic
-func (r *RabbitMQBroker) consume(ctx context.Context, topic string, handler MessageHandler) {
-	r.mu.RLock()
-	channel := r.channel
-	r.mu.RUnlock()
+// consumerChannel opens a channel for one consumer. The broker hands it up to
+// PrefetchCount unacknowledged deliveries.
+func (r *RabbitMQBroker) consumerChannel() (*amqp.Channel, error) {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if r.config.PrefetchCount > 0 {
+		if err := channel.Qos(r.config.PrefetchCount, 0, false); err != nil {
+			channel.Close()
+			return nil, fmt.Errorf("failed to set QoS: %w", err)
+		}
+	}
+	return channel, nil
+}
 
-	if channel == nil {
-		log.Printf("Channel not available for topic %s", topic)
-		return
+// workers returns how many deliveries of topic are handled in parallel. More
+// workers than prefetched deliveries would only sit idle.
+func (c *Config) workers(topic string) int {
+	workers := max(c.Workers[topic], 1)
+	if c.PrefetchCount > 0 {
+		workers = min(workers, c.PrefetchCount)
 	}
+	return workers
+}
+
+// consume runs the workers of a topic on its own channel until ctx is done or
+// the channel closes. A channel closed by an error reconnects the broker.
+func (r *RabbitMQBroker) consume(ctx context.Context, conn *amqp.Connection, channel *amqp.Channel, topic string, handler MessageHandler) {
+	defer r.wg.Done()
+	defer func() {
+		r.mu.Lock()
+		if r.consumers[topic] == conn {
+			delete(r.consumers, topic)
+		}
+		r.mu.Unlock()
+	}()
 
-	queueName := fmt.Sprintf("%s_queue", topic)
+	closed := channel.NotifyClose(make(chan *amqp.Error, 1))
+	queueName := r.config.queueName(topic)
 	msgs, err := channel.Consume(
 		queueName, // queue
 		"",        // consumer
@@ -291,9 +503,35 @@ func (r *RabbitMQBroker) consume(ctx context.Context, topic string, handler Mess
 	)
 	if err != nil {
 		log.Printf("Failed to register consumer for topic %s: %v", topic, err)
+		channel.Close()
 		return
 	}
 
+	var wg sync.WaitGroup
+	for i := 0; i < r.config.workers(topic); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx, topic, handler, msgs)
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case cause := <-closed:
+		if cause != nil {
+			r.connectionLost(conn, cause)
+		}
+	default:
+		// Stopped by ctx, deliveries that were prefetched but not handled are requeued
+		channel.Close()
+	}
+}
+
+// work handles deliveries one at a time until ctx is done or the deliveries
+// end. Handlers run on the context of the broker, so a delivery that is being
+// handled when consuming stops is still finished.
+func (r *RabbitMQBroker) work(ctx context.Context, topic string, handler MessageHandler, msgs <-chan amqp.Delivery) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -302,7 +540,12 @@ func (r *RabbitMQBroker) consume(ctx context.Context, topic string, handler Mess
 			return
 		case msg, ok := <-msgs:
 			if !ok {
-				log.Printf("Message channel closed for topic %s", topic)
+				log.Printf("Message channel closed for topic %s, consuming resumes once reconnected", topic)
+				return
+			}
+			if ctx.Err() != nil {
+				// Consuming stopped while the delivery was picked up
+				msg.Nack(false, true)
 				return
 			}
 
@@ -320,37 +563,61 @@ func (r *RabbitMQBroker) consume(ctx context.Context, topic string, handler Mess
 				Headers:    headers,
 				Priority:   msg.Priority,
 				Timestamp:  msg.Timestamp,
+				RetryCount: headerInt(msg.Headers, RetryCountHeader, 0),
+				MaxRetries: headerInt(msg.Headers, MaxRetriesHeader, r.config.MaxRetries),
 			}
 
 			// Handle message
-			if err := handler(ctx, rabbitMsg); err != nil {
-				log.Printf("Error handling message: %v", err)
-				msg.Nack(false, true) // Requeue on error
-			} else {
+			err := handler(r.ctx, rabbitMsg)
+			switch {
+			case err == nil:
 				msg.Ack(false)
+			case r.ctx.Err() != nil:
+				// Interrupted by shutdown, requeued without using up a retry
+				msg.Nack(false, true)
+			default:
+				log.Printf("Error handling message: %v", err)
+				r.handleFailure(topic, rabbitMsg, msg, err) // Retry with backoff or dead-letter
 			}
 		}
 	}
 }
 
-// Stop stops the broker
+// Shutdown stops consuming, waits for the deliveries being handled and then
+// closes the connection. Handlers still running once ctx is done are
+// cancelled and their deliveries requeued.
+func (r *RabbitMQBroker) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopConsuming != nil {
+		r.stopConsuming()
+	}
+	r.mu.Unlock()
+
+	var err error
+	drained := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("handlers did not finish in time: %w", ctx.Err())
+		r.cancel()
+		<-drained
+	}
+	return errors.Join(err, r.Stop())
+}
+
+// Stop stops the broker right away, handlers in flight are cancelled
 func (r *RabbitMQBroker) Stop() error {
 	r.cancel()
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.channel != nil {
-		r.channel.Close()
-		r.channel = nil
-	}
-
-	if r.conn != nil {
-		r.conn.Close()
-		r.conn = nil
-	}
-
-	r.connected = false
+	r.closeConnection()
+	r.state = StateDisconnected
 	log.Println("RabbitMQ broker stopped")
 	return nil
 }
@@ -359,43 +626,3 @@ func (r *RabbitMQBroker) Stop() error {
 func (r *RabbitMQBroker) Close() error {
 	return r.Stop()
 }
-
-// monitorConnection monitors the connection and reconnects if needed
-func (r *RabbitMQBroker) monitorConnection() {
-	for {
-		select {
-		case <-r.ctx.Done():
-			return
-		case <-time.After(30 * time.Second):
-			if !r.IsConnected() {
-				log.Println("Connection lost, attempting to reconnect...")
-				if err := r.reconnect(); err != nil {
-					log.Printf("Reconnection failed: %v", err)
-				}
-			}
-		}
-	}
-}
-
-// reconnect attempts to reconnect to RabbitMQ
-func (r *RabbitMQBroker) reconnect() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	// Close existing connections
-	if r.channel != nil {
-		r.channel.Close()
-		r.channel = nil
-	}
-	if r.conn != nil {
-		r.conn.Close()
-		r.conn = nil
-	}
-	r.connected = false
-
-	// Wait before reconnecting
-	time.Sleep(r.config.ReconnectDelay)
-
-	// Attempt to reconnect
-	return r.Connect()
-}
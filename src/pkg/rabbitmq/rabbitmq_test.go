@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestWorkers(t *testing.T) {
+	tests := []struct {
+		name          string
+		workers       map[string]int
+		prefetchCount int
+		want          int
+	}{
+		{name: "not configured", want: 1},
+		{name: "configured", workers: map[string]int{"test": 4}, want: 4},
+		{name: "other topic configured", workers: map[string]int{"other": 4}, want: 1},
+		{name: "capped by the prefetch count", workers: map[string]int{"test": 8}, prefetchCount: 3, want: 3},
+		{name: "below the prefetch count", workers: map[string]int{"test": 2}, prefetchCount: 10, want: 2},
+		{name: "negative", workers: map[string]int{"test": -1}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Workers: tt.workers, PrefetchCount: tt.prefetchCount}
+			if got := config.workers("test"); got != tt.want {
+				t.Errorf("workers = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPublisherRoundRobin(t *testing.T) {
+	r := NewRabbitMQBroker(&Config{})
+	r.conn = &amqp.Connection{}
+	r.state = StateConnected
+	r.publishers = []*confirmPublisher{{}, {}, {}}
+
+	for i := 0; i < 2*len(r.publishers); i++ {
+		publisher, err := r.getPublisher()
+		if err != nil {
+			t.Fatalf("getPublisher: %v", err)
+		}
+		if want := r.publishers[i%len(r.publishers)]; publisher != want {
+			t.Errorf("publish %d used publisher %p, want %p", i, publisher, want)
+		}
+	}
+}
+
+func TestRetireLegacyQueue(t *testing.T) {
+	r := NewRabbitMQBroker(&Config{MaxPriority: 10})
+
+	// Without a connection retiring fails, so it is tried again next time
+	r.retireLegacyQueue("test")
+	if r.retired["test"] {
+		t.Fatal("failed retirement marked as done")
+	}
+
+	// Once retired the queue is left alone, a failing attempt would unmark it
+	r.retired["test"] = true
+	r.retireLegacyQueue("test")
+	if !r.retired["test"] {
+		t.Error("retired queue retired again")
+	}
+}
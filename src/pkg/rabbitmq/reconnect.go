@@ -0,0 +1,214 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultReconnectDelay = 5 * time.Second
+	minReconnectDelay     = 500 * time.Millisecond
+)
+
+// ConnectionState is the state of the broker connection
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnected
+	StateReconnecting
+	StateFailed // Reconnection gave up after MaxReconnectAttempts
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return "disconnected"
+	}
+}
+
+// State returns the current connection state
+func (r *RabbitMQBroker) State() ConnectionState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state
+}
+
+// Open connects to RabbitMQ, or starts reconnecting in the background when it
+// cannot be reached, e.g. while it is still starting up next to the service
+func (r *RabbitMQBroker) Open() {
+	err := r.Connect()
+	if err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == StateConnected || r.reconnecting || r.ctx.Err() != nil {
+		return
+	}
+	log.Printf("RabbitMQ is unreachable, connecting in the background: %v", err)
+	r.state = StateReconnecting
+	r.attempt = 0
+	r.lastErr = err
+	r.reconnecting = true
+	go r.reconnect()
+}
+
+// reconnectPending reports whether a reconnection is underway that has not
+// connected yet. Topics and consumers are then set up by restore. The caller
+// must hold mu.
+func (r *RabbitMQBroker) reconnectPending() bool {
+	return r.reconnecting && r.state != StateConnected
+}
+
+// watch waits until the connection or the topology channel closes. A close
+// without an error comes from Stop, anything else starts a reconnection.
+func (r *RabbitMQBroker) watch(conn *amqp.Connection, connClosed, channelClosed <-chan *amqp.Error) {
+	var cause *amqp.Error
+	select {
+	case <-r.ctx.Done():
+		return
+	case cause = <-connClosed:
+	case cause = <-channelClosed:
+	}
+	if cause != nil {
+		r.connectionLost(conn, cause)
+	}
+}
+
+// connectionLost starts reconnecting after conn failed, unless conn has
+// already been replaced or a reconnection is underway
+func (r *RabbitMQBroker) connectionLost(conn *amqp.Connection, cause *amqp.Error) {
+	r.mu.Lock()
+	if r.conn != conn || r.reconnecting || r.ctx.Err() != nil {
+		r.mu.Unlock()
+		return
+	}
+	log.Printf("RabbitMQ connection lost: %v", cause)
+	r.closeConnection()
+	r.state = StateReconnecting
+	r.attempt = 0
+	r.lastErr = cause
+	r.reconnecting = true
+	r.mu.Unlock()
+
+	go r.reconnect()
+}
+
+// reconnect dials again with jittered exponential backoff, up to
+// MaxReconnectAttempts times when that is set. Once connected, the declared
+// topics are declared again and every handler is consumed again.
+func (r *RabbitMQBroker) reconnect() {
+	defer func() {
+		r.mu.Lock()
+		r.reconnecting = false
+		r.mu.Unlock()
+	}()
+
+	for attempt := 1; r.config.MaxReconnectAttempts <= 0 || attempt <= r.config.MaxReconnectAttempts; attempt++ {
+		r.mu.Lock()
+		r.attempt = attempt
+		r.mu.Unlock()
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(r.reconnectDelay(attempt)):
+		}
+
+		err := r.Connect()
+		if err == nil {
+			err = r.restore()
+		}
+		if err == nil {
+			// A connection lost while restoring is not watched by anyone else
+			r.mu.Lock()
+			restored := r.state == StateConnected && r.conn != nil && !r.conn.IsClosed()
+			if restored {
+				r.reconnecting = false
+			}
+			r.mu.Unlock()
+			if restored {
+				log.Printf("Reconnected to RabbitMQ after %d attempts", attempt)
+				return
+			}
+			err = fmt.Errorf("connection closed while restoring topology")
+		}
+
+		log.Printf("Reconnection attempt %d failed: %v", attempt, err)
+		r.mu.Lock()
+		r.closeConnection()
+		r.state = StateReconnecting
+		r.lastErr = err
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	r.state = StateFailed
+	r.mu.Unlock()
+	log.Printf("Giving up reconnecting to RabbitMQ after %d attempts", r.config.MaxReconnectAttempts)
+}
+
+// restore declares the known topics again and restarts their consumers
+func (r *RabbitMQBroker) restore() error {
+	r.mu.RLock()
+	topics := make([]string, 0, len(r.topics))
+	for topic := range r.topics {
+		topics = append(topics, topic)
+	}
+	r.mu.RUnlock()
+
+	for _, topic := range topics {
+		if err := r.DeclareTopic(topic); err != nil {
+			return fmt.Errorf("failed to redeclare topic %s: %w", topic, err)
+		}
+	}
+
+	r.mu.Lock()
+	r.startConsumers()
+	r.mu.Unlock()
+	return nil
+}
+
+// reconnectDelay returns the delay before the given attempt. It doubles from
+// minReconnectDelay up to ReconnectDelay, and is randomised between half and
+// all of that so that clients do not reconnect in lockstep.
+func (r *RabbitMQBroker) reconnectDelay(attempt int) time.Duration {
+	maxDelay := r.config.ReconnectDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultReconnectDelay
+	}
+	delay := min(minReconnectDelay, maxDelay)
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// closeConnection closes the channels and the connection. The caller must hold mu.
+func (r *RabbitMQBroker) closeConnection() {
+	for _, publisher := range r.publishers {
+		publisher.close()
+	}
+	r.publishers = nil
+	if r.channel != nil {
+		r.channel.Close()
+		r.channel = nil
+	}
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
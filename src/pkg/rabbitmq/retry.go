@@ -0,0 +1,216 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Headers used to track the delivery attempts of a message
+const (
+	RetryCountHeader = "x-retry-count"
+	MaxRetriesHeader = "x-max-retries"
+	ErrorHeader      = "x-error"
+)
+
+const (
+	defaultRetryDelay    = 5 * time.Second
+	defaultMaxRetryDelay = 5 * time.Minute
+)
+
+// permanentError marks a handler error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so the message is dead-lettered without being retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// DeadLetterExchange returns the exchange that receives the messages of topic
+// whose retries are exhausted
+func DeadLetterExchange(topic string) string {
+	return fmt.Sprintf("%s.dead_letter", topic)
+}
+
+// DeadLetterQueue returns the queue that keeps the dead-lettered messages of topic
+func DeadLetterQueue(topic string) string {
+	return fmt.Sprintf("%s_dead_letter", topic)
+}
+
+func retryQueue(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s_retry_%d", topic, delay.Milliseconds())
+}
+
+// declareDeadLetter declares the dead-letter exchange and queue of topic
+func declareDeadLetter(channel *amqp.Channel, topic string) error {
+	exchange := DeadLetterExchange(topic)
+	if err := channel.ExchangeDeclare(exchange, "topic", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %w", err)
+	}
+	queue, err := channel.QueueDeclare(DeadLetterQueue(topic), true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+	if err := channel.QueueBind(queue.Name, "#", exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+	return nil
+}
+
+// retryDelay returns the exponential backoff before the given retry, starting
+// at RetryDelay and doubling up to MaxRetryDelay
+func retryDelay(config *Config, retry int) time.Duration {
+	delay := config.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	maxDelay := config.MaxRetryDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRetryDelay
+	}
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// handleFailure schedules a failed delivery for another attempt, or dead-letters
+// it once its retries are exhausted. The copy is published on a confirming
+// channel and the delivery is only acknowledged once the broker confirmed the
+// copy, so it is requeued if that fails.
+func (r *RabbitMQBroker) handleFailure(topic string, msg *Message, delivery amqp.Delivery, handlerErr error) {
+	publisher, err := r.getPublisher()
+	if err == nil {
+		if shouldRetry(msg, handlerErr) {
+			err = r.retry(publisher, topic, msg, delivery)
+		} else {
+			err = r.deadLetter(publisher, topic, msg, delivery, handlerErr)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to reschedule message %s: %v", msg.ID, err)
+		delivery.Nack(false, true)
+		return
+	}
+	delivery.Ack(false)
+}
+
+// shouldRetry reports whether a failed message has retries left and the error
+// may go away on another attempt
+func shouldRetry(msg *Message, handlerErr error) bool {
+	return !IsPermanent(handlerErr) && msg.RetryCount < msg.MaxRetries
+}
+
+// retry parks the message in a delay queue whose expired messages are
+// dead-lettered back to the topic exchange. Every delay gets its own queue,
+// because RabbitMQ only expires messages at the head of a queue.
+func (r *RabbitMQBroker) retry(publisher *confirmPublisher, topic string, msg *Message, delivery amqp.Delivery) error {
+	delay := retryDelay(r.config, msg.RetryCount+1)
+	queue := retryQueue(topic, delay)
+	err := publisher.declareQueue(queue, amqp.Table{
+		"x-message-ttl":          delay.Milliseconds(),
+		"x-dead-letter-exchange": topic,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare retry queue: %w", err)
+	}
+
+	publishing := republish(delivery)
+	publishing.Headers[RetryCountHeader] = msg.RetryCount + 1
+	publishing.Headers[MaxRetriesHeader] = msg.MaxRetries
+	if err := r.sendConfirmed(publisher, msg, "", queue, publishing); err != nil {
+		return fmt.Errorf("failed to publish retry: %w", err)
+	}
+
+	log.Printf("Retrying message %s in %s (attempt %d of %d)", msg.ID, delay, msg.RetryCount+1, msg.MaxRetries)
+	return nil
+}
+
+// deadLetter moves the message to the dead-letter exchange of topic along with
+// the error of its last attempt
+func (r *RabbitMQBroker) deadLetter(publisher *confirmPublisher, topic string, msg *Message, delivery amqp.Delivery, handlerErr error) error {
+	publishing := republish(delivery)
+	publishing.Headers[RetryCountHeader] = msg.RetryCount
+	publishing.Headers[ErrorHeader] = handlerErr.Error()
+	if err := r.sendConfirmed(publisher, msg, DeadLetterExchange(topic), delivery.RoutingKey, publishing); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	log.Printf("Dead-lettered message %s after %d retries: %v", msg.ID, msg.RetryCount, handlerErr)
+	return nil
+}
+
+// sendConfirmed publishes a copy of msg and waits for the broker to confirm it,
+// at most PublishTimeout. It does not stop at shutdown, the delivery is settled
+// either way.
+func (r *RabbitMQBroker) sendConfirmed(publisher *confirmPublisher, msg *Message, exchange, key string, publishing amqp.Publishing) error {
+	done, err := publisher.send(exchange, key, publishing)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := r.confirmContext(context.Background())
+	defer cancel()
+	return waitConfirm(ctx, msg, done)
+}
+
+// republish copies a delivery into a new publishing
+func republish(delivery amqp.Delivery) amqp.Publishing {
+	headers := make(amqp.Table, len(delivery.Headers)+2)
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	// The broker maintains x-death itself whenever a delay queue expires the message
+	delete(headers, "x-death")
+
+	return amqp.Publishing{
+		MessageId:    delivery.MessageId,
+		ContentType:  delivery.ContentType,
+		Body:         delivery.Body,
+		Headers:      headers,
+		Priority:     delivery.Priority,
+		Timestamp:    delivery.Timestamp,
+		DeliveryMode: delivery.DeliveryMode,
+	}
+}
+
+// headerInt reads an integer header, which the AMQP codec may decode into any integer type
+func headerInt(headers amqp.Table, key string, fallback int) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	}
+	return fallback
+}
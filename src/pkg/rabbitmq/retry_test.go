@@ -0,0 +1,134 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		retry  int
+		want   time.Duration
+	}{
+		{name: "first retry", config: Config{RetryDelay: time.Second, MaxRetryDelay: time.Minute}, retry: 1, want: time.Second},
+		{name: "doubled", config: Config{RetryDelay: time.Second, MaxRetryDelay: time.Minute}, retry: 2, want: 2 * time.Second},
+		{name: "doubled again", config: Config{RetryDelay: time.Second, MaxRetryDelay: time.Minute}, retry: 4, want: 8 * time.Second},
+		{name: "capped", config: Config{RetryDelay: time.Second, MaxRetryDelay: 10 * time.Second}, retry: 5, want: 10 * time.Second},
+		{name: "capped far beyond", config: Config{RetryDelay: time.Second, MaxRetryDelay: 10 * time.Second}, retry: 100, want: 10 * time.Second},
+		{name: "delay above the cap", config: Config{RetryDelay: time.Minute, MaxRetryDelay: time.Second}, retry: 1, want: time.Second},
+		{name: "defaults", config: Config{}, retry: 1, want: defaultRetryDelay},
+		{name: "default cap", config: Config{}, retry: 100, want: defaultMaxRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(&tt.config, tt.retry); got != tt.want {
+				t.Errorf("retryDelay(%d) = %s, want %s", tt.retry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	failure := errors.New("failure")
+	tests := []struct {
+		name       string
+		retryCount int
+		maxRetries int
+		err        error
+		want       bool
+	}{
+		{name: "retries left", retryCount: 0, maxRetries: 3, err: failure, want: true},
+		{name: "last retry left", retryCount: 2, maxRetries: 3, err: failure, want: true},
+		{name: "retries exhausted", retryCount: 3, maxRetries: 3, err: failure, want: false},
+		{name: "no retries", retryCount: 0, maxRetries: 0, err: failure, want: false},
+		{name: "permanent", retryCount: 0, maxRetries: 3, err: Permanent(failure), want: false},
+		{name: "wrapped permanent", retryCount: 0, maxRetries: 3, err: fmt.Errorf("handling: %w", Permanent(failure)), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{RetryCount: tt.retryCount, MaxRetries: tt.maxRetries}
+			if got := shouldRetry(msg, tt.err); got != tt.want {
+				t.Errorf("shouldRetry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "dead-letter exchange", got: DeadLetterExchange("image.processing"), want: "image.processing.dead_letter"},
+		{name: "dead-letter queue", got: DeadLetterQueue("image.processing"), want: "image.processing_dead_letter"},
+		// Every delay has a queue of its own, messages only expire at the head of a queue
+		{name: "retry queue", got: retryQueue("image.processing", 5*time.Second), want: "image.processing_retry_5000"},
+		{name: "longer retry queue", got: retryQueue("image.processing", 10*time.Second), want: "image.processing_retry_10000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepublish(t *testing.T) {
+	delivery := amqp.Delivery{
+		MessageId: "1",
+		Body:      []byte("body"),
+		Priority:  5,
+		Headers: amqp.Table{
+			RetryCountHeader: int32(2),
+			"x-death":        []interface{}{amqp.Table{"count": int64(1)}},
+		},
+	}
+	publishing := republish(delivery)
+	publishing.Headers[RetryCountHeader] = 3
+
+	if _, ok := publishing.Headers["x-death"]; ok {
+		t.Error("x-death copied, the broker maintains it")
+	}
+	if publishing.MessageId != "1" || string(publishing.Body) != "body" || publishing.Priority != 5 {
+		t.Errorf("publishing %+v does not match the delivery", publishing)
+	}
+	if got := headerInt(delivery.Headers, RetryCountHeader, 0); got != 2 {
+		t.Errorf("headers of the delivery changed, retry count %d", got)
+	}
+}
+
+func TestHeaderInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  int
+	}{
+		{name: "int", value: 3, want: 3},
+		{name: "int8", value: int8(3), want: 3},
+		{name: "int16", value: int16(3), want: 3},
+		{name: "int32", value: int32(3), want: 3},
+		{name: "int64", value: int64(3), want: 3},
+		{name: "uint8", value: uint8(3), want: 3},
+		{name: "missing", value: nil, want: -1},
+		{name: "not a number", value: "3", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := amqp.Table{}
+			if tt.value != nil {
+				headers[RetryCountHeader] = tt.value
+			}
+			if got := headerInt(headers, RetryCountHeader, -1); got != tt.want {
+				t.Errorf("headerInt = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
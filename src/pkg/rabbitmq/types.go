@@ -7,15 +7,15 @@ import (
 
 // Message represents a generic message structure
 type Message struct {
-	ID          string                 `json:"id"`
-	Topic       string                 `json:"topic"`
-	RoutingKey  string                 `json:"routing_key"`
-	Body        []byte                 `json:"body"`
-	Headers     map[string]interface{} `json:"headers"`
-	Priority    uint8                  `json:"priority"`
-	Timestamp   time.Time              `json:"timestamp"`
-	RetryCount  int                    `json:"retry_count"`
-	MaxRetries  int                    `json:"max_retries"`
+	ID         string                 `json:"id"`
+	Topic      string                 `json:"topic"`
+	RoutingKey string                 `json:"routing_key"`
+	Body       []byte                 `json:"body"`
+	Headers    map[string]interface{} `json:"headers"`
+	Priority   uint8                  `json:"priority"`
+	Timestamp  time.Time              `json:"timestamp"`
+	RetryCount int                    `json:"retry_count"`
+	MaxRetries int                    `json:"max_retries"`
 }
 
 // MessageHandler defines the function signature for message handlers
@@ -23,15 +23,22 @@ type MessageHandler func(ctx context.Context, message *Message) error
 
 // Config represents RabbitMQ configuration
 type Config struct {
-	URL                  string        `mapstructure:"url"`
-	Host                 string        `mapstructure:"host"`
-	Port                 string        `mapstructure:"port"`
-	Username             string        `mapstructure:"username"`
-	Password             string        `mapstructure:"password"`
-	VHost                string        `mapstructure:"vhost"`
-	PrefetchCount        int           `mapstructure:"prefetch_count"`
-	ReconnectDelay       time.Duration `mapstructure:"reconnect_delay"`
-	MaxReconnectAttempts int           `mapstructure:"max_reconnect_attempts"`
+	URL                  string         `mapstructure:"url"`
+	Host                 string         `mapstructure:"host"`
+	Port                 string         `mapstructure:"port"`
+	Username             string         `mapstructure:"username"`
+	Password             string         `mapstructure:"password"`
+	VHost                string         `mapstructure:"vhost"`
+	PrefetchCount        int            `mapstructure:"prefetch_count"`
+	ReconnectDelay       time.Duration  `mapstructure:"reconnect_delay"`        // Upper bound of the jittered delay between reconnection attempts
+	MaxReconnectAttempts int            `mapstructure:"max_reconnect_attempts"` // Zero keeps reconnecting forever
+	MaxRetries           int            `mapstructure:"max_retries"`            // Used when a message does not set MaxRetries
+	RetryDelay           time.Duration  `mapstructure:"retry_delay"`            // Delay before the first retry, doubled for every further one
+	MaxRetryDelay        time.Duration  `mapstructure:"max_retry_delay"`        // Upper bound of the retry delay
+	MaxPriority          uint8          `mapstructure:"max_priority"`           // Enables priority queues when set
+	PublishTimeout       time.Duration  `mapstructure:"publish_timeout"`        // Bounds the wait for a publisher confirm when the context has no deadline
+	PublisherChannels    int            `mapstructure:"publisher_channels"`     // Size of the pool of publishing channels
+	Workers              map[string]int `mapstructure:"workers"`                // Deliveries of a topic handled in parallel, at most PrefetchCount
 }
 
 // Publisher defines the interface for publishing messages
@@ -46,6 +53,7 @@ type Consumer interface {
 	Subscribe(topic string, handler MessageHandler) error
 	Unsubscribe(topic string) error
 	Start(ctx context.Context) error
+	Shutdown(ctx context.Context) error
 	Stop() error
 }
 
@@ -53,7 +61,11 @@ type Consumer interface {
 type RabbitMQ interface {
 	Publisher
 	Consumer
+	DeclareTopic(topic string) error
 	Connect() error
+	// Open connects like Connect, but keeps trying in the background while the
+	// broker is unreachable. Topics and subscriptions are set up once connected.
+	Open()
 	IsConnected() bool
 	Health() error
 }
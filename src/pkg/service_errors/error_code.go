@@ -20,6 +20,19 @@ const (
 	UserNotOwner    = "user is not the owner of this workout"
 	InvalidStatus   = "invalid status. Status must be 'active' or 'completed' or 'canceled'"
 
+	// Processing
+	ResultNotReady       = "processing result is not ready"
+	PriorityNotAllowed   = "priority is not allowed for the current user"
+	JobAlreadyFinished   = "processing job has already finished"
+	ScheduleTooFar       = "processing job is scheduled too far in the future"
+	BatchTooLarge        = "processing batch has too many images"
+	BatchAlreadyFinished = "processing batch has already finished"
+	PresetExists         = "a preset with this name already exists"
+
+	// Idempotency
+	IdempotencyKeyReused     = "idempotency key was already used for a different request"
+	IdempotencyKeyInProgress = "a request with this idempotency key is still in progress"
+
 	// DB
 	RecordNotFound = "record not found"
 	UnknownError   = "unknown error"